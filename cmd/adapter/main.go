@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"net"
@@ -12,8 +13,10 @@ import (
 	"time"
 
 	"github.com/ashishGuliya/onix/core/module"
+	"github.com/ashishGuliya/onix/core/module/handler"
 	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/plugin"
+	"github.com/ashishGuliya/onix/pkg/response"
 
 	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -25,18 +28,27 @@ import (
 
 // config struct holds all configurations.
 type config struct {
-	AppName       string                `yaml:"appName"`
-	Log           log.Config            `yaml:"log"`
-	PluginManager *plugin.ManagerConfig `yaml:"pluginManager"`
-	Modules       []module.Config       `yaml:"modules"`
-	HTTP          httpConfig            `yaml:"http"` // Nest http config
+	AppName       string                 `yaml:"appName"`
+	Log           log.Config             `yaml:"log"`
+	PluginManager *plugin.ManagerConfig  `yaml:"pluginManager"`
+	Modules       []module.Config        `yaml:"modules"`
+	HTTP          httpConfig             `yaml:"http"` // Nest http config
+	Upstreams     handler.UpstreamConfig `yaml:"upstreams"`
+	// ErrorCatalogue is the file of the Beckn error codes used in NACK responses, see response.LoadCatalogue.
+	ErrorCatalogue string `yaml:"errorCatalogue"`
 }
 
 type httpConfig struct {
 	Port    string        `yaml:"port"`
 	Timeout timeoutConfig `yaml:"timeout"`
+	// AdminAddr is the address of the listener serving the operational endpoints,
+	// defaultAdminAddr when empty. It must not be reachable from the network.
+	AdminAddr string `yaml:"adminAddr"`
 }
 
+// defaultAdminAddr only accepts connections from the host the adapter runs on.
+const defaultAdminAddr = "127.0.0.1:8081"
+
 type timeoutConfig struct {
 	Read  time.Duration `yaml:"read"`
 	Write time.Duration `yaml:"write"`
@@ -132,6 +144,17 @@ func newServer(ctx context.Context, mgr *plugin.Manager, cfg *config) (http.Hand
 	return mux, nil
 }
 
+// newAdminServer creates the handler of the admin listener, which serves the operational
+// endpoints apart from the network facing modules.
+func newAdminServer() http.Handler {
+	mux := http.NewServeMux()
+	// Operational counters such as router reloads.
+	mux.Handle("/debug/vars", expvar.Handler())
+	// Health of weighted route targets.
+	mux.Handle("/admin/upstreams", handler.UpstreamsHandler)
+	return mux
+}
+
 // run encapsulates the application logic.
 func run(ctx context.Context, configPath string) error {
 	closers := []func(){}
@@ -158,6 +181,18 @@ func run(ctx context.Context, configPath string) error {
 	}
 	closers = append(closers, close)
 
+	if len(cfg.ErrorCatalogue) != 0 {
+		if err := response.LoadCatalogue(cfg.ErrorCatalogue); err != nil {
+			return fmt.Errorf("failed to load error catalogue: %w", err)
+		}
+	}
+
+	stopProbes, err := handler.ConfigureUpstreams(ctx, &cfg.Upstreams)
+	if err != nil {
+		return fmt.Errorf("failed to configure upstreams: %w", err)
+	}
+	closers = append(closers, stopProbes)
+
 	// Initialize HTTP server.
 	log.Infof(ctx, "Initializing HTTP server")
 	srv, err := newServer(ctx, mgr, cfg)
@@ -174,26 +209,40 @@ func run(ctx context.Context, configPath string) error {
 		IdleTimeout:  cfg.HTTP.Timeout.Idle * time.Second,
 	}
 
-	// Start HTTP server.
+	adminAddr := cfg.HTTP.AdminAddr
+	if len(adminAddr) == 0 {
+		adminAddr = defaultAdminAddr
+	}
+	adminServer := &http.Server{
+		Addr:         adminAddr,
+		Handler:      newAdminServer(),
+		ReadTimeout:  cfg.HTTP.Timeout.Read * time.Second,
+		WriteTimeout: cfg.HTTP.Timeout.Write * time.Second,
+		IdleTimeout:  cfg.HTTP.Timeout.Idle * time.Second,
+	}
+
+	// Start HTTP servers.
 	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Infof(ctx, "Server listening on %s", httpServer.Addr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Errorf(ctx, fmt.Errorf("http server ListenAndServe: %w", err), "error listening and serving")
-		}
-	}()
+	for _, s := range []*http.Server{httpServer, adminServer} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Infof(ctx, "Server listening on %s", s.Addr)
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf(ctx, fmt.Errorf("http server ListenAndServe: %w", err), "error listening and serving")
+			}
+		}()
+	}
 
 	// Handle shutdown.
-	shutdown(ctx, httpServer, &wg, closers)
+	shutdown(ctx, []*http.Server{httpServer, adminServer}, &wg, closers)
 	wg.Wait()
 	log.Infof(ctx, "Server shutdown complete")
 	return nil
 }
 
 // shutdown handles server shutdown.
-func shutdown(ctx context.Context, httpServer *http.Server, wg *sync.WaitGroup, closers []func()) {
+func shutdown(ctx context.Context, httpServers []*http.Server, wg *sync.WaitGroup, closers []func()) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -201,8 +250,10 @@ func shutdown(ctx context.Context, httpServer *http.Server, wg *sync.WaitGroup,
 		log.Infof(ctx, "Shutting down server...")
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			log.Errorf(ctx, fmt.Errorf("http server Shutdown: %w", err), "error shutting down http server")
+		for _, httpServer := range httpServers {
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				log.Errorf(ctx, fmt.Errorf("http server Shutdown: %w", err), "error shutting down http server")
+			}
 		}
 
 		// Call all closer functions.
@@ -3,13 +3,17 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/ashishGuliya/onix/pkg/authheader"
 	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
 
 	retryablehttp "github.com/hashicorp/go-retryablehttp"
 )
@@ -22,8 +26,26 @@ type Config struct {
 	RetryWaitMax time.Duration
 	// Add other configuration options here
 	// e.g., Timeout time.Duration
+
+	// SubscriberID, when set, signs lookup requests with its signing key using RemoteSigner,
+	// or Signer and KeyManager when RemoteSigner is not set. Subscribe requests are always
+	// signed with Signer.
+	SubscriberID string
+	Signer       definition.Signer
+	KeyManager   definition.KeyManager
+	RemoteSigner definition.RemoteSigner
+	// SignatureTTL is the validity of request signatures, lookupSignValidity when zero.
+	SignatureTTL time.Duration
+
+	// RegistryPublicKey, when set, is the pinned signing public key of the registry.
+	// Lookup responses must then carry a signature that Validator verifies against it.
+	RegistryPublicKey string
+	Validator         definition.SignValidator
 }
 
+// lookupSignValidity is how long the signature of a lookup request is valid by default.
+const lookupSignValidity = 5 * time.Minute
+
 // registeryClient encapsulates the logic for calling the subscribe and lookup endpoints.
 type registeryClient struct {
 	Config *Config
@@ -40,20 +62,31 @@ func NewRegisteryClient(config *Config) *registeryClient {
 	return &registeryClient{Config: config, Client: retryClient}
 }
 
-// Subscribe calls the /subscribe endpoint with retry.
-func (c *registeryClient) Subscribe(ctx context.Context, subscription *model.Subscription) error {
+// Subscribe calls the /subscribe endpoint with retry. The request is signed with
+// signingPrivateKey, the signing key of the subscription, using Signer.
+func (c *registeryClient) Subscribe(ctx context.Context, subscription *model.Subscription, signingPrivateKey string) error {
 	subscribeURL := fmt.Sprintf("%s/subscribe", c.Config.RegisteryURL)
 
 	jsonData, err := json.Marshal(subscription)
 	if err != nil {
 		return fmt.Errorf("failed to marshal subscription data: %w", err)
 	}
+	if c.Config.Signer == nil {
+		return fmt.Errorf("signer not configured")
+	}
+	now := time.Now()
+	createdAt, validTill := now.Unix(), now.Add(c.signatureTTL()).Unix()
+	sign, err := c.Config.Signer.Sign(ctx, jsonData, signingPrivateKey, createdAt, validTill)
+	if err != nil {
+		return fmt.Errorf("failed to sign subscribe request: %w", err)
+	}
 
-	req, err := retryablehttp.NewRequest("POST", subscribeURL, bytes.NewBuffer(jsonData))
+	req, err := retryablehttp.NewRequestWithContext(ctx, "POST", subscribeURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(model.AuthHeaderSubscriber, authheader.New(subscription.SubscriberID, subscription.KeyID, createdAt, validTill, sign).String())
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
@@ -67,41 +100,140 @@ func (c *registeryClient) Subscribe(ctx context.Context, subscription *model.Sub
 	return nil
 }
 
-// Lookup calls the /lookup endpoint with retry and returns a slice of Subscription.
+// Lookup calls the /lookup endpoint with retry and returns a slice of Subscription,
+// following the registry's pages until all matching subscriptions are read.
+// The request is signed when SubscriberID is configured and the response is rejected
+// unless its signature, which covers the nonce of the request, verifies when
+// RegistryPublicKey is configured. Responses with subscriptions of another subscriber
+// or key than the requested ones are rejected.
 func (c *registeryClient) Lookup(ctx context.Context, subscription *model.Subscription) ([]model.Subscription, error) {
-	lookupURL := fmt.Sprintf("%s/lookUp", c.Config.RegisteryURL)
-
 	jsonData, err := json.Marshal(subscription)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal subscription data: %w", err)
 	}
 
-	req, err := retryablehttp.NewRequest("POST", lookupURL, bytes.NewBuffer(jsonData))
+	var results []model.Subscription
+	offset := 0
+	for {
+		page, next, err := c.lookupPage(ctx, jsonData, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range page {
+			if (len(subscription.SubscriberID) != 0 && sub.SubscriberID != subscription.SubscriberID) ||
+				(len(subscription.KeyID) != 0 && sub.KeyID != subscription.KeyID) {
+				return nil, fmt.Errorf("lookup for %s|%s returned %s|%s", subscription.SubscriberID, subscription.KeyID, sub.SubscriberID, sub.KeyID)
+			}
+		}
+		results = append(results, page...)
+		if len(next) == 0 {
+			return results, nil
+		}
+		nextOffset, err := strconv.Atoi(next)
+		if err != nil || nextOffset <= offset {
+			return nil, fmt.Errorf("invalid %s in lookup response: %s", model.NextOffsetHeader, next)
+		}
+		offset = nextOffset
+	}
+}
+
+// lookupPage calls the /lookup endpoint for the page at offset and returns its subscriptions
+// and the offset of the next page, empty for the last page.
+func (c *registeryClient) lookupPage(ctx context.Context, jsonData []byte, offset int) ([]model.Subscription, string, error) {
+	lookupURL := fmt.Sprintf("%s/lookUp", c.Config.RegisteryURL)
+	if offset > 0 {
+		lookupURL += "?offset=" + strconv.Itoa(offset)
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, "POST", lookupURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	nonce := rand.Text()
+	req.Header.Set(model.LookupNonceHeader, nonce)
+	if len(c.Config.SubscriberID) != 0 {
+		authHeader, err := c.sign(ctx, jsonData)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to sign lookup request: %w", err)
+		}
+		req.Header.Set(model.AuthHeaderSubscriber, authHeader)
+	}
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request with retry: %w", err)
+		return nil, "", fmt.Errorf("failed to send request with retry: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("lookup request failed with status: %s", resp.Status)
+		return nil, "", fmt.Errorf("lookup request failed with status: %s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	next := resp.Header.Get(model.NextOffsetHeader)
+	if err := c.verify(ctx, model.LookupSigningPayload(nonce, next, body), resp.Header.Get(model.AuthHeaderSubscriber)); err != nil {
+		return nil, "", fmt.Errorf("failed to verify lookup response: %w", err)
 	}
 
 	var results []model.Subscription
-	err = json.Unmarshal(body, &results)
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	return results, next, nil
+}
+
+// signatureTTL returns the validity of the request signatures.
+func (c *registeryClient) signatureTTL() time.Duration {
+	if c.Config.SignatureTTL == 0 {
+		return lookupSignValidity
+	}
+	return c.Config.SignatureTTL
+}
+
+// sign returns the Authorization header for body, signed with the subscriber's current signing key.
+func (c *registeryClient) sign(ctx context.Context, body []byte) (string, error) {
+	now := time.Now()
+	createdAt := now.Unix()
+	validTill := now.Add(c.signatureTTL()).Unix()
+	if c.Config.RemoteSigner != nil {
+		signingString := authheader.SigningString(body, createdAt, validTill)
+		keyID, algorithm, sign, err := c.Config.RemoteSigner.Sign(ctx, c.Config.SubscriberID, []byte(signingString))
+		if err != nil {
+			return "", err
+		}
+		h := authheader.New(c.Config.SubscriberID, keyID, createdAt, validTill, sign)
+		h.Algorithm = algorithm
+		return h.String(), nil
+	}
+	if c.Config.Signer == nil || c.Config.KeyManager == nil {
+		return "", fmt.Errorf("signer or key manager not configured")
+	}
+	keyID, key, err := c.Config.KeyManager.SigningPrivateKey(ctx, c.Config.SubscriberID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+	sign, err := c.Config.Signer.Sign(ctx, body, key, createdAt, validTill)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+		return "", err
 	}
+	return authheader.New(c.Config.SubscriberID, keyID, createdAt, validTill, sign).String(), nil
+}
 
-	return results, nil
+// verify checks the registry's signature of a lookup response against the pinned registry key.
+// It fails closed: a missing signature or validator is an error when a key is pinned.
+func (c *registeryClient) verify(ctx context.Context, body []byte, authHeader string) error {
+	if len(c.Config.RegistryPublicKey) == 0 {
+		return nil
+	}
+	if c.Config.Validator == nil {
+		return fmt.Errorf("sign validator not configured")
+	}
+	if len(authHeader) == 0 {
+		return fmt.Errorf("%s missing", model.AuthHeaderSubscriber)
+	}
+	return c.Config.Validator.Validate(ctx, body, authHeader, c.Config.RegistryPublicKey)
 }
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/ashishGuliya/onix/pkg/model"
 	"github.com/ashishGuliya/onix/pkg/plugin"
 )
@@ -8,10 +10,14 @@ import (
 type HandlerType string
 
 const (
-	HandlerTypeStd    HandlerType = "std"
-	HandlerTypeRegSub HandlerType = "regSub"
-	HandlerTypeNPSub  HandlerType = "npSub"
-	HandlerTypeLookup HandlerType = "lookUp"
+	HandlerTypeStd      HandlerType = "std"
+	HandlerTypeRegSub   HandlerType = "regSub"
+	HandlerTypeNPSub    HandlerType = "npSub"
+	HandlerTypeNPOnSub  HandlerType = "npOnSub"
+	HandlerTypeLookup   HandlerType = "lookUp"
+	HandlerTypeConsumer HandlerType = "consumer"
+	HandlerTypeOutbox   HandlerType = "outbox"
+	HandlerTypeSync     HandlerType = "sync"
 )
 
 type pluginCfg struct {
@@ -19,9 +25,15 @@ type pluginCfg struct {
 	SignValidator   *plugin.Config  `yaml:"signValidator,omitempty"`
 	Publisher       *plugin.Config  `yaml:"publisher,omitempty"`
 	Signer          *plugin.Config  `yaml:"signer,omitempty"`
+	RemoteSigner    *plugin.Config  `yaml:"remoteSigner,omitempty"`
 	Router          *plugin.Config  `yaml:"router,omitempty"`
 	Cache           *plugin.Config  `yaml:"cache,omitempty"`
 	KeyManager      *plugin.Config  `yaml:"keyManager,omitempty"`
+	Encryptor       *plugin.Config  `yaml:"encryptor,omitempty"`
+	Decryptor       *plugin.Config  `yaml:"decryptor,omitempty"`
+	RegistryStore   *plugin.Config  `yaml:"registryStore,omitempty"`
+	Subscriber      *plugin.Config  `yaml:"subscriber,omitempty"`
+	Outbox          *plugin.Config  `yaml:"outbox,omitempty"`
 	Middleware      []plugin.Config `yaml:"middleware,omitempty"`
 	Steps           []plugin.Config
 }
@@ -34,4 +46,71 @@ type Config struct {
 	Role         model.Role
 	SubscriberID string `yaml:"subscriberId"`
 	Trace        map[string]bool
+	KeyRotation  *KeyRotationCfg `yaml:"keyRotation,omitempty"`
+	// SignLookups signs registry lookup requests with SubscriberID's signing key.
+	SignLookups bool `yaml:"signLookups"`
+	// RegistryPublicKey pins the registry's signing public key; lookup responses not signed with it are rejected.
+	RegistryPublicKey string `yaml:"registryPublicKey"`
+	// RegistryEncrPublicKey pins the registry's encryption public key; on_subscribe challenges not sealed with it are rejected.
+	RegistryEncrPublicKey string `yaml:"registryEncrPublicKey"`
+	// SignatureTTL is the validity of the signatures created by the module, 5 minutes when zero.
+	SignatureTTL time.Duration `yaml:"signatureTTL"`
+	// SignResponses signs the ACK/NACK bodies returned by the module in their Authorization header.
+	SignResponses bool `yaml:"signResponses"`
+	// ValidateResponses rejects the responses of proxied url routes without a valid signature.
+	ValidateResponses bool          `yaml:"validateResponses"`
+	Consumer          *ConsumerCfg  `yaml:"consumer,omitempty"`
+	Outbox            *OutboxCfg    `yaml:"outbox,omitempty"`
+	Sync              *SyncCfg      `yaml:"sync,omitempty"`
+	Transform         *TransformCfg `yaml:"transform,omitempty"`
+}
+
+// TransformCfg configures the mappings of the transform step and of the responses of url routes.
+type TransformCfg struct {
+	// MappingDir holds a mapping file per action, e.g. search.yaml, with request and response operations.
+	MappingDir string `yaml:"mappingDir"`
+}
+
+// SyncCfg configures how long the sync handler waits for the callbacks of a request.
+type SyncCfg struct {
+	// Timeout is how long callbacks are collected after the request was sent.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxResponses returns as soon as this many callbacks arrived, 0 always waits for the timeout.
+	MaxResponses int `yaml:"maxResponses"`
+}
+
+// OutboxCfg configures the delivery of requests held in the outbox, see the Outbox plugin.
+type OutboxCfg struct {
+	// MaxAttempts is the number of deliveries of a request before it is dead-lettered, 0 retries forever.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff is the wait before the first retry, doubled for every further retry up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// Workers is the number of requests delivered at once.
+	Workers int `yaml:"workers"`
+	// PollInterval is how often the outbox is checked for requests due for delivery.
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// DeadRetention is how long dead-lettered requests are kept, 7 days when zero.
+	DeadRetention time.Duration `yaml:"deadRetention"`
+}
+
+// ConsumerCfg configures the topic the consumer handler receives requests from.
+type ConsumerCfg struct {
+	// Topic is the topic, or subscription, to receive requests from.
+	Topic string `yaml:"topic"`
+	// MaxAttempts is the number of deliveries of a request before it is dead-lettered, 0 retries forever.
+	MaxAttempts int `yaml:"maxAttempts"`
+	// DeadLetterTopic receives the requests that failed MaxAttempts times, through the Publisher plugin.
+	DeadLetterTopic string `yaml:"deadLetterTopic"`
+	// SubscriberIDs are the subscribers a message may sign as with its subscriber_id attribute.
+	// Messages without the attribute are sent as the handler's subscriberId.
+	SubscriberIDs []string `yaml:"subscriberIds"`
+}
+
+// KeyRotationCfg configures key rotation for the npSub handler.
+type KeyRotationCfg struct {
+	// Interval between scheduled rotations of SubscriberID's keys, disabled when zero.
+	Interval time.Duration `yaml:"interval"`
+	// Grace is how long the previous keyset stays valid after a rotation.
+	Grace time.Duration `yaml:"grace"`
 }
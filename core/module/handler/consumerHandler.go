@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+)
+
+const (
+	// forwardTimeout bounds delivering a consumed request to its route.
+	forwardTimeout = 30 * time.Second
+	// resubscribeBackoff is the wait before subscribing again after the subscription failed.
+	resubscribeBackoff = 5 * time.Second
+)
+
+// consumerHandler receives requests from a topic, runs the configured steps on them and
+// forwards them to their route, so that backends can send requests through a queue.
+type consumerHandler struct {
+	std         *stdHandler
+	subscriber  definition.Subscriber
+	client      *http.Client
+	topic       string
+	maxAttempts int
+	deadLetter  string
+	// subscriberIDs are the subscribers messages may choose with their subscriber_id attribute.
+	subscriberIDs []string
+
+	// attempts counts the deliveries of messages whose broker does not track them.
+	mu       sync.Mutex
+	attempts map[string]int
+
+	processed    atomic.Int64
+	failed       atomic.Int64
+	deadLettered atomic.Int64
+}
+
+// NewConsumerHandler creates the consumer handler and starts receiving from its topic.
+func NewConsumerHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	cc := cfg.Consumer
+	if cc == nil || len(cc.Topic) == 0 {
+		return nil, fmt.Errorf("invalid config: consumer topic missing")
+	}
+	if cc.MaxAttempts < 0 {
+		return nil, fmt.Errorf("invalid config: consumer maxAttempts cannot be negative")
+	}
+	if cfg.Plugins.Subscriber == nil {
+		return nil, fmt.Errorf("invalid config: Subscriber missing")
+	}
+	std, err := newStdHandler(ctx, mgr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cc.DeadLetterTopic) != 0 && std.publisher == nil {
+		return nil, fmt.Errorf("invalid config: deadLetterTopic requires Publisher plugin")
+	}
+	h := &consumerHandler{
+		std:           std,
+		client:        &http.Client{Timeout: forwardTimeout},
+		topic:         cc.Topic,
+		maxAttempts:   cc.MaxAttempts,
+		deadLetter:    cc.DeadLetterTopic,
+		subscriberIDs: cc.SubscriberIDs,
+		attempts:      map[string]int{},
+	}
+	if h.subscriber, err = mgr.Subscriber(ctx, cfg.Plugins.Subscriber); err != nil {
+		return nil, fmt.Errorf("failed to load subscriber: %w", err)
+	}
+	go h.consume(context.WithoutCancel(ctx))
+	return h, nil
+}
+
+// consume subscribes to the topic, subscribing again after a failure, until the subscriber stops cleanly.
+func (h *consumerHandler) consume(ctx context.Context) {
+	for {
+		err := h.subscriber.Subscribe(ctx, h.topic, h.handle)
+		if err == nil {
+			log.Infof(ctx, "Stopped receiving from %s", h.topic)
+			return
+		}
+		log.Errorf(ctx, err, "Receiving from %s failed, retrying in %s", h.topic, resubscribeBackoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeBackoff):
+		}
+	}
+}
+
+// handle processes a message, returning an error to have it redelivered. Messages that
+// failed maxAttempts times, or that are invalid and would fail again, are published to the
+// dead-letter topic, or dropped without one.
+func (h *consumerHandler) handle(ctx context.Context, msg *definition.Message) error {
+	err := h.process(ctx, msg)
+	var badReqErr *model.BadReqErr
+	invalid := errors.As(err, &badReqErr)
+	attempt := h.attempt(msg, err == nil || invalid)
+	if err == nil {
+		h.processed.Add(1)
+		return nil
+	}
+	h.failed.Add(1)
+	log.Errorf(ctx, err, "Processing message %s from %s failed, attempt %d", msg.ID, h.topic, attempt)
+	if !invalid && (h.maxAttempts == 0 || attempt < h.maxAttempts) {
+		return err
+	}
+	if len(h.deadLetter) == 0 {
+		log.Errorf(ctx, err, "Dropping message %s after %d attempts", msg.ID, attempt)
+		return nil
+	}
+	if err := h.std.publisher.Publish(ctx, h.deadLetter, msg.Data); err != nil {
+		log.Errorf(ctx, err, "Failed to dead-letter message %s", msg.ID)
+		return err
+	}
+	h.deadLettered.Add(1)
+	log.Infof(ctx, "Dead-lettered message %s to %s after %d attempts", msg.ID, h.deadLetter, attempt)
+	return nil
+}
+
+// attempt returns the delivery attempt of msg, counting attempts locally when the broker does not.
+func (h *consumerHandler) attempt(msg *definition.Message, done bool) int {
+	if msg.Attempt > 0 {
+		return msg.Attempt
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	attempt := h.attempts[msg.ID] + 1
+	if done || (h.maxAttempts > 0 && attempt >= h.maxAttempts) {
+		delete(h.attempts, msg.ID)
+	} else {
+		h.attempts[msg.ID] = attempt
+	}
+	return attempt
+}
+
+// process runs the steps on the request in msg and forwards it to its route.
+func (h *consumerHandler) process(ctx context.Context, msg *definition.Message) error {
+	bc, err := parseContext(msg.Data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/"+bc.Action, bytes.NewReader(msg.Data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	subID := h.std.SubscriberID
+	if attr := msg.Attributes["subscriber_id"]; len(attr) != 0 {
+		if !slices.Contains(h.subscriberIDs, attr) {
+			return model.NewBadReqErr(fmt.Errorf("subscriber_id %s is not allowed", attr))
+		}
+		subID = attr
+	}
+	if len(subID) == 0 {
+		return model.NewBadReqErr(fmt.Errorf("subscriberID not set"))
+	}
+	stepCtx := &model.StepContext{
+		Context:    ctx,
+		Request:    req,
+		Body:       msg.Data,
+		Role:       h.std.role,
+		SubID:      subID,
+		RespHeader: http.Header{},
+	}
+	for _, step := range h.std.steps {
+		if err := step.Run(stepCtx); err != nil {
+			return fmt.Errorf("%T: %w", step, err)
+		}
+	}
+	if stepCtx.Route == nil {
+		return nil
+	}
+	return h.std.forward(stepCtx, h.client)
+}
+
+// ServeHTTP reports the message counters of the consumer.
+func (h *consumerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"topic":        h.topic,
+		"processed":    h.processed.Load(),
+		"failed":       h.failed.Load(),
+		"deadLettered": h.deadLettered.Load(),
+	})
+	if err != nil {
+		log.Errorf(r.Context(), err, "Error encoding JSON")
+	}
+}
@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/response"
+)
+
+const (
+	defaultOutboxBackoff       = 5 * time.Second
+	defaultOutboxMaxBackoff    = 10 * time.Minute
+	defaultOutboxWorkers       = 4
+	defaultOutboxPollInterval  = time.Second
+	defaultOutboxDeadRetention = 7 * 24 * time.Hour
+)
+
+// outboxDispatcher holds url routed requests in the outbox and delivers them in the
+// background, retrying with exponential backoff until they are acknowledged.
+type outboxDispatcher struct {
+	outbox definition.Outbox
+	cfg    OutboxCfg
+	client *http.Client
+	// sign signs a request again before every attempt, so that retries are not rejected
+	// for an expired signature. It is nil when the handler has no signing plugins.
+	sign definition.Step
+	role model.Role
+	// wake triggers a delivery round before the next poll.
+	wake chan struct{}
+}
+
+// newOutboxDispatcher creates the dispatcher of the handler's outbox and starts delivering.
+func newOutboxDispatcher(ctx context.Context, h *stdHandler, cfg *OutboxCfg) (*outboxDispatcher, error) {
+	d := &outboxDispatcher{
+		outbox: h.outbox,
+		client: &http.Client{Timeout: forwardTimeout},
+		role:   h.role,
+		wake:   make(chan struct{}, 1),
+	}
+	if cfg != nil {
+		d.cfg = *cfg
+	}
+	if d.cfg.MaxAttempts < 0 {
+		return nil, fmt.Errorf("invalid config: outbox maxAttempts cannot be negative")
+	}
+	if d.cfg.Backoff == 0 {
+		d.cfg.Backoff = defaultOutboxBackoff
+	}
+	if d.cfg.MaxBackoff == 0 {
+		d.cfg.MaxBackoff = defaultOutboxMaxBackoff
+	}
+	if d.cfg.Workers == 0 {
+		d.cfg.Workers = defaultOutboxWorkers
+	}
+	if d.cfg.PollInterval == 0 {
+		d.cfg.PollInterval = defaultOutboxPollInterval
+	}
+	if d.cfg.DeadRetention == 0 {
+		d.cfg.DeadRetention = defaultOutboxDeadRetention
+	}
+	if h.remoteSigner != nil || (h.signer != nil && h.km != nil) {
+		sign, err := newSignStep(h.signer, h.km, h.remoteSigner, h.signatureTTL)
+		if err != nil {
+			return nil, err
+		}
+		d.sign = sign
+	}
+	go d.run(context.WithoutCancel(ctx))
+	return d, nil
+}
+
+// enqueue stores the routed request in the outbox and acknowledges it. A request already in the
+// outbox for the same message_id, action and targets is acknowledged without being stored again.
+func (d *outboxDispatcher) enqueue(ctx *model.StepContext, w http.ResponseWriter) {
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		response.SendNack(ctx, w, err)
+		return
+	}
+	if len(bc.MessageID) == 0 {
+		response.SendNack(ctx, w, model.NewBadReqErrf("context.message_id missing"))
+		return
+	}
+	now := time.Now()
+	entry := &model.OutboxEntry{
+		MessageID:    bc.MessageID,
+		Action:       bc.Action,
+		SubscriberID: ctx.SubID,
+		Header:       ctx.Request.Header.Clone(),
+		Body:         ctx.Body,
+		Status:       model.OutboxStatusPending,
+		NextAttempt:  now,
+		Created:      now,
+		Updated:      now,
+	}
+	if len(ctx.Route.Targets) == 0 {
+		entry.URLs = []string{ctx.Route.URL.String()}
+	}
+	for _, t := range ctx.Route.Targets {
+		entry.URLs = append(entry.URLs, t.URL.String())
+		entry.Weights = append(entry.Weights, t.Weight)
+	}
+	entry.ID = outboxEntryID(entry)
+	added, err := d.outbox.Add(ctx, entry)
+	if err != nil {
+		log.Errorf(ctx, err, "Failed to add message %s to outbox", bc.MessageID)
+		response.SendNack(ctx, w, err)
+		return
+	}
+	if !added {
+		log.Infof(ctx, "Message %s for %s already in outbox as %s", bc.MessageID, bc.Action, entry.ID)
+	} else {
+		log.Infof(ctx, "Added message %s for %s to outbox as %s", bc.MessageID, bc.Action, entry.ID)
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	response.SendAck(w)
+}
+
+// outboxEntryID returns the id of entry, a digest of its message_id, action and urls.
+func outboxEntryID(entry *model.OutboxEntry) string {
+	h := sha256.New()
+	for _, s := range append([]string{entry.MessageID, entry.Action}, entry.URLs...) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// run delivers the due requests every poll interval, or when woken, until ctx is done.
+// Dead entries are purged once they are older than DeadRetention.
+func (d *outboxDispatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.purge(ctx)
+		case <-d.wake:
+		}
+		d.dispatch(ctx)
+	}
+}
+
+// purge removes the dead entries older than DeadRetention.
+func (d *outboxDispatcher) purge(ctx context.Context) {
+	n, err := d.outbox.Purge(ctx, time.Now().Add(-d.cfg.DeadRetention))
+	if err != nil {
+		log.Errorf(ctx, err, "Failed to purge dead outbox entries")
+		return
+	}
+	if n > 0 {
+		log.Infof(ctx, "Purged %d dead outbox entries", n)
+	}
+}
+
+// dispatch delivers the due requests, Workers at a time, until none are left.
+func (d *outboxDispatcher) dispatch(ctx context.Context) {
+	for {
+		entries, err := d.outbox.Due(ctx, time.Now(), d.cfg.Workers)
+		if err != nil {
+			log.Errorf(ctx, err, "Failed to read due outbox entries")
+			return
+		}
+		var wg sync.WaitGroup
+		for i := range entries {
+			wg.Add(1)
+			go func(entry *model.OutboxEntry) {
+				defer wg.Done()
+				d.attempt(ctx, entry)
+			}(&entries[i])
+		}
+		wg.Wait()
+		if len(entries) < d.cfg.Workers {
+			return
+		}
+	}
+}
+
+// attempt delivers entry, removing it from the outbox once acknowledged. Otherwise the retry is
+// scheduled after the backoff, or the entry is dead-lettered after MaxAttempts deliveries.
+func (d *outboxDispatcher) attempt(ctx context.Context, entry *model.OutboxEntry) {
+	err := d.send(ctx, entry)
+	if err == nil {
+		if err := d.outbox.Delete(ctx, entry.ID); err != nil {
+			log.Errorf(ctx, err, "Failed to remove delivered message %s from outbox", entry.MessageID)
+		}
+		return
+	}
+	now := time.Now()
+	entry.Attempts++
+	entry.LastError = err.Error()
+	entry.Updated = now
+	if d.cfg.MaxAttempts > 0 && entry.Attempts >= d.cfg.MaxAttempts {
+		entry.Status = model.OutboxStatusDead
+		log.Errorf(ctx, err, "Dead-lettering message %s after %d attempts", entry.MessageID, entry.Attempts)
+	} else {
+		entry.NextAttempt = now.Add(d.backoff(entry.Attempts))
+		log.Errorf(ctx, err, "Delivering message %s failed, attempt %d, retrying at %s", entry.MessageID, entry.Attempts, entry.NextAttempt)
+	}
+	if err := d.outbox.Update(ctx, entry); err != nil {
+		log.Errorf(ctx, err, "Failed to update message %s in outbox", entry.MessageID)
+	}
+}
+
+// backoff returns the wait before the retry following the given number of failed attempts.
+func (d *outboxDispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.cfg.MaxBackoff)
+}
+
+// send signs the request of entry again if it was signed and delivers it to its route.
+func (d *outboxDispatcher) send(ctx context.Context, entry *model.OutboxEntry) error {
+	route, err := outboxRoute(entry)
+	if err != nil {
+		return err
+	}
+	header := entry.Header.Clone()
+	if d.sign != nil && (len(header.Get(model.AuthHeaderSubscriber)) != 0 || len(header.Get(model.AuthHeaderGateway)) != 0) {
+		stepCtx := &model.StepContext{
+			Context: ctx,
+			Request: &http.Request{Header: header},
+			Body:    entry.Body,
+			SubID:   entry.SubscriberID,
+			Role:    d.role,
+		}
+		if err := d.sign.Run(stepCtx); err != nil {
+			return err
+		}
+	}
+	return upstreams.Load().deliver(ctx, d.client, route, header, entry.Body)
+}
+
+// outboxRoute returns the url route of entry.
+func outboxRoute(entry *model.OutboxEntry) (*model.Route, error) {
+	if len(entry.URLs) == 0 {
+		return nil, fmt.Errorf("outbox entry %s has no url", entry.MessageID)
+	}
+	route := &model.Route{Type: "url"}
+	for i, u := range entry.URLs {
+		target, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outbox url %s: %w", u, err)
+		}
+		if i == 0 {
+			route.URL = target
+		}
+		if len(entry.Weights) != 0 {
+			route.Targets = append(route.Targets, model.Target{URL: target, Weight: entry.Weights[i]})
+		}
+	}
+	return route, nil
+}
+
+// outboxHandler lists the requests held in an outbox.
+type outboxHandler struct {
+	outbox definition.Outbox
+	role   model.Role
+}
+
+// NewOutboxHandler creates the handler listing the dead-lettered requests of the Outbox plugin.
+func NewOutboxHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	if cfg.Plugins.Outbox == nil {
+		return nil, fmt.Errorf("invalid config: Outbox missing")
+	}
+	outbox, err := mgr.Outbox(ctx, cfg.Plugins.Outbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %w", err)
+	}
+	return &outboxHandler{outbox: outbox, role: cfg.Role}, nil
+}
+
+// redactedHeaders are the request headers whose values are not listed, as they carry credentials.
+var redactedHeaders = []string{model.AuthHeaderSubscriber, model.AuthHeaderGateway, "Proxy-Authorization", "Cookie"}
+
+// ServeHTTP returns the dead-lettered requests, or the requests with the status query parameter.
+// The values of credential headers are redacted.
+func (h *outboxHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "invalid request method, only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := model.OutboxStatusDead
+	if r.URL.Query().Has("status") {
+		status = r.URL.Query().Get("status")
+	}
+	entries, err := h.outbox.List(r.Context(), status)
+	if err != nil {
+		log.Errorf(r.Context(), err, "Failed to list outbox entries")
+		response.SendNack(&model.StepContext{Context: r.Context(), Request: r, Role: h.role}, w, err)
+		return
+	}
+	if entries == nil {
+		entries = []model.OutboxEntry{}
+	}
+	for i := range entries {
+		for _, name := range redactedHeaders {
+			if len(entries[i].Header.Values(name)) != 0 {
+				entries[i].Header.Set(name, "REDACTED")
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		log.Errorf(r.Context(), err, "Error encoding JSON")
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	d := &outboxDispatcher{cfg: OutboxCfg{Backoff: 5 * time.Second, MaxBackoff: time.Minute}}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 3, want: 20 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 5, want: time.Minute},
+		{attempts: 100, want: time.Minute},
+	}
+	for _, tt := range tests {
+		if got := d.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxEntryID(t *testing.T) {
+	base := model.OutboxEntry{MessageID: "msg-1", Action: "search", URLs: []string{"https://bpp1.example.com/search"}}
+	tests := []struct {
+		name   string
+		modify func(e *model.OutboxEntry)
+		same   bool
+	}{
+		{name: "same request", modify: func(e *model.OutboxEntry) { e.Header = http.Header{"X": {"y"}} }, same: true},
+		{name: "other action", modify: func(e *model.OutboxEntry) { e.Action = "on_search" }},
+		{name: "other target", modify: func(e *model.OutboxEntry) { e.URLs = []string{"https://bpp2.example.com/search"} }},
+		{name: "other message", modify: func(e *model.OutboxEntry) { e.MessageID = "msg-2" }},
+		{name: "fields not concatenated", modify: func(e *model.OutboxEntry) { e.MessageID, e.Action = "msg-1s", "earch" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			other.URLs = append([]string(nil), base.URLs...)
+			tt.modify(&other)
+			if got := outboxEntryID(&base) == outboxEntryID(&other); got != tt.same {
+				t.Errorf("ids equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+// listOutbox is an Outbox serving List from entries.
+type listOutbox struct {
+	entries []model.OutboxEntry
+}
+
+func (o *listOutbox) Add(context.Context, *model.OutboxEntry) (bool, error) { return false, nil }
+func (o *listOutbox) Due(context.Context, time.Time, int) ([]model.OutboxEntry, error) {
+	return nil, nil
+}
+func (o *listOutbox) Update(context.Context, *model.OutboxEntry) error { return nil }
+func (o *listOutbox) Delete(context.Context, string) error             { return nil }
+func (o *listOutbox) List(context.Context, string) ([]model.OutboxEntry, error) {
+	return o.entries, nil
+}
+func (o *listOutbox) Purge(context.Context, time.Time) (int, error) { return 0, nil }
+
+func TestOutboxHandlerRedactsCredentials(t *testing.T) {
+	h := &outboxHandler{outbox: &listOutbox{entries: []model.OutboxEntry{{
+		ID: "a",
+		Header: http.Header{
+			model.AuthHeaderSubscriber: {`Signature keyId="bap1|k1|ed25519"`},
+			model.AuthHeaderGateway:    {`Signature keyId="bg1|k1|ed25519"`},
+			"Content-Type":             {"application/json"},
+		},
+	}}}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var entries []model.OutboxEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil || len(entries) != 1 {
+		t.Fatalf("decoding response: %v, %d entries", err, len(entries))
+	}
+	header := entries[0].Header
+	for _, name := range []string{model.AuthHeaderSubscriber, model.AuthHeaderGateway} {
+		if got := header.Get(name); got != "REDACTED" {
+			t.Errorf("%s = %q, want REDACTED", name, got)
+		}
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if _, ok := header["Cookie"]; ok {
+		t.Error("absent Cookie header was added")
+	}
+}
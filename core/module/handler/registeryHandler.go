@@ -1,52 +1,123 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ashishGuliya/onix/pkg/authheader"
 	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/model"
 	"github.com/ashishGuliya/onix/pkg/plugin"
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/sealbox"
+)
+
+// lookupCacheTTL is how long a subscription read from the registry store stays in the cache.
+const lookupCacheTTL = time.Hour
+
+// defaultSubscriptionValidity is the validity of a subscription that does not set valid_until.
+// Lookups stop returning a subscription once it expired, so it must be renewed before.
+const defaultSubscriptionValidity = 365 * 24 * time.Hour
+
+const (
+	// challengeAttempts is the number of times the registry calls on_subscribe before giving up.
+	challengeAttempts = 3
+	// challengeBackoff is the wait before the first on_subscribe call, doubled on every retry.
+	challengeBackoff = time.Second
+	// challengeTimeout bounds a single on_subscribe call.
+	challengeTimeout = 10 * time.Second
 )
 
 // regSubscibeHandler encapsulates the subscription logic.
 type regSubscibeHandler struct {
+	store definition.RegistryStore
 	cache definition.Cache
+	// km holds the registry's keys, which seal the challenges and sign the on_subscribe requests.
+	km           definition.KeyManager
+	sign         *signStep
+	validator    definition.SignValidator
+	subscriberID string
+	client       *http.Client
 }
 
 // NewRegSubscibeHandler creates a new instance of SubscriptionService.
 func NewRegSubscibeHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
-	s := &regSubscibeHandler{}
+	s := &regSubscibeHandler{subscriberID: cfg.SubscriberID, client: &http.Client{Timeout: challengeTimeout}}
+	if len(s.subscriberID) == 0 {
+		return nil, fmt.Errorf("invalid config: subscriberId is required to sign on_subscribe requests")
+	}
+	var err error
 	// Initialize plugins
-	if err := s.initPlugins(ctx, mgr, &cfg.Plugins); err != nil {
+	if s.store, s.cache, err = loadRegistryPlugins(ctx, mgr, &cfg.Plugins); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
+	}
+	if err := s.initPlugins(ctx, mgr, &cfg.Plugins, cfg.SignatureTTL); err != nil {
 		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
 	}
 	return s, nil
 }
 
-// initPlugins initializes required plugins for the processor.
-func (p *regSubscibeHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg) error {
+// initPlugins loads the plugins used to verify subscribe requests and to challenge subscribers.
+func (s *regSubscibeHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg, ttl time.Duration) error {
+	if cfg.KeyManager == nil || cfg.Signer == nil || cfg.SignValidator == nil {
+		return fmt.Errorf("invalid config: KeyManager, Signer and SignValidator are required")
+	}
 	var err error
-	if cfg.Cache == nil {
-		return fmt.Errorf("invalid config: Cache missing")
+	if s.km, err = loadKeyManager(ctx, mgr, s.cache, storeLookup{store: s.store}, cfg.KeyManager); err != nil {
+		return err
 	}
-	if p.cache, err = mgr.Cache(ctx, cfg.Cache); err != nil {
-		return fmt.Errorf("failed to load cache: %w", err)
+	signer, err := loadPlugin(ctx, "Signer", cfg.Signer, mgr.Signer)
+	if err != nil {
+		return err
 	}
-	return nil
+	if s.sign, err = newSignStep(signer, s.km, nil, ttl); err != nil {
+		return err
+	}
+	s.validator, err = loadPlugin(ctx, "SignValidator", cfg.SignValidator, mgr.SignValidator)
+	return err
+}
+
+// loadRegistryPlugins loads the registry store and the optional cache placed in front of it.
+func loadRegistryPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg) (definition.RegistryStore, definition.Cache, error) {
+	if cfg.RegistryStore == nil {
+		return nil, nil, fmt.Errorf("invalid config: RegistryStore missing")
+	}
+	store, err := mgr.RegistryStore(ctx, cfg.RegistryStore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load registry store: %w", err)
+	}
+	cache, err := loadPlugin(ctx, "Cache", cfg.Cache, mgr.Cache)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, cache, nil
 }
 
 // SubscribeHandler processes subscription requests.
 func (s *regSubscibeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Debug(r.Context(), "Reg Subscribe handler called.")
 	// Parse request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
 	var req model.Subscription
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		log.Errorf(r.Context(), err, "Reg Subscribe handler: Bad Request")
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
@@ -57,9 +128,20 @@ func (s *regSubscibeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := s.validate(r.Context(), body, r.Header.Get(model.AuthHeaderSubscriber), &req); err != nil {
+		log.Errorf(r.Context(), err, "Subscribe request signature validation failed")
+		w.Header().Set(model.UnaAuthorizedHeaderSubscriber, authheader.Challenge(""))
+		http.Error(w, "invalid subscribe request signature", http.StatusUnauthorized)
+		return
+	}
 
 	// Process subscription
-	if err := s.subscribe(&req); err != nil {
+	if err := s.subscribe(r.Context(), &req); err != nil {
+		if errors.Is(err, errSubscriptionConflict) {
+			log.Errorf(r.Context(), err, "Reg Subscribe handler: Conflict")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		log.Errorf(r.Context(), err, "failed to process subscription")
 		http.Error(w, "failed to process subscription", http.StatusInternalServerError)
 		return
@@ -84,95 +166,549 @@ func validateSubscriptionReq(req *model.Subscription) error {
 	if req.URL == "" {
 		return errors.New("missing URL")
 	}
+	if req.SubscriberID == "" || req.KeyID == "" {
+		return errors.New("missing subscriber_id or key_id")
+	}
+	// The subscriber_id is the domain of the subscriber, so the challenge proves control of it.
+	subURL, err := url.Parse(req.URL)
+	if err != nil || (subURL.Scheme != "http" && subURL.Scheme != "https") {
+		return fmt.Errorf("invalid URL %s", req.URL)
+	}
+	if !strings.EqualFold(subURL.Hostname(), req.SubscriberID) {
+		return fmt.Errorf("URL host %s does not match subscriber_id %s", subURL.Hostname(), req.SubscriberID)
+	}
+	if req.RequestID == "" {
+		return errors.New("missing request_id")
+	}
 	return nil
 }
 
-// subscribe processes the subscription logic and stores it in the cache.
-func (s *regSubscibeHandler) subscribe(req *model.Subscription) error {
+// validate checks that the subscribe request is signed with the signing key it subscribes,
+// proving that the subscriber holds its private key.
+func (s *regSubscibeHandler) validate(ctx context.Context, body []byte, authHeader string, req *model.Subscription) error {
+	if len(authHeader) == 0 {
+		return fmt.Errorf("%s missing", model.AuthHeaderSubscriber)
+	}
+	header, err := authheader.Parse(authHeader)
+	if err != nil {
+		return err
+	}
+	if header.SubscriberID != req.SubscriberID || header.UniqueKeyID != req.KeyID {
+		return fmt.Errorf("signed by %s|%s, not by the subscribed key %s|%s", header.SubscriberID, header.UniqueKeyID, req.SubscriberID, req.KeyID)
+	}
+	return s.validator.Validate(ctx, body, authHeader, req.SigningPublicKey)
+}
+
+// subscribe creates or updates the subscription in the registry store as INITIATED
+// and starts verifying it with an on_subscribe challenge. A subscribe request for an active
+// subscription with unchanged keys and url renews it until the requested valid_until instead,
+// which is how subscribers publish the grace period of a rotated key.
+func (s *regSubscibeHandler) subscribe(ctx context.Context, req *model.Subscription) error {
+	now := time.Now()
 	subscription := &model.Subscription{
 		Subscriber:       req.Subscriber,
 		SigningPublicKey: req.SigningPublicKey,
 		EncrPublicKey:    req.EncrPublicKey,
 		KeyID:            req.KeyID,
-		Status:           "UNDER_SUBSCRIPTION",
-		ValidFrom:        time.Now(),
-		ValidUntil:       time.Now().Add(48 * time.Hour),
-		Created:          time.Now(),
-		Updated:          time.Now(),
+		RequestID:        req.RequestID,
+		Status:           model.SubscriptionStatusInitiated,
+		ValidFrom:        now,
+		ValidUntil:       now.Add(defaultSubscriptionValidity),
+		Created:          now,
+		Updated:          now,
+	}
+	if req.ValidUntil.After(now) {
+		subscription.ValidUntil = req.ValidUntil
+	}
+	renewed, err := s.checkConflict(ctx, subscription, now)
+	if err != nil {
+		return err
+	}
+	if renewed != nil {
+		renewed.ValidUntil = subscription.ValidUntil
+		renewed.RequestID = req.RequestID
+		renewed.Updated = now
+		if err := s.store.Update(ctx, renewed); err != nil {
+			return fmt.Errorf("failed to store subscription: %w", err)
+		}
+		s.evict(ctx, renewed)
+		return nil
+	}
+
+	existing, err := s.store.Get(ctx, req.SubscriberID, req.KeyID)
+	var notFoundErr *model.NotFoundErr
+	switch {
+	case err == nil:
+		subscription.Created = existing.Created
+		err = s.store.Update(ctx, subscription)
+	case errors.As(err, &notFoundErr):
+		err = s.store.Create(ctx, subscription)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store subscription: %w", err)
 	}
+	s.evict(ctx, subscription)
+
+	// The subscriber stores its keys once subscribe returns, so the challenge is sent asynchronously.
+	go s.verify(context.WithoutCancel(ctx), subscription)
+	return nil
+}
 
-	// Store in cache
-	cacheKey := fmt.Sprintf("subscriber:%s", req.SubscriberID)
-	subscriptionData, err := json.Marshal(subscription)
+// checkConflict rejects a subscription that would replace an active subscription of the same
+// key, or add a key to an active subscriber from another url. Until its challenge succeeds, a
+// subscription is not served by lookups, and the challenge of a new key is sent to the url
+// the subscriber was verified at. It returns the active subscription that sub renews, if any.
+func (s *regSubscibeHandler) checkConflict(ctx context.Context, sub *model.Subscription, now time.Time) (*model.Subscription, error) {
+	subs, err := s.store.List(ctx, &model.Subscription{
+		Subscriber: model.Subscriber{SubscriberID: sub.SubscriberID},
+		Status:     model.SubscriptionStatusSubscribed,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal subscription data: %w", err)
+		return nil, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+	var renewed *model.Subscription
+	for i, existing := range subs {
+		if !active(&existing, now) {
+			continue
+		}
+		if existing.URL != sub.URL {
+			return nil, fmt.Errorf("%w: %s is subscribed with url %s", errSubscriptionConflict, sub.SubscriberID, existing.URL)
+		}
+		if existing.KeyID != sub.KeyID {
+			continue
+		}
+		if existing.SigningPublicKey != sub.SigningPublicKey || existing.EncrPublicKey != sub.EncrPublicKey {
+			return nil, fmt.Errorf("%w: key %s of %s is subscribed, subscribe with a new key_id", errSubscriptionConflict, sub.KeyID, sub.SubscriberID)
+		}
+		renewed = &subs[i]
 	}
-	return s.cache.Set(context.Background(), cacheKey, string(subscriptionData), 240*time.Hour) // Default 24hr TTL
+	return renewed, nil
+}
+
+// errSubscriptionConflict is returned for subscriptions rejected by checkConflict.
+var errSubscriptionConflict = errors.New("subscription conflicts with an active subscription")
+
+// active reports whether the subscription was verified and has not expired. Lookups only
+// return active subscriptions.
+func active(sub *model.Subscription, now time.Time) bool {
+	return sub.Status == model.SubscriptionStatusSubscribed && now.Before(sub.ValidUntil)
+}
+
+// activeSubscription returns the active subscription for the subscriber and key id, or the most
+// recently subscribed active subscription of the subscriber when keyID is empty.
+func activeSubscription(ctx context.Context, store definition.RegistryStore, subscriberID, keyID string) (*model.Subscription, error) {
+	now := time.Now()
+	if len(keyID) != 0 {
+		sub, err := store.Get(ctx, subscriberID, keyID)
+		if err != nil {
+			return nil, err
+		}
+		if !active(sub, now) {
+			return nil, model.NewNotFoundErrf("subscription not active: %s/%s", subscriberID, keyID)
+		}
+		return sub, nil
+	}
+	subs, err := store.List(ctx, &model.Subscription{
+		Subscriber: model.Subscriber{SubscriberID: subscriberID},
+		Status:     model.SubscriptionStatusSubscribed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var latest *model.Subscription
+	for i := range subs {
+		if active(&subs[i], now) && (latest == nil || subs[i].ValidFrom.After(latest.ValidFrom)) {
+			latest = &subs[i]
+		}
+	}
+	if latest == nil {
+		return nil, model.NewNotFoundErrf("no active subscription: %s", subscriberID)
+	}
+	return latest, nil
+}
+
+// verify challenges the subscriber and moves the subscription to SUBSCRIBED when it answers
+// correctly, to INVALID_SSL when its certificate cannot be verified, or back to INITIATED.
+func (s *regSubscibeHandler) verify(ctx context.Context, sub *model.Subscription) {
+	if err := s.setStatus(ctx, sub, model.SubscriptionStatusUnderSubscription); err != nil {
+		log.Errorf(ctx, err, "Failed to update subscription status of %s", sub.SubscriberID)
+		return
+	}
+	status := model.SubscriptionStatusInitiated
+	for attempt := 0; attempt < challengeAttempts; attempt++ {
+		time.Sleep(challengeBackoff << attempt)
+		err := s.challenge(ctx, sub)
+		if err == nil {
+			status = model.SubscriptionStatusSubscribed
+			break
+		}
+		log.Errorf(ctx, err, "on_subscribe challenge %d/%d for %s failed", attempt+1, challengeAttempts, sub.SubscriberID)
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			status = model.SubscriptionStatusInvalidSSL
+			break
+		}
+	}
+	if err := s.setStatus(ctx, sub, status); err != nil {
+		log.Errorf(ctx, err, "Failed to update subscription status of %s", sub.SubscriberID)
+		return
+	}
+	log.Infof(ctx, "Subscription of %s with key %s is %s", sub.SubscriberID, sub.KeyID, status)
+}
+
+// challenge sends a random challenge, sealed for the subscriber's encryption key with the
+// registry's encryption key, to its on_subscribe endpoint and checks the decrypted answer.
+// The request is signed by the registry, so that subscribers only answer the registry.
+func (s *regSubscibeHandler) challenge(ctx context.Context, sub *model.Subscription) error {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	answer := base64.StdEncoding.EncodeToString(nonce)
+	_, privateKey, err := s.km.EncrPrivateKey(ctx, s.subscriberID)
+	if err != nil {
+		return fmt.Errorf("failed to get registry encryption key: %w", err)
+	}
+	challenge, err := sealbox.Seal([]byte(answer), privateKey, sub.EncrPublicKey, sealbox.LabelChallenge)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt challenge: %w", err)
+	}
+	reqBody, err := json.Marshal(&model.OnSubscribeRequest{
+		SubscriberID: sub.SubscriberID,
+		KeyID:        sub.KeyID,
+		RequestID:    sub.RequestID,
+		Challenge:    challenge,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal challenge: %w", err)
+	}
+	now := time.Now()
+	authHeader, err := s.sign.sign(ctx, s.subscriberID, reqBody, now.Unix(), now.Add(s.sign.ttl).Unix())
+	if err != nil {
+		return fmt.Errorf("failed to sign challenge: %w", err)
+	}
+
+	target, err := url.JoinPath(sub.URL, "on_subscribe")
+	if err != nil {
+		return fmt.Errorf("invalid subscriber url %s: %w", sub.URL, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(model.AuthHeaderSubscriber, authHeader.String())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call on_subscribe: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("on_subscribe responded with status: %s", resp.Status)
+	}
+
+	var onSubResp model.OnSubscribeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&onSubResp); err != nil {
+		return fmt.Errorf("invalid on_subscribe response: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(onSubResp.Answer), []byte(answer)) != 1 {
+		return errors.New("on_subscribe answer does not match the challenge")
+	}
+	return nil
+}
+
+// setStatus updates the status of the stored subscription.
+func (s *regSubscibeHandler) setStatus(ctx context.Context, sub *model.Subscription, status string) error {
+	stored, err := s.store.Get(ctx, sub.SubscriberID, sub.KeyID)
+	if err != nil {
+		return err
+	}
+	stored.Status = status
+	stored.Updated = time.Now()
+	if err := s.store.Update(ctx, stored); err != nil {
+		return err
+	}
+	s.evict(ctx, stored)
+	return nil
+}
+
+// evict removes the cached lookups of the subscription.
+func (s *regSubscibeHandler) evict(ctx context.Context, sub *model.Subscription) {
+	if s.cache == nil {
+		return
+	}
+	for _, cacheKey := range []string{subscriptionKey(sub.SubscriberID, ""), subscriptionKey(sub.SubscriberID, sub.KeyID)} {
+		if err := s.cache.Delete(ctx, cacheKey); err != nil {
+			log.Errorf(ctx, err, "Failed to evict %s from cache", cacheKey)
+		}
+	}
+}
+
+// subscriptionKey returns the cache key for a subscriber, or for one of its keys when keyID is set.
+func subscriptionKey(subID, keyID string) string {
+	if len(keyID) == 0 {
+		return fmt.Sprintf("subscriber:%s", subID)
+	}
+	return fmt.Sprintf("subscriber:%s:%s", subID, keyID)
 }
 
 // lookUpHandler encapsulates the lookup logic.
 type lookUpHandler struct {
+	store definition.RegistryStore
 	cache definition.Cache
+	// sign signs lookup responses as subscriberID when configured.
+	sign         *signStep
+	subscriberID string
+	// validator verifies signed lookup requests when configured.
+	validator definition.SignValidator
 }
 
 // NewLookHandler creates a new instance of RegistryHandler.
 func NewLookHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
-	h := &lookUpHandler{}
-	if err := h.initPlugins(ctx, mgr, &cfg.Plugins); err != nil {
+	h := &lookUpHandler{subscriberID: cfg.SubscriberID}
+	var err error
+	if h.store, h.cache, err = loadRegistryPlugins(ctx, mgr, &cfg.Plugins); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
+	}
+	if err := h.initSigning(ctx, mgr, &cfg.Plugins, cfg.SignatureTTL); err != nil {
 		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
 	}
 	return h, nil
 }
 
-// initPlugins initializes required plugins for the processor.
-func (h *lookUpHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg) error {
+// initSigning loads the optional plugins used to sign lookup responses and to verify signed lookup
+// requests. Responses are signed with the RemoteSigner, or with the Signer and the KeyManager.
+func (h *lookUpHandler) initSigning(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg, ttl time.Duration) error {
 	var err error
-	if cfg.Cache == nil {
-		return fmt.Errorf("invalid config: Cache missing")
+	if h.validator, err = loadPlugin(ctx, "SignValidator", cfg.SignValidator, mgr.SignValidator); err != nil {
+		return err
 	}
-	if h.cache, err = mgr.Cache(ctx, cfg.Cache); err != nil {
-		return fmt.Errorf("failed to load cache: %w", err)
+	if cfg.Signer == nil && cfg.RemoteSigner == nil {
+		return nil
 	}
-	return nil
+	if len(h.subscriberID) == 0 {
+		return fmt.Errorf("invalid config: subscriberId is required to sign lookup responses")
+	}
+	remote, err := loadPlugin(ctx, "RemoteSigner", cfg.RemoteSigner, mgr.RemoteSigner)
+	if err != nil {
+		return err
+	}
+	var signer definition.Signer
+	var km definition.KeyManager
+	if remote == nil {
+		if cfg.KeyManager == nil || h.cache == nil {
+			return fmt.Errorf("invalid config: signing lookup responses requires RemoteSigner, or KeyManager and Cache plugins")
+		}
+		if signer, err = loadPlugin(ctx, "Signer", cfg.Signer, mgr.Signer); err != nil {
+			return err
+		}
+		if km, err = loadKeyManager(ctx, mgr, h.cache, storeLookup{store: h.store}, cfg.KeyManager); err != nil {
+			return err
+		}
+	}
+	h.sign, err = newSignStep(signer, km, remote, ttl)
+	return err
+}
+
+// storeLookup serves the registry's own key lookups from its store.
+type storeLookup struct {
+	store definition.RegistryStore
+}
+
+// Lookup returns the active subscription for the subscriber and key id of the request.
+func (l storeLookup) Lookup(ctx context.Context, req *model.Subscription) ([]model.Subscription, error) {
+	sub, err := activeSubscription(ctx, l.store, req.SubscriberID, req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	return []model.Subscription{*sub}, nil
 }
 
-// LookupHandler handles the lookup requests.
+// LookupHandler handles the lookup requests. Without a status filter only active subscriptions
+// are served; with one, the subscriptions in that status are served.
 func (h *lookUpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	log.Debug(r.Context(), "Reg Lookup handler called.")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate(r.Context(), body, r.Header.Get(model.AuthHeaderSubscriber)); err != nil {
+		log.Errorf(r.Context(), err, "Lookup request signature validation failed")
+		w.Header().Set(model.UnaAuthorizedHeaderSubscriber, authheader.Challenge(""))
+		http.Error(w, "invalid lookup request signature", http.StatusUnauthorized)
+		return
+	}
 	var req model.Subscription
-	err := json.NewDecoder(r.Body).Decode(&req)
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isKeyLookup(&req) {
+		h.serveKeyLookup(w, r, &req)
+		return
+	}
+
+	offset, limit, err := pagination(r.URL.Query())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	now := time.Now()
+	subs, err := h.store.List(r.Context(), &req)
+	if err != nil {
+		log.Errorf(r.Context(), err, "Lookup failed")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if len(req.Status) == 0 {
+		subs = slices.DeleteFunc(subs, func(sub model.Subscription) bool { return !active(&sub, now) })
+	}
+	w.Header().Set(totalCountHeader, strconv.Itoa(len(subs)))
+	if offset+limit < len(subs) {
+		w.Header().Set(model.NextOffsetHeader, strconv.Itoa(offset+limit))
+	}
+	subs = subs[min(offset, len(subs)):min(offset+limit, len(subs))]
+	h.writeSubscriptions(r.Context(), w, r, subs)
+}
 
-	ctx := context.Background()
+// validate verifies the signature of a signed lookup request against the key stored for its signer.
+// Unsigned requests are accepted, as signing lookups is optional for participants.
+func (h *lookUpHandler) validate(ctx context.Context, body []byte, authHeader string) error {
+	if h.validator == nil || len(authHeader) == 0 {
+		return nil
+	}
+	header, err := authheader.Parse(authHeader)
+	if err != nil {
+		return err
+	}
+	sub, err := h.lookup(ctx, &model.Subscription{Subscriber: model.Subscriber{SubscriberID: header.SubscriberID}, KeyID: header.UniqueKeyID})
+	if err != nil {
+		return fmt.Errorf("failed to get validation key: %w", err)
+	}
+	return h.validator.Validate(ctx, body, authHeader, sub.SigningPublicKey)
+}
 
-	// Use the SubscriberID as the cache key
-	cacheKey := fmt.Sprintf("subscriber:%s", req.SubscriberID)
+// isKeyLookup reports whether the request identifies a single subscriber key,
+// which is served through the cache rather than by listing the store.
+func isKeyLookup(req *model.Subscription) bool {
+	filter := req.Subscriber
+	filter.SubscriberID = ""
+	return len(req.SubscriberID) != 0 && filter == (model.Subscriber{}) && len(req.Status) == 0
+}
 
-	cachedValue, err := h.cache.Get(ctx, cacheKey)
+// serveKeyLookup responds with the subscription for the subscriber and key id of the request.
+func (h *lookUpHandler) serveKeyLookup(w http.ResponseWriter, r *http.Request, req *model.Subscription) {
+	subData, err := h.lookup(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Subscriber ID not found", http.StatusNotFound)
+		var notFoundErr *model.NotFoundErr
+		if errors.As(err, &notFoundErr) {
+			http.Error(w, "Subscriber ID not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf(r.Context(), err, "Lookup failed")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	h.writeSubscriptions(r.Context(), w, r, []model.Subscription{*subData})
+}
 
-	var subData model.Subscription
-	err = json.Unmarshal([]byte(cachedValue), &subData)
+// writeSubscriptions sends the subscriptions as a JSON array, signed by the registry when configured.
+// The signature covers the nonce of the request, see model.LookupSigningPayload.
+func (h *lookUpHandler) writeSubscriptions(ctx context.Context, w http.ResponseWriter, r *http.Request, subs []model.Subscription) {
+	if subs == nil {
+		subs = []model.Subscription{}
+	}
+	body, err := json.Marshal(subs)
 	if err != nil {
+		log.Errorf(ctx, err, "Error encoding JSON")
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Errorf(r.Context(), err, "Error unmarshaling cached data")
 		return
 	}
-
-	// Send the result as the response
+	if h.sign != nil {
+		authHeader, err := h.signResponse(ctx, model.LookupSigningPayload(r.Header.Get(model.LookupNonceHeader), w.Header().Get(model.NextOffsetHeader), body))
+		if err != nil {
+			log.Errorf(ctx, err, "Failed to sign lookup response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(model.AuthHeaderSubscriber, authHeader)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode([]model.Subscription{subData})
+	if _, err := w.Write(body); err != nil {
+		log.Errorf(ctx, err, "Error writing response")
+	}
+}
+
+// signResponse returns the Authorization header for the lookup response body, signed with the registry's signing key.
+func (h *lookUpHandler) signResponse(ctx context.Context, body []byte) (string, error) {
+	now := time.Now()
+	header, err := h.sign.sign(ctx, h.subscriberID, body, now.Unix(), now.Add(h.sign.ttl).Unix())
+	if err != nil {
+		return "", err
+	}
+	return header.String(), nil
+}
+
+const (
+	// defaultLookupLimit is the page size used when the request does not set a limit.
+	defaultLookupLimit = 100
+	// maxLookupLimit is the largest page size a request may ask for.
+	maxLookupLimit = 1000
+	// totalCountHeader carries the number of subscriptions matching the lookup before pagination.
+	// The offset of the next page is sent in model.NextOffsetHeader.
+	totalCountHeader = "X-Total-Count"
+)
+
+// pagination parses the offset and limit query parameters of a lookup request.
+func pagination(q url.Values) (int, int, error) {
+	offset, limit := 0, defaultLookupLimit
+	var err error
+	if v := q.Get("offset"); len(v) != 0 {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+	if v := q.Get("limit"); len(v) != 0 {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxLookupLimit {
+			return 0, 0, fmt.Errorf("invalid limit: %s, must be between 1 and %d", v, maxLookupLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// lookup reads the active subscription through the cache, falling back to the registry store.
+func (h *lookUpHandler) lookup(ctx context.Context, req *model.Subscription) (*model.Subscription, error) {
+	cacheKey := subscriptionKey(req.SubscriberID, req.KeyID)
+	if h.cache != nil {
+		if cached, err := h.cache.Get(ctx, cacheKey); err == nil {
+			var sub model.Subscription
+			err := json.Unmarshal([]byte(cached), &sub)
+			if err == nil && active(&sub, time.Now()) {
+				return &sub, nil
+			}
+			if err != nil {
+				log.Errorf(ctx, err, "Error unmarshaling cached data")
+			}
+		}
+	}
+
+	sub, err := activeSubscription(ctx, h.store, req.SubscriberID, req.KeyID)
 	if err != nil {
-		log.Errorf(r.Context(), err, "Error encoding JSON")
+		return nil, err
+	}
+
+	if h.cache != nil {
+		if data, err := json.Marshal(sub); err == nil {
+			if err := h.cache.Set(ctx, cacheKey, string(data), lookupCacheTTL); err != nil {
+				log.Errorf(ctx, err, "Failed to cache %s", cacheKey)
+			}
+		}
 	}
+	return sub, nil
 }
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/boltregistrystore"
+)
+
+func TestLookupServesActiveSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	store, closer, err := boltregistrystore.New(ctx, &boltregistrystore.Config{Path: filepath.Join(t.TempDir(), "registry.db")})
+	if err != nil {
+		t.Fatalf("boltregistrystore.New() error = %v", err)
+	}
+	defer closer()
+	now := time.Now()
+	for _, sub := range []model.Subscription{
+		{Subscriber: model.Subscriber{SubscriberID: "bap1", Type: "BAP"}, KeyID: "k1", Status: model.SubscriptionStatusSubscribed, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+		{Subscriber: model.Subscriber{SubscriberID: "bap1", Type: "BAP"}, KeyID: "k0", Status: model.SubscriptionStatusSubscribed, ValidFrom: now.Add(-2 * time.Hour), ValidUntil: now.Add(-time.Hour)},
+		{Subscriber: model.Subscriber{SubscriberID: "bap2", Type: "BAP"}, KeyID: "k1", Status: model.SubscriptionStatusInitiated, ValidFrom: now, ValidUntil: now.Add(time.Hour)},
+		{Subscriber: model.Subscriber{SubscriberID: "bap3", Type: "BAP"}, KeyID: "k1", Status: model.SubscriptionStatusUnderSubscription, ValidFrom: now, ValidUntil: now.Add(time.Hour)},
+		{Subscriber: model.Subscriber{SubscriberID: "bpp1", Type: "BPP"}, KeyID: "k1", Status: model.SubscriptionStatusSubscribed, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+	} {
+		if err := store.Create(ctx, &sub); err != nil {
+			t.Fatalf("Create(%s/%s) error = %v", sub.SubscriberID, sub.KeyID, err)
+		}
+	}
+	h := &lookUpHandler{store: store}
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		want       []string
+		wantNext   string
+	}{
+		{name: "key lookup of active key", body: `{"subscriber_id":"bap1","key_id":"k1"}`, wantStatus: http.StatusOK, want: []string{"bap1/k1"}},
+		{name: "key lookup without key id", body: `{"subscriber_id":"bap1"}`, wantStatus: http.StatusOK, want: []string{"bap1/k1"}},
+		{name: "key lookup of expired key", body: `{"subscriber_id":"bap1","key_id":"k0"}`, wantStatus: http.StatusNotFound},
+		{name: "key lookup of initiated subscription", body: `{"subscriber_id":"bap2","key_id":"k1"}`, wantStatus: http.StatusNotFound},
+		{name: "key lookup of unverified subscription", body: `{"subscriber_id":"bap3"}`, wantStatus: http.StatusNotFound},
+		{name: "filter by type", body: `{"type":"BAP"}`, wantStatus: http.StatusOK, want: []string{"bap1/k1"}},
+		{name: "all active", body: `{}`, wantStatus: http.StatusOK, want: []string{"bap1/k1", "bpp1/k1"}},
+		{name: "filter by status", body: `{"status":"INITIATED"}`, wantStatus: http.StatusOK, want: []string{"bap2/k1"}},
+		{name: "filter by subscribed status includes expired", body: `{"type":"BAP","status":"SUBSCRIBED"}`, wantStatus: http.StatusOK, want: []string{"bap1/k0", "bap1/k1"}},
+		{name: "first page", query: "?limit=1", body: `{}`, wantStatus: http.StatusOK, want: []string{"bap1/k1"}, wantNext: "1"},
+		{name: "last page", query: "?offset=1&limit=1", body: `{}`, wantStatus: http.StatusOK, want: []string{"bpp1/k1"}},
+		{name: "invalid limit", query: "?limit=-1", body: `{}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lookup"+tt.query, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var subs []model.Subscription
+			if err := json.Unmarshal(w.Body.Bytes(), &subs); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body, err)
+			}
+			got := []string{}
+			for _, sub := range subs {
+				got = append(got, sub.SubscriberID+"/"+sub.KeyID)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("subscriptions = %v, want %v", got, tt.want)
+			}
+			if next := w.Header().Get(model.NextOffsetHeader); next != tt.wantNext {
+				t.Errorf("%s = %q, want %q", model.NextOffsetHeader, next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestValidateSubscriptionReq(t *testing.T) {
+	valid := func(subscriberID, url string) *model.Subscription {
+		return &model.Subscription{
+			Subscriber:       model.Subscriber{SubscriberID: subscriberID, URL: url},
+			KeyID:            "k1",
+			SigningPublicKey: "c2lnbg==",
+			EncrPublicKey:    "ZW5jcg==",
+			RequestID:        "r1",
+		}
+	}
+	tests := []struct {
+		name    string
+		req     *model.Subscription
+		wantErr bool
+	}{
+		{name: "url of subscriber", req: valid("bap1.example.com", "https://bap1.example.com/beckn")},
+		{name: "url with port and other case", req: valid("bap1.example.com", "https://BAP1.example.com:8443/beckn")},
+		{name: "url of other host", req: valid("bap1.example.com", "https://attacker.example.com/beckn"), wantErr: true},
+		{name: "url of sub domain", req: valid("example.com", "https://bap1.example.com/beckn"), wantErr: true},
+		{name: "relative url", req: valid("bap1.example.com", "bap1.example.com/beckn"), wantErr: true},
+		{name: "missing key id", req: &model.Subscription{Subscriber: model.Subscriber{SubscriberID: "bap1.example.com", URL: "https://bap1.example.com"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSubscriptionReq(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("validateSubscriptionReq() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/authheader"
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+)
+
+// signingWriter buffers a response, so that its body can be signed before it is written.
+// It does not unwrap to the underlying ResponseWriter, so that http.ResponseController cannot
+// flush it, e.g. from a ReverseProxy, which would write the headers before the Authorization header.
+type signingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status, which is written with the signed body.
+func (w *signingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write buffers b.
+func (w *signingWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// responseSigner signs the ACK/NACK bodies returned by a module with the module's signing key,
+// in the Authorization header of the response.
+type responseSigner struct {
+	sign *signStep
+}
+
+// write signs the buffered response of w as subscriberID and writes it. A response that cannot
+// be signed is written unsigned, for the counterparty to reject.
+func (s *responseSigner) write(ctx context.Context, subscriberID string, w *signingWriter) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	body := w.body.Bytes()
+	now := time.Now()
+	authHeader, err := s.sign.sign(ctx, subscriberID, body, now.Unix(), now.Add(s.sign.ttl).Unix())
+	if err != nil {
+		log.Errorf(ctx, err, "Failed to sign response as %s", subscriberID)
+	} else {
+		w.Header().Set(model.AuthHeaderSubscriber, authHeader.String())
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		log.Errorf(ctx, err, "Error writing response")
+	}
+}
+
+// rejectedResponseErr is returned for an upstream response that is not returned to the
+// client, e.g. because its signature is missing or invalid.
+type rejectedResponseErr struct {
+	err error
+}
+
+func (e *rejectedResponseErr) Error() string {
+	return fmt.Sprintf("rejected upstream response: %v", e.err)
+}
+
+func (e *rejectedResponseErr) Unwrap() error {
+	return e.err
+}
+
+// responseValidator validates the signature of the ACK/NACK responses of upstreams,
+// before they are returned to the backend.
+type responseValidator struct {
+	validator definition.SignValidator
+	km        definition.KeyManager
+	registry  definition.RegistryLookup
+}
+
+// validate checks the Authorization header of resp against its body, with the public key
+// the signer registered, and that the signer is the receiver of the request in ctx: the bpp_id
+// of requests, the bap_id of callbacks, or a registered gateway for requests without bpp_id.
+// An X-Gateway-Authorization header of resp must be signed by a registered gateway too.
+// The body of resp is restored for the caller. Server errors are not validated, as they are
+// commonly returned by the infrastructure in front of the upstream.
+func (v *responseValidator) validate(ctx *model.StepContext, resp *http.Response) error {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read upstream response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		return &rejectedResponseErr{err: fmt.Errorf("failed to parse request context: %w", err)}
+	}
+	value := resp.Header.Get(model.AuthHeaderSubscriber)
+	if len(value) == 0 {
+		return &rejectedResponseErr{err: fmt.Errorf("%s missing", model.AuthHeaderSubscriber)}
+	}
+	header, err := v.validateHeader(ctx, body, value)
+	if err != nil {
+		return &rejectedResponseErr{err: err}
+	}
+	if receiver := bc.receiver(); len(receiver) != 0 {
+		if header.SubscriberID != receiver {
+			return &rejectedResponseErr{err: fmt.Errorf("%s signed by %s, not by the receiver %s", model.AuthHeaderSubscriber, header.SubscriberID, receiver)}
+		}
+	} else if err := lookupGateway(ctx, v.registry, header); err != nil {
+		return &rejectedResponseErr{err: err}
+	}
+	if gwValue := resp.Header.Get(model.AuthHeaderGateway); len(gwValue) != 0 {
+		gwHeader, err := v.validateHeader(ctx, body, gwValue)
+		if err != nil {
+			return &rejectedResponseErr{err: fmt.Errorf("failed to validate %s: %w", model.AuthHeaderGateway, err)}
+		}
+		if err := lookupGateway(ctx, v.registry, gwHeader); err != nil {
+			return &rejectedResponseErr{err: err}
+		}
+	}
+	log.Debugf(ctx, "Validated upstream response signed by %s", header.SubscriberID)
+	return nil
+}
+
+// validateHeader verifies the signature header value over body with the signer's public key,
+// returning the parsed header.
+func (v *responseValidator) validateHeader(ctx context.Context, body []byte, value string) (*authheader.Header, error) {
+	header, err := authheader.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	key, err := v.km.SigningPublicKey(ctx, header.SubscriberID, header.UniqueKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get validation key: %w", err)
+	}
+	if err := v.validator.Validate(ctx, body, value, key); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"time"
 
 	"github.com/ashishGuliya/onix/core/module/client"
 	"github.com/ashishGuliya/onix/pkg/log"
@@ -20,6 +22,7 @@ import (
 // stdHandler orchestrates the execution of defined processing steps.
 type stdHandler struct {
 	signer          definition.Signer
+	remoteSigner    definition.RemoteSigner
 	steps           []definition.Step
 	signValidator   definition.SignValidator
 	cache           definition.Cache
@@ -27,28 +30,86 @@ type stdHandler struct {
 	schemaValidator definition.SchemaValidator
 	router          definition.Router
 	publisher       definition.Publisher
+	registry        definition.RegistryLookup
+	encryptor       definition.Encryptor
+	decryptor       definition.Decryptor
+	outbox          definition.Outbox
+	dispatcher      *outboxDispatcher
+	respSigner      *responseSigner
+	respValidator   *responseValidator
+	transformer     *transformer
+	signatureTTL    time.Duration
 	SubscriberID    string
 	role            model.Role
 }
 
 // NewStdHandler initializes a new processor with plugins and steps.
 func NewStdHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	h, err := newStdHandler(ctx, mgr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// newStdHandler initializes the plugins and steps of a stdHandler.
+func newStdHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (*stdHandler, error) {
 	h := &stdHandler{
 		steps:        []definition.Step{},
 		SubscriberID: cfg.SubscriberID,
 		role:         cfg.Role,
+		signatureTTL: cfg.SignatureTTL,
 	}
 	// Initialize plugins
-	if err := h.initPlugins(ctx, mgr, &cfg.Plugins, cfg.RegistryURL); err != nil {
+	rCfg, err := registryClientCfg(cfg)
+	if err != nil {
 		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
 	}
+	if err := h.initPlugins(ctx, mgr, &cfg.Plugins, rCfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
+	}
+	if cfg.Transform != nil {
+		if h.transformer, err = newTransformer(cfg.Transform.MappingDir); err != nil {
+			return nil, fmt.Errorf("failed to initialize transform: %w", err)
+		}
+	}
 	// Initialize steps
 	if err := h.initSteps(ctx, mgr, cfg); err != nil {
 		return nil, fmt.Errorf("failed to initialize steps: %w", err)
 	}
+	if err := h.initResponseSigning(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Outbox != nil && h.outbox == nil {
+		return nil, fmt.Errorf("invalid config: outbox requires Outbox plugin")
+	}
+	if h.outbox != nil {
+		if h.dispatcher, err = newOutboxDispatcher(ctx, h, cfg.Outbox); err != nil {
+			return nil, err
+		}
+	}
 	return h, nil
 }
 
+// initResponseSigning sets up the signing of the responses returned by the handler and the
+// validation of the responses of upstreams, as required by cfg.
+func (h *stdHandler) initResponseSigning(cfg *Config) error {
+	if cfg.SignResponses {
+		sign, err := newSignStep(h.signer, h.km, h.remoteSigner, h.signatureTTL)
+		if err != nil {
+			return fmt.Errorf("failed to initialize response signing: %w", err)
+		}
+		h.respSigner = &responseSigner{sign: sign}
+	}
+	if cfg.ValidateResponses {
+		if h.signValidator == nil || h.km == nil {
+			return fmt.Errorf("invalid config: validateResponses requires SignValidator and KeyManager plugins")
+		}
+		h.respValidator = &responseValidator{validator: h.signValidator, km: h.km, registry: h.registry}
+	}
+	return nil
+}
+
 //	func(h *stdHandler)InitTracing(ctx context.Context, trace map[string]bool){
 //		for id,s:= range h.steps{
 //			if trace[id]
@@ -57,13 +118,25 @@ func NewStdHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.
 //
 // Process executes defined processing steps on an incoming request.
 func (h *stdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.respSigner != nil {
+		sw := &signingWriter{ResponseWriter: w}
+		defer h.respSigner.write(r.Context(), h.subID(r.Context()), sw)
+		w = sw
+	}
 	ctx, err := h.stepCtx(r, w.Header())
 	if err != nil {
 		log.Errorf(r.Context(), err, "stepCtx(r):%v", err)
-		response.SendNack(r.Context(), w, err)
+		response.SendNack(ctx, w, err)
 		return
 	}
 	log.Request(r.Context(), r, ctx.Body)
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
+	defer func() {
+		if sw.status >= http.StatusBadRequest {
+			undo(ctx)
+		}
+	}()
 
 	// Execute processing steps
 	for _, step := range h.steps {
@@ -75,34 +148,97 @@ func (h *stdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	// Restore request body before forwarding or publishing
 	r.Body = io.NopCloser(bytes.NewReader(ctx.Body))
+	r.ContentLength = int64(len(ctx.Body))
 	if ctx.Route == nil {
 		response.SendAck(w)
 		return
 	}
+	// Hold url routed requests in the outbox and deliver them in the background
+	if h.dispatcher != nil && ctx.Route.Type == "url" {
+		h.dispatcher.enqueue(ctx, w)
+		return
+	}
 
 	// Handle routing based on the defined route type
-	route(ctx, r, w, h.publisher)
+	route(ctx, r, w, h.publisher, h.modifyResponse(ctx))
 }
 
-func (h *stdHandler) stepCtx(r *http.Request, rh http.Header) (*model.StepContext, error) {
-	var bodyBuffer bytes.Buffer
-	if _, err := io.Copy(&bodyBuffer, r.Body); err != nil {
-		return nil, model.NewBadReqErr(err)
+// statusWriter records the status of the response written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
 	}
-	r.Body.Close()
-	subID := h.subID(r.Context())
-	if len(subID) == 0 {
-		return nil, model.NewBadReqErr(fmt.Errorf("subscriberID not set"))
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// undo reverts the effects of the steps run for a failed request, in reverse order. It runs
+// after the response was written, so it is not cancelled with the request.
+func undo(ctx *model.StepContext) {
+	c := context.WithoutCancel(ctx.Context)
+	for i := len(ctx.Undo) - 1; i >= 0; i-- {
+		ctx.Undo[i](c)
+	}
+}
+
+// modifyResponse returns the function validating and then transforming the responses of url
+// routes, or nil when neither is configured.
+func (h *stdHandler) modifyResponse(ctx *model.StepContext) func(*http.Response) error {
+	if h.respValidator == nil && h.transformer == nil {
+		return nil
+	}
+	action := requestAction(ctx)
+	return func(resp *http.Response) error {
+		if h.respValidator != nil {
+			if err := h.respValidator.validate(ctx, resp); err != nil {
+				return err
+			}
+		}
+		if h.transformer != nil {
+			return h.transformer.response(action, resp)
+		}
+		return nil
 	}
-	return &model.StepContext{
+}
+
+// stepCtx reads the request into a StepContext. On failure it returns the StepContext read so
+// far along with the error, so that the NACK carries the role of the handler.
+func (h *stdHandler) stepCtx(r *http.Request, rh http.Header) (*model.StepContext, error) {
+	ctx := &model.StepContext{
 		Context:    r.Context(),
 		Request:    r,
-		Body:       bodyBuffer.Bytes(),
 		Role:       h.role,
-		SubID:      subID,
 		RespHeader: rh,
-	}, nil
+	}
+	var bodyBuffer bytes.Buffer
+	if _, err := io.Copy(&bodyBuffer, r.Body); err != nil {
+		return ctx, model.NewBadReqErr(err)
+	}
+	r.Body.Close()
+	ctx.Body = bodyBuffer.Bytes()
+	ctx.SubID = h.subID(r.Context())
+	if len(ctx.SubID) == 0 {
+		return ctx, model.NewBadReqErr(fmt.Errorf("subscriberID not set"))
+	}
+	return ctx, nil
 }
+
 func (h *stdHandler) subID(ctx context.Context) string {
 	rSubID, ok := ctx.Value("subscriber_id").(string)
 	if ok {
@@ -111,17 +247,23 @@ func (h *stdHandler) subID(ctx context.Context) string {
 	return h.SubscriberID
 }
 
-func route(ctx *model.StepContext, r *http.Request, w http.ResponseWriter, pb definition.Publisher) {
+// route forwards the request to ctx.Route, passing the responses of url routes through modify when it is set.
+func route(ctx *model.StepContext, r *http.Request, w http.ResponseWriter, pb definition.Publisher, modify func(*http.Response) error) {
 	log.Debugf(ctx, "Routing to ctx.Route to %#v", ctx.Route)
 	switch ctx.Route.Type {
 	case "url":
+		if len(ctx.Route.Targets) != 0 {
+			log.Infof(ctx.Context, "Forwarding request to one of %d targets", len(ctx.Route.Targets))
+			upstreams.Load().proxy(w, r, ctx.Body, ctx.Route.Targets, modify)
+			return
+		}
 		log.Infof(ctx.Context, "Forwarding request to URL: %s", ctx.Route.URL)
-		proxy(r, w, ctx.Route.URL)
+		proxy(r, w, ctx.Route.URL, modify)
 		return
 	case "publisher":
 		if pb == nil {
 			err := fmt.Errorf("publisher plugin not configured")
-			log.Errorf(ctx.Context, err, "Invalid configuration:%w", err)
+			log.Errorf(ctx.Context, err, "Invalid configuration:%v", err)
 			response.SendNack(ctx, w, err)
 			return
 		}
@@ -134,21 +276,39 @@ func route(ctx *model.StepContext, r *http.Request, w http.ResponseWriter, pb de
 		}
 	default:
 		err := fmt.Errorf("unknown route type: %s", ctx.Route.Type)
-		log.Errorf(ctx.Context, err, "Invalid configuration:%w", err)
+		log.Errorf(ctx.Context, err, "Invalid configuration:%v", err)
 		response.SendNack(ctx, w, err)
 		return
 	}
 	response.SendAck(w)
 }
 
-// proxy forwards the request to a target URL using a reverse proxy.
-func proxy(r *http.Request, w http.ResponseWriter, target *url.URL) {
+// forward delivers the request to its route with client and checks that it was acknowledged,
+// failing over between weighted targets.
+func (h *stdHandler) forward(ctx *model.StepContext, client *http.Client) error {
+	switch ctx.Route.Type {
+	case "url":
+		return upstreams.Load().deliver(ctx, client, ctx.Route, ctx.Request.Header, ctx.Body)
+	case "publisher":
+		if h.publisher == nil {
+			return fmt.Errorf("publisher plugin not configured")
+		}
+		return h.publisher.Publish(ctx, ctx.Route.Publisher, ctx.Body)
+	default:
+		return fmt.Errorf("unknown route type: %s", ctx.Route.Type)
+	}
+}
+
+// proxy forwards the request to a target URL using a reverse proxy. A response that fails
+// modify is replaced by a 502 Bad Gateway.
+func proxy(r *http.Request, w http.ResponseWriter, target *url.URL, modify func(*http.Response) error) {
 	r.URL.Scheme = target.Scheme
 	r.URL.Host = target.Host
 	r.URL.Path = target.Path
 
 	r.Header.Set("X-Forwarded-Host", r.Host)
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = modify
 	log.Infof(r.Context(), "Proxying request to: %s", target)
 
 	proxy.ServeHTTP(w, r)
@@ -171,7 +331,7 @@ func loadPlugin[T any](ctx context.Context, name string, cfg *plugin.Config, mgr
 	return plugin, nil
 }
 
-func loadKeyManager(ctx context.Context, mgr *plugin.Manager, cache definition.Cache, cfg *plugin.Config, regURL string) (definition.KeyManager, error) {
+func loadKeyManager(ctx context.Context, mgr *plugin.Manager, cache definition.Cache, rClient definition.RegistryLookup, cfg *plugin.Config) (definition.KeyManager, error) {
 	if cfg == nil {
 		log.Debug(ctx, "Skipping KeyManager plugin: not configured")
 		return nil, nil
@@ -179,7 +339,6 @@ func loadKeyManager(ctx context.Context, mgr *plugin.Manager, cache definition.C
 	if cache == nil {
 		return nil, fmt.Errorf("failed to load KeyManager plugin (%s): Cache plugin not configured", cfg.ID)
 	}
-	rClient := client.NewRegisteryClient(&client.Config{RegisteryURL: regURL})
 	km, err := mgr.KeyManager(ctx, cache, rClient, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load cache plugin (%s): %w", cfg.ID, err)
@@ -190,12 +349,13 @@ func loadKeyManager(ctx context.Context, mgr *plugin.Manager, cache definition.C
 }
 
 // initPlugins initializes required plugins for the processor.
-func (p *stdHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg, regURL string) error {
+func (p *stdHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg, rCfg *client.Config) error {
 	var err error
+	p.registry = client.NewRegisteryClient(rCfg)
 	if p.cache, err = loadPlugin(ctx, "Cache", cfg.Cache, mgr.Cache); err != nil {
 		return err
 	}
-	if p.km, err = loadKeyManager(ctx, mgr, p.cache, cfg.KeyManager, regURL); err != nil {
+	if p.km, err = loadKeyManager(ctx, mgr, p.cache, p.registry, cfg.KeyManager); err != nil {
 		return err
 	}
 	if p.signValidator, err = loadPlugin(ctx, "SignValidator", cfg.SignValidator, mgr.SignValidator); err != nil {
@@ -213,11 +373,56 @@ func (p *stdHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *
 	if p.signer, err = loadPlugin(ctx, "Signer", cfg.Signer, mgr.Signer); err != nil {
 		return err
 	}
+	if p.remoteSigner, err = loadPlugin(ctx, "RemoteSigner", cfg.RemoteSigner, mgr.RemoteSigner); err != nil {
+		return err
+	}
+	if p.encryptor, err = loadPlugin(ctx, "Encryptor", cfg.Encryptor, mgr.Encryptor); err != nil {
+		return err
+	}
+	if p.decryptor, err = loadPlugin(ctx, "Decryptor", cfg.Decryptor, mgr.Decryptor); err != nil {
+		return err
+	}
+	if p.outbox, err = loadPlugin(ctx, "Outbox", cfg.Outbox, mgr.Outbox); err != nil {
+		return err
+	}
+	if err := secureRegistryClient(rCfg, p.signer, p.km, p.remoteSigner, p.signValidator); err != nil {
+		return err
+	}
 
 	log.Debugf(ctx, "All required plugins successfully loaded for stdHandler")
 	return nil
 }
 
+// registryClientCfg returns the registry client config for the handler config.
+func registryClientCfg(cfg *Config) (*client.Config, error) {
+	rCfg := &client.Config{RegisteryURL: cfg.RegistryURL, RegistryPublicKey: cfg.RegistryPublicKey, SignatureTTL: cfg.SignatureTTL}
+	if cfg.SignLookups {
+		if len(cfg.SubscriberID) == 0 {
+			return nil, fmt.Errorf("invalid config: subscriberId is required to sign lookups")
+		}
+		rCfg.SubscriberID = cfg.SubscriberID
+	}
+	return rCfg, nil
+}
+
+// secureRegistryClient sets the plugins the registry client uses to sign lookup requests
+// and to verify lookup responses, as required by its config.
+func secureRegistryClient(rCfg *client.Config, signer definition.Signer, km definition.KeyManager, remote definition.RemoteSigner, validator definition.SignValidator) error {
+	if len(rCfg.SubscriberID) != 0 {
+		if remote == nil && (signer == nil || km == nil) {
+			return fmt.Errorf("invalid config: signLookups requires RemoteSigner or Signer and KeyManager plugins")
+		}
+		rCfg.Signer, rCfg.KeyManager, rCfg.RemoteSigner = signer, km, remote
+	}
+	if len(rCfg.RegistryPublicKey) != 0 {
+		if validator == nil {
+			return fmt.Errorf("invalid config: registryPublicKey requires SignValidator plugin")
+		}
+		rCfg.Validator = validator
+	}
+	return nil
+}
+
 // initSteps initializes and validates processing steps for the processor.
 func (p *stdHandler) initSteps(ctx context.Context, mgr *plugin.Manager, cfg *Config) error {
 	steps := make(map[string]definition.Step)
@@ -232,21 +437,29 @@ func (p *stdHandler) initSteps(ctx context.Context, mgr *plugin.Manager, cfg *Co
 	}
 
 	// Register processing steps
-	for _, step := range cfg.Steps {
+	for i, step := range cfg.Steps {
 		var s definition.Step
 		var err error
 
 		switch step {
 		case "sign":
-			s, err = newSignStep(p.signer, p.km)
+			s, err = newSignStep(p.signer, p.km, p.remoteSigner, p.signatureTTL)
 		case "validateSign":
-			s, err = newValidateSignStep(p.signValidator, p.km)
+			s, err = newValidateSignStep(p.signValidator, p.km, p.cache, p.registry)
 		case "validateSchema":
 			s, err = newValidateSchemaStep(p.schemaValidator)
 		case "addRoute":
-			s, err = newRouteStep(p.router)
+			s, err = newRouteStep(p.router, p.registry)
+		case "encrypt":
+			s, err = newEncryptStep(p.encryptor, p.km, p.registry)
+		case "decrypt":
+			s, err = newDecryptStep(p.decryptor, p.km, p.registry)
 		case "broadcast":
-			s = &broadcastStep{}
+			s, err = newBroadcastStep(p.registry, p.signer, p.km, p.remoteSigner, p.signatureTTL)
+		case "bridge":
+			s, err = newBridgeStep(slices.Contains(cfg.Steps[:i], "validateSign"))
+		case "transform":
+			s, err = newTransformStep(p.transformer)
 		default:
 			if customStep, exists := steps[step]; exists {
 				s = customStep
@@ -1,11 +1,22 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ashishGuliya/onix/pkg/authheader"
 	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/model"
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
@@ -14,97 +25,231 @@ import (
 	"go.opentelemetry.io/otel/codes"
 )
 
+// defaultSignatureTTL is the validity of signatures when not configured.
+const defaultSignatureTTL = 5 * time.Minute
+
 // 🔹 Sign Step
 type signStep struct {
 	signer definition.Signer
 	km     definition.KeyManager
+	// remote, when set, signs instead of signer and km with keys that never leave it.
+	remote definition.RemoteSigner
+	ttl    time.Duration
 }
 
-// newSignStep creates and returns the sign step after validation
-func newSignStep(signer definition.Signer, km definition.KeyManager) (definition.Step, error) {
-	if signer == nil {
+// newSignStep creates and returns the sign step after validation, signing with a validity
+// of ttl, or of defaultSignatureTTL when ttl is zero. Signer and KeyManager are only
+// required when no RemoteSigner is configured.
+func newSignStep(signer definition.Signer, km definition.KeyManager, remote definition.RemoteSigner, ttl time.Duration) (*signStep, error) {
+	if remote == nil && signer == nil {
 		return nil, fmt.Errorf("invalid config: Signer plugin not configured")
 	}
-	if km == nil {
+	if remote == nil && km == nil {
 		return nil, fmt.Errorf("invalid config: KeyManager plugin not configured")
 	}
-
-	return &signStep{signer: signer, km: km}, nil
+	if ttl < 0 {
+		return nil, fmt.Errorf("invalid config: signatureTTL cannot be negative")
+	}
+	if ttl == 0 {
+		ttl = defaultSignatureTTL
+	}
+	return &signStep{signer: signer, km: km, remote: remote, ttl: ttl}, nil
 }
 
+// Run signs the request as ctx.SubID. A gateway counter-signs the request of the subscriber
+// it forwards, adding its own X-Gateway-Authorization and keeping the subscriber's Authorization.
 func (s *signStep) Run(ctx *model.StepContext) error {
-	keyID, key, err := s.km.SigningPrivateKey(ctx, ctx.SubID)
-	if err != nil {
-		return fmt.Errorf("failed to get signing key: %w", err)
-	}
-	createdAt := time.Now().Unix()
-	validTill := time.Now().Add(5 * time.Minute).Unix()
-	sign, err := s.signer.Sign(ctx, ctx.Body, key, createdAt, validTill)
-	if err != nil {
-		return fmt.Errorf("failed to sign request: %w", err)
-	}
-	authHeader := fmt.Sprintf("Signature keyId=\"%s|%s|ed25519\",algorithm=\"ed25519\",created=\"%d\",expires=\"%d\",headers=\"(created) (expires) digest\",signature=\"%s\"", ctx.SubID, keyID, createdAt, validTill, sign)
 	header := model.AuthHeaderSubscriber
 	if ctx.Role == model.RoleGateway {
+		if len(ctx.Request.Header.Get(model.AuthHeaderSubscriber)) == 0 {
+			return model.NewBadReqErrf("gateway can only counter-sign requests with %s", model.AuthHeaderSubscriber)
+		}
 		header = model.AuthHeaderGateway
 	}
-	ctx.Request.Header.Set(header, authHeader)
+	now := time.Now()
+	authHeader, err := s.sign(ctx, ctx.SubID, ctx.Body, now.Unix(), now.Add(s.ttl).Unix())
+	if err != nil {
+		return err
+	}
+	ctx.Request.Header.Set(header, authHeader.String())
 	return nil
 }
 
+// sign returns the signature header of body, signed as subscriberID.
+func (s *signStep) sign(ctx context.Context, subscriberID string, body []byte, createdAt, validTill int64) (*authheader.Header, error) {
+	if s.remote != nil {
+		signingString := authheader.SigningString(body, createdAt, validTill)
+		keyID, algorithm, sign, err := s.remote.Sign(ctx, subscriberID, []byte(signingString))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign: %w", err)
+		}
+		h := authheader.New(subscriberID, keyID, createdAt, validTill, sign)
+		h.Algorithm = algorithm
+		return h, nil
+	}
+	keyID, key, err := s.km.SigningPrivateKey(ctx, subscriberID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing key: %w", err)
+	}
+	sign, err := s.signer.Sign(ctx, body, key, createdAt, validTill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return authheader.New(subscriberID, keyID, createdAt, validTill, sign), nil
+}
+
 // 🔹 Validate Sign Step
 type validateSignStep struct {
 	validator definition.SignValidator
 	km        definition.KeyManager
+	// cache records the signatures received, to reject requests replayed while their signature is valid.
+	cache definition.Cache
+	// registry checks that the signer of X-Gateway-Authorization is a registered gateway.
+	registry definition.RegistryLookup
+	// replaySkew extends the time signatures are recorded for, see checkReplay.
+	replaySkew time.Duration
 }
 
 // newValidateSignStep creates and returns the validateSign step after validation
-func newValidateSignStep(signValidator definition.SignValidator, km definition.KeyManager) (definition.Step, error) {
+func newValidateSignStep(signValidator definition.SignValidator, km definition.KeyManager, cache definition.Cache, registry definition.RegistryLookup) (definition.Step, error) {
 	if signValidator == nil {
 		return nil, fmt.Errorf("invalid config: SignValidator plugin not configured")
 	}
 	if km == nil {
 		return nil, fmt.Errorf("invalid config: KeyManager plugin not configured")
 	}
-	return &validateSignStep{validator: signValidator, km: km}, nil
+	if cache == nil {
+		return nil, fmt.Errorf("invalid config: Cache plugin not configured")
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("invalid config: registry not configured")
+	}
+	replaySkew := defaultReplaySkew
+	if v, ok := signValidator.(definition.SkewTolerant); ok {
+		replaySkew = v.AllowedSkew()
+	}
+	return &validateSignStep{validator: signValidator, km: km, cache: cache, registry: registry, replaySkew: replaySkew}, nil
 }
 
+// Run validates the Authorization header of the request and, when the request came through a
+// gateway, its X-Gateway-Authorization header. A gateway hop is present when the request carries
+// X-Gateway-Authorization, and is required for the search requests a BPP receives without bpp_id,
+// which are broadcast by a gateway. A gateway rejects requests already signed by a gateway.
 func (s *validateSignStep) Run(ctx *model.StepContext) error {
-	unauthHeader := fmt.Sprintf("Signature realm=\"%s\",headers=\"(created) (expires) digest\"", ctx.SubID)
-	headerValue := ctx.Request.Header.Get(model.AuthHeaderGateway)
-	if len(headerValue) != 0 {
-		if err := s.validate(ctx, headerValue); err != nil {
+	unauthHeader := authheader.Challenge(ctx.SubID)
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		bc = &becknContext{}
+	}
+	gwValue := ctx.Request.Header.Get(model.AuthHeaderGateway)
+	switch {
+	case len(gwValue) != 0 && ctx.Role == model.RoleGateway:
+		return model.NewSignValidationErrf("%s not accepted by a gateway", model.AuthHeaderGateway)
+	case len(gwValue) == 0 && ctx.Role == model.RoleBPP && bc.Action == "search" && len(bc.BppID) == 0:
+		ctx.RespHeader.Set(model.UnaAuthorizedHeaderGateway, unauthHeader)
+		return model.NewSignValidationErrf("%s missing: search without bpp_id must be sent through a gateway", model.AuthHeaderGateway)
+	}
+	var gwHeader *authheader.Header
+	if len(gwValue) != 0 {
+		if gwHeader, err = s.validateGateway(ctx, gwValue); err != nil {
 			ctx.RespHeader.Set(model.UnaAuthorizedHeaderGateway, unauthHeader)
 			return model.NewSignValidationErrf("failed to validate %s: %w", model.AuthHeaderGateway, err)
 		}
 	}
-	headerValue = ctx.Request.Header.Get(model.AuthHeaderSubscriber)
+
+	headerValue := ctx.Request.Header.Get(model.AuthHeaderSubscriber)
 	if len(headerValue) == 0 {
 		ctx.RespHeader.Set(model.UnaAuthorizedHeaderSubscriber, unauthHeader)
-		return model.NewSignValidationErrf("%s missing", model.UnaAuthorizedHeaderSubscriber)
+		return model.NewSignValidationErrf("%s missing", model.AuthHeaderSubscriber)
 	}
-	if err := s.validate(ctx, headerValue); err != nil {
+	header, err := s.validate(ctx, headerValue)
+	if err != nil {
 		ctx.RespHeader.Set(model.UnaAuthorizedHeaderSubscriber, unauthHeader)
 		return model.NewSignValidationErrf("failed to validate %s: %w", model.AuthHeaderSubscriber, err)
 	}
-	return nil
+	if gwHeader != nil && header.SubscriberID != bc.sender() {
+		ctx.RespHeader.Set(model.UnaAuthorizedHeaderSubscriber, unauthHeader)
+		return model.NewSignValidationErrf("%s signed by %s, not by the sender %s of the message forwarded by gateway %s",
+			model.AuthHeaderSubscriber, header.SubscriberID, bc.sender(), gwHeader.SubscriberID)
+	}
+	return s.checkReplay(ctx, header)
+}
+
+// validateGateway validates the X-Gateway-Authorization header value, whose signer must be subscribed as a gateway.
+func (s *validateSignStep) validateGateway(ctx *model.StepContext, value string) (*authheader.Header, error) {
+	header, err := s.validate(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := lookupGateway(ctx, s.registry, header); err != nil {
+		return nil, err
+	}
+	return header, nil
 }
 
-func (s *validateSignStep) validate(ctx *model.StepContext, value string) error {
-	headerParts := strings.Split(value, "|")
-	ids := strings.Split(headerParts[0], "\"")
-	if len(ids) < 2 || len(headerParts) < 3 {
-		return fmt.Errorf("malformed sign header")
+// lookupGateway checks that the signer of header is subscribed as a gateway.
+func lookupGateway(ctx context.Context, registry definition.RegistryLookup, header *authheader.Header) error {
+	subs, err := registry.Lookup(ctx, &model.Subscription{
+		Subscriber: model.Subscriber{SubscriberID: header.SubscriberID, Type: "BG"},
+		KeyID:      header.UniqueKeyID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to lookup gateway %s: %w", header.SubscriberID, err)
+	}
+	for _, sub := range subs {
+		if sub.SubscriberID == header.SubscriberID && sub.Type == "BG" {
+			return nil
+		}
 	}
-	subID := ids[1]
-	keyID := headerParts[1]
-	key, err := s.km.SigningPublicKey(ctx, subID, keyID)
+	return fmt.Errorf("%s is not a registered gateway", header.SubscriberID)
+}
+
+// validate verifies the signature header value with the signer's public key, returning the parsed header.
+func (s *validateSignStep) validate(ctx *model.StepContext, value string) (*authheader.Header, error) {
+	header, err := authheader.Parse(value)
 	if err != nil {
-		return fmt.Errorf("failed to get validation key: %w", err)
+		return nil, err
+	}
+	key, err := s.km.SigningPublicKey(ctx, header.SubscriberID, header.UniqueKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get validation key: %w", err)
 	}
 	if err := s.validator.Validate(ctx, ctx.Body, value, key); err != nil {
-		return fmt.Errorf("sign validation failed: %w", err)
+		return nil, fmt.Errorf("sign validation failed: %w", err)
+	}
+	return header, nil
+}
+
+// defaultReplaySkew extends the time signatures are recorded for when the sign validator does not
+// report the clock skew it tolerates after a signature expired, see definition.SkewTolerant.
+const defaultReplaySkew = 5 * time.Minute
+
+// checkReplay records the validated signature of the request in the cache until it expires,
+// plus the clock skew the validator tolerates, keyed by receiver, signer, message_id and
+// signature digest, and rejects the request if the signature was already recorded. The record
+// is removed by ctx.Undo when the request fails.
+func (s *validateSignStep) checkReplay(ctx *model.StepContext, header *authheader.Header) error {
+	// A cache entry without TTL would never expire, so the signature is recorded for at least a second.
+	ttl := max(time.Until(time.Unix(header.Expires, 0))+s.replaySkew, time.Second)
+	var msgID string
+	if bc, err := parseContext(ctx.Body); err == nil {
+		msgID = bc.MessageID
+	}
+	digest := sha256.Sum256([]byte(header.Signature))
+	key := fmt.Sprintf("replay:%s:%s:%s:%s", ctx.SubID, header.SubscriberID, msgID, hex.EncodeToString(digest[:]))
+	stored, err := s.cache.SetIfAbsent(ctx, key, strconv.FormatInt(time.Now().Unix(), 10), ttl)
+	if err != nil {
+		return fmt.Errorf("failed to record signature: %w", err)
 	}
+	if !stored {
+		return model.NewReplayErrf("request with message_id %s from %s already received", msgID, header.SubscriberID)
+	}
+	// A request failing later on was not received, so that its retry is not rejected as a replay.
+	ctx.Undo = append(ctx.Undo, func(c context.Context) {
+		if err := s.cache.Delete(c, key); err != nil {
+			log.Errorf(c, err, "Failed to forget signature of message_id %s from %s", msgID, header.SubscriberID)
+		}
+	})
 	return nil
 }
 
@@ -131,15 +276,19 @@ func (s *validateSchemaStep) Run(ctx *model.StepContext) error {
 
 // 🔹 Get Route Step
 type addRouteStep struct {
-	router definition.Router
+	router   definition.Router
+	registry definition.RegistryLookup
 }
 
+// dynamicRouteType is the route type resolved from the request context and the registry.
+const dynamicRouteType = "dynamic"
+
 // newRouteStep creates and returns the addRoute step after validation
-func newRouteStep(router definition.Router) (definition.Step, error) {
+func newRouteStep(router definition.Router, registry definition.RegistryLookup) (definition.Step, error) {
 	if router == nil {
 		return nil, fmt.Errorf("invalid config: Router plugin not configured")
 	}
-	return &addRouteStep{router: router}, nil
+	return &addRouteStep{router: router, registry: registry}, nil
 }
 
 func (s *addRouteStep) Run(ctx *model.StepContext) error {
@@ -148,17 +297,475 @@ func (s *addRouteStep) Run(ctx *model.StepContext) error {
 		return fmt.Errorf("failed to determine route: %w", err)
 	}
 	log.Debugf(ctx, "Routing to %#v", route)
+	if route.Type == dynamicRouteType {
+		if route, err = s.resolve(ctx); err != nil {
+			return fmt.Errorf("failed to resolve dynamic route: %w", err)
+		}
+	}
 	ctx.Route = route
 
 	log.Debugf(ctx, "ctx.Route to %#v", ctx.Route)
 	return nil
 }
 
-// 🔹 Broadcast Step (Stub Implementation)
-type broadcastStep struct{}
+// resolve returns the URL route to the participant the request is addressed to: the BAP for
+// on_* actions and the BPP otherwise. The bap_uri or bpp_uri in the context is used when it
+// matches the URL registered for the participant, and the registered URL when it is absent.
+func (s *addRouteStep) resolve(ctx *model.StepContext) (*model.Route, error) {
+	if s.registry == nil {
+		return nil, fmt.Errorf("registry not configured")
+	}
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		return nil, err
+	}
+	id, uri := bc.BppID, bc.BppURI
+	if strings.HasPrefix(bc.Action, "on_") {
+		id, uri = bc.BapID, bc.BapURI
+	}
+	if len(id) == 0 {
+		return nil, model.NewBadReqErrf("receiver id missing in context for action: %s", bc.Action)
+	}
+	subs, err := s.registry.Lookup(ctx, &model.Subscription{Subscriber: model.Subscriber{SubscriberID: id}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", id, err)
+	}
+	subs = slices.DeleteFunc(subs, func(sub model.Subscription) bool { return sub.SubscriberID != id })
+	if len(subs) == 0 {
+		return nil, model.NewNotFoundErrf("subscriber %s not found in registry", id)
+	}
+
+	base := subs[0].URL
+	if len(uri) != 0 {
+		base = ""
+		for _, sub := range subs {
+			if sameURL(sub.URL, uri) {
+				base = uri
+				break
+			}
+		}
+		if len(base) == 0 {
+			return nil, model.NewBadReqErrf("%s does not match the registered url of %s", uri, id)
+		}
+	}
+	target, err := url.JoinPath(base, bc.Action)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscriber url %s: %w", base, err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse(%s): %w", target, err)
+	}
+	return &model.Route{Type: "url", URL: u}, nil
+}
+
+// sameURL reports whether a and b are the same URL, ignoring the case of the
+// scheme and host and a trailing slash.
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) &&
+		strings.TrimSuffix(ua.Path, "/") == strings.TrimSuffix(ub.Path, "/")
+}
+
+// becknContext holds the request context fields used by the steps.
+type becknContext struct {
+	Domain    string `json:"domain"`
+	Action    string `json:"action"`
+	MessageID string `json:"message_id"`
+	BapID     string `json:"bap_id"`
+	BapURI    string `json:"bap_uri"`
+	BppID     string `json:"bpp_id"`
+	BppURI    string `json:"bpp_uri"`
+	City      string `json:"city"`
+	Location  struct {
+		City struct {
+			Code string `json:"code"`
+		} `json:"city"`
+	} `json:"location"`
+}
+
+// city returns the city code, preferring context.location.city.code over context.city.
+func (c *becknContext) city() string {
+	if len(c.Location.City.Code) != 0 {
+		return c.Location.City.Code
+	}
+	return c.City
+}
 
+// counterparty returns the id of the other participant in the transaction for role.
+func (c *becknContext) counterparty(role model.Role) (string, error) {
+	var id string
+	switch role {
+	case model.RoleBAP:
+		id = c.BppID
+	case model.RoleBPP:
+		id = c.BapID
+	default:
+		return "", fmt.Errorf("no counterparty for role: %s", role)
+	}
+	if len(id) == 0 {
+		return "", model.NewBadReqErrf("counterparty id missing in context for role: %s", role)
+	}
+	return id, nil
+}
+
+// sender returns the id of the participant that sent the message: the BPP for on_* callbacks, else the BAP.
+func (c *becknContext) sender() string {
+	if strings.HasPrefix(c.Action, "on_") {
+		return c.BppID
+	}
+	return c.BapID
+}
+
+// receiver returns the id of the participant the message is sent to: the BAP for on_* callbacks,
+// else the BPP, which is empty for requests broadcast by a gateway.
+func (c *becknContext) receiver() string {
+	if strings.HasPrefix(c.Action, "on_") {
+		return c.BapID
+	}
+	return c.BppID
+}
+
+// parseContext extracts the context object from a Beckn request body.
+func parseContext(body []byte) (*becknContext, error) {
+	var req struct {
+		Context *becknContext `json:"context"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, model.NewBadReqErrf("invalid request body json: %w", err)
+	}
+	if req.Context == nil {
+		return nil, model.NewBadReqErrf("context field not found")
+	}
+	return req.Context, nil
+}
+
+// broadcastTimeout is the time allowed for a single subscriber to accept a broadcast request.
+const broadcastTimeout = 30 * time.Second
+
+// 🔹 Broadcast Step
+type broadcastStep struct {
+	registry definition.RegistryLookup
+	sign     definition.Step
+	client   *http.Client
+}
+
+// newBroadcastStep creates and returns the broadcast step after validation
+func newBroadcastStep(registry definition.RegistryLookup, signer definition.Signer, km definition.KeyManager, remote definition.RemoteSigner, ttl time.Duration) (definition.Step, error) {
+	if registry == nil {
+		return nil, fmt.Errorf("invalid config: registry not configured")
+	}
+	sign, err := newSignStep(signer, km, remote, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &broadcastStep{
+		registry: registry,
+		sign:     sign,
+		client:   &http.Client{Timeout: broadcastTimeout},
+	}, nil
+}
+
+// Run looks up all BPPs for the request domain and city, signs the request and
+// forwards it to each of them concurrently, recording the outcome in ctx.Deliveries.
 func (b *broadcastStep) Run(ctx *model.StepContext) error {
-	// TODO: Implement broadcast logic if needed
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		return err
+	}
+	subs, err := b.subscribers(ctx, bc)
+	if err != nil {
+		return err
+	}
+	if err := b.sign.Run(ctx); err != nil {
+		return err
+	}
+
+	ctx.Deliveries = make([]model.Delivery, len(subs))
+	var wg sync.WaitGroup
+	for i, sub := range subs {
+		wg.Add(1)
+		go func(i int, sub model.Subscription) {
+			defer wg.Done()
+			ctx.Deliveries[i] = b.deliver(ctx, &sub, bc.Action)
+		}(i, sub)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, d := range ctx.Deliveries {
+		if d.Err != nil {
+			failed++
+			log.Errorf(ctx, d.Err, "Broadcast to %s failed", d.SubscriberID)
+		}
+	}
+	if failed == len(ctx.Deliveries) {
+		return fmt.Errorf("broadcast failed for all %d subscribers", failed)
+	}
+	log.Infof(ctx, "Broadcast delivered to %d of %d subscribers", len(ctx.Deliveries)-failed, len(ctx.Deliveries))
+	return nil
+}
+
+// subscribers returns the unique BPPs registered for the domain and city of the request.
+func (b *broadcastStep) subscribers(ctx *model.StepContext, bc *becknContext) ([]model.Subscription, error) {
+	subs, err := b.registry.Lookup(ctx, &model.Subscription{
+		Subscriber: model.Subscriber{
+			Type:   "BPP",
+			Domain: bc.Domain,
+			City:   bc.city(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup subscribers: %w", err)
+	}
+	seen := make(map[string]bool)
+	var unique []model.Subscription
+	for _, sub := range subs {
+		if seen[sub.SubscriberID] || len(sub.URL) == 0 {
+			continue
+		}
+		seen[sub.SubscriberID] = true
+		unique = append(unique, sub)
+	}
+	if len(unique) == 0 {
+		return nil, model.NewNotFoundErrf("no subscribers found for domain: %s, city: %s", bc.Domain, bc.city())
+	}
+	return unique, nil
+}
+
+// deliver posts the signed request body to the subscriber's action endpoint, with the
+// Authorization and X-Gateway-Authorization headers set by the sign step.
+func (b *broadcastStep) deliver(ctx *model.StepContext, sub *model.Subscription, action string) model.Delivery {
+	d := model.Delivery{SubscriberID: sub.SubscriberID}
+	target, err := url.JoinPath(sub.URL, action)
+	if err != nil {
+		d.Err = fmt.Errorf("invalid subscriber url %s: %w", sub.URL, err)
+		return d
+	}
+	d.URL = target
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(ctx.Body))
+	if err != nil {
+		d.Err = fmt.Errorf("failed to create request: %w", err)
+		return d
+	}
+	// Only the signatures are forwarded, other headers of the request are not meant for subscribers.
+	req.Header.Set("Content-Type", "application/json")
+	for _, name := range []string{model.AuthHeaderSubscriber, model.AuthHeaderGateway} {
+		if v := ctx.Request.Header.Get(name); len(v) != 0 {
+			req.Header.Set(name, v)
+		}
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		d.Err = fmt.Errorf("failed to send request: %w", err)
+		return d
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	d.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		d.Err = fmt.Errorf("subscriber responded with status: %s", resp.Status)
+	}
+	return d
+}
+
+// encrKeys resolves the key pair used to encrypt payloads exchanged with a counterparty.
+type encrKeys struct {
+	km       definition.KeyManager
+	registry definition.RegistryLookup
+}
+
+// sealKeys returns our active encryption keys and the counterparty's current encryption public
+// key, resolving the counterparty's current key id from the registry, in an envelope naming them.
+func (k *encrKeys) sealKeys(ctx *model.StepContext, bc *becknContext) (*model.EncryptedMessage, string, string, error) {
+	keyID, privateKey, err := k.km.EncrPrivateKey(ctx, ctx.SubID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	cpID, err := bc.counterparty(ctx.Role)
+	if err != nil {
+		return nil, "", "", err
+	}
+	subs, err := k.registry.Lookup(ctx, &model.Subscription{Subscriber: model.Subscriber{SubscriberID: cpID}})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to lookup %s: %w", cpID, err)
+	}
+	i := slices.IndexFunc(subs, func(sub model.Subscription) bool { return sub.SubscriberID == cpID })
+	if i < 0 {
+		return nil, "", "", model.NewNotFoundErrf("subscriber %s not found", cpID)
+	}
+	publicKey, err := k.km.EncrPublicKey(ctx, cpID, subs[i].KeyID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get encryption public key of %s: %w", cpID, err)
+	}
+	return &model.EncryptedMessage{SenderKeyID: keyID, RecipientKeyID: subs[i].KeyID}, privateKey, publicKey, nil
+}
+
+// openKeys returns our encryption private key and the counterparty's encryption public key
+// named by the envelope, which may be keys retained after a rotation.
+func (k *encrKeys) openKeys(ctx *model.StepContext, bc *becknContext, env *model.EncryptedMessage) (string, string, error) {
+	keys, err := k.km.Keyset(ctx, ctx.SubID, env.RecipientKeyID)
+	if err != nil {
+		return "", "", model.NewBadReqErrf("unknown recipient key %s: %w", env.RecipientKeyID, err)
+	}
+	cpID, err := bc.counterparty(ctx.Role)
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, err := k.km.EncrPublicKey(ctx, cpID, env.SenderKeyID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get encryption public key %s of %s: %w", env.SenderKeyID, cpID, err)
+	}
+	return keys.EncrPrivate, publicKey, nil
+}
+
+// splitMessage parses the request body into its top level fields and context.
+func splitMessage(body []byte) (map[string]json.RawMessage, *becknContext, error) {
+	bc, err := parseContext(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, model.NewBadReqErrf("invalid request body json: %w", err)
+	}
+	if _, ok := req["message"]; !ok {
+		return nil, nil, model.NewBadReqErrf("message field not found")
+	}
+	return req, bc, nil
+}
+
+// 🔹 Encrypt Step
+type encryptStep struct {
+	encrKeys
+	encryptor definition.Encryptor
+}
+
+// newEncryptStep creates and returns the encrypt step after validation
+func newEncryptStep(encryptor definition.Encryptor, km definition.KeyManager, registry definition.RegistryLookup) (definition.Step, error) {
+	if encryptor == nil {
+		return nil, fmt.Errorf("invalid config: Encryptor plugin not configured")
+	}
+	if km == nil {
+		return nil, fmt.Errorf("invalid config: KeyManager plugin not configured")
+	}
+	return &encryptStep{encrKeys: encrKeys{km: km, registry: registry}, encryptor: encryptor}, nil
+}
+
+// Run replaces the request message with its ciphertext for the counterparty.
+func (s *encryptStep) Run(ctx *model.StepContext) error {
+	req, bc, err := splitMessage(ctx.Body)
+	if err != nil {
+		return err
+	}
+	env, privateKey, publicKey, err := s.sealKeys(ctx, bc)
+	if err != nil {
+		return err
+	}
+	if env.EncryptedData, err = s.encryptor.Encrypt(ctx, req["message"], privateKey, publicKey); err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if req["message"], err = json.Marshal(env); err != nil {
+		return fmt.Errorf("failed to marshal encrypted message: %w", err)
+	}
+	if ctx.Body, err = json.Marshal(req); err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return nil
+}
+
+// 🔹 Decrypt Step
+type decryptStep struct {
+	encrKeys
+	decryptor definition.Decryptor
+}
+
+// newDecryptStep creates and returns the decrypt step after validation
+func newDecryptStep(decryptor definition.Decryptor, km definition.KeyManager, registry definition.RegistryLookup) (definition.Step, error) {
+	if decryptor == nil {
+		return nil, fmt.Errorf("invalid config: Decryptor plugin not configured")
+	}
+	if km == nil {
+		return nil, fmt.Errorf("invalid config: KeyManager plugin not configured")
+	}
+	return &decryptStep{encrKeys: encrKeys{km: km, registry: registry}, decryptor: decryptor}, nil
+}
+
+// Run replaces the encrypted request message with its plaintext.
+func (s *decryptStep) Run(ctx *model.StepContext) error {
+	req, bc, err := splitMessage(ctx.Body)
+	if err != nil {
+		return err
+	}
+	var env model.EncryptedMessage
+	if err := json.Unmarshal(req["message"], &env); err != nil || env.SenderKeyID == "" || env.RecipientKeyID == "" || env.EncryptedData == "" {
+		return model.NewBadReqErrf("message is not encrypted")
+	}
+	privateKey, publicKey, err := s.openKeys(ctx, bc, &env)
+	if err != nil {
+		return err
+	}
+	msg, err := s.decryptor.Decrypt(ctx, env.EncryptedData, privateKey, publicKey)
+	if err != nil {
+		return model.NewBadReqErrf("failed to decrypt message: %w", err)
+	}
+	if !json.Valid(msg) {
+		return model.NewBadReqErrf("decrypted message is not valid json")
+	}
+	req["message"] = msg
+	if ctx.Body, err = json.Marshal(req); err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return nil
+}
+
+// 🔹 Bridge Step
+type bridgeStep struct {
+	hub *callbackHub
+}
+
+// newBridgeStep creates and returns the bridge step after validation. The sender of a callback
+// is the signer of its Authorization header, so the step must run after validateSign.
+func newBridgeStep(afterValidateSign bool) (definition.Step, error) {
+	if !afterValidateSign {
+		return nil, fmt.Errorf("invalid config: bridge step requires validateSign step before it")
+	}
+	return &bridgeStep{hub: callbacks}, nil
+}
+
+// Run hands an on_* callback to the sync handler waiting for its message_id, clearing the
+// route so that it is acknowledged without being forwarded. Other requests pass unchanged.
+// A callback handed to a waiting caller must be signed by its bpp_id, and by the bpp_id the
+// request was sent to if set.
+func (s *bridgeStep) Run(ctx *model.StepContext) error {
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(bc.Action, "on_") {
+		return nil
+	}
+	header, err := authheader.Parse(ctx.Request.Header.Get(model.AuthHeaderSubscriber))
+	if err != nil {
+		return model.NewSignValidationErrf("failed to parse %s: %w", model.AuthHeaderSubscriber, err)
+	}
+	bridged, err := s.hub.deliver(bc.MessageID, bc.BppID, header.SubscriberID, ctx.Body)
+	if err != nil {
+		return err
+	}
+	if bridged {
+		log.Infof(ctx, "Bridged %s for message %s to its waiting caller", bc.Action, bc.MessageID)
+		ctx.Route = nil
+	}
 	return nil
 }
 
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/authheader"
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// setIfAbsentCache is a Cache serving SetIfAbsent from a map, recording the TTL of each key.
+type setIfAbsentCache struct {
+	ttls map[string]time.Duration
+	// lastTTL is the TTL of the key stored last.
+	lastTTL time.Duration
+	err     error
+}
+
+func (c *setIfAbsentCache) Get(ctx context.Context, key string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (c *setIfAbsentCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return errors.New("not implemented")
+}
+
+func (c *setIfAbsentCache) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if c.err != nil {
+		return false, c.err
+	}
+	if _, ok := c.ttls[key]; ok {
+		return false, nil
+	}
+	c.ttls[key] = ttl
+	c.lastTTL = ttl
+	return true, nil
+}
+
+func (c *setIfAbsentCache) Delete(ctx context.Context, key string) error {
+	delete(c.ttls, key)
+	return nil
+}
+
+func (c *setIfAbsentCache) Clear(ctx context.Context) error {
+	clear(c.ttls)
+	return nil
+}
+
+func TestCheckReplay(t *testing.T) {
+	now := time.Now().Unix()
+	body := []byte(`{"context":{"action":"search","message_id":"msg-1"}}`)
+	header := func(signer, signature string, expires int64) *authheader.Header {
+		return authheader.New(signer, "k1", now, expires, signature)
+	}
+	cache := &setIfAbsentCache{ttls: map[string]time.Duration{}}
+	s := &validateSignStep{cache: cache, replaySkew: 30 * time.Second}
+	// The cases run in order against the same cache.
+	tests := []struct {
+		name       string
+		subID      string
+		body       []byte
+		header     *authheader.Header
+		wantReplay bool
+		minTTL     time.Duration
+		maxTTL     time.Duration
+	}{
+		{
+			name:   "first request",
+			subID:  "bpp1",
+			body:   body,
+			header: header("bap1", "c2lnMQ==", now+60),
+			minTTL: 85 * time.Second,
+			maxTTL: 90 * time.Second,
+		},
+		{
+			name:       "replayed request",
+			subID:      "bpp1",
+			body:       body,
+			header:     header("bap1", "c2lnMQ==", now+60),
+			wantReplay: true,
+		},
+		{
+			name:   "other signature",
+			subID:  "bpp1",
+			body:   body,
+			header: header("bap1", "c2lnMg==", now+60),
+			minTTL: 85 * time.Second,
+			maxTTL: 90 * time.Second,
+		},
+		{
+			name:   "other receiver",
+			subID:  "bpp2",
+			body:   body,
+			header: header("bap1", "c2lnMQ==", now+60),
+			minTTL: 85 * time.Second,
+			maxTTL: 90 * time.Second,
+		},
+		{
+			name:   "other message",
+			subID:  "bpp1",
+			body:   []byte(`{"context":{"action":"search","message_id":"msg-2"}}`),
+			header: header("bap1", "c2lnMQ==", now+60),
+			minTTL: 85 * time.Second,
+			maxTTL: 90 * time.Second,
+		},
+		{
+			name:   "expired within skew",
+			subID:  "bpp1",
+			body:   body,
+			header: header("bap1", "c2lnMw==", now-10),
+			minTTL: 15 * time.Second,
+			maxTTL: 20 * time.Second,
+		},
+		{
+			name:   "expired beyond skew",
+			subID:  "bpp1",
+			body:   body,
+			header: header("bap1", "c2lnNA==", now-3600),
+			minTTL: time.Second,
+			maxTTL: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(cache.ttls)
+			ctx := &model.StepContext{Context: context.Background(), Body: tt.body, SubID: tt.subID}
+			err := s.checkReplay(ctx, tt.header)
+			var replayErr *model.ReplayErr
+			if tt.wantReplay {
+				if !errors.As(err, &replayErr) {
+					t.Fatalf("checkReplay() error = %v, want ReplayErr", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkReplay() error = %v", err)
+			}
+			if len(cache.ttls) != before+1 {
+				t.Fatalf("recorded %d signatures, want 1", len(cache.ttls)-before)
+			}
+			if cache.lastTTL < tt.minTTL || cache.lastTTL > tt.maxTTL {
+				t.Errorf("signature recorded for %s, want [%s, %s]", cache.lastTTL, tt.minTTL, tt.maxTTL)
+			}
+		})
+	}
+}
+
+func TestCheckReplayUndo(t *testing.T) {
+	s := &validateSignStep{cache: &setIfAbsentCache{ttls: map[string]time.Duration{}}, replaySkew: time.Minute}
+	header := authheader.New("bap1", "k1", 0, time.Now().Unix()+60, "c2ln")
+	newCtx := func() *model.StepContext {
+		return &model.StepContext{Context: context.Background(), Body: []byte(`{"context":{"message_id":"msg-1"}}`), SubID: "bpp1"}
+	}
+	ctx := newCtx()
+	if err := s.checkReplay(ctx, header); err != nil {
+		t.Fatalf("checkReplay() error = %v", err)
+	}
+	// The request failed after validateSign, so its retry is received.
+	undo(ctx)
+	retry := newCtx()
+	if err := s.checkReplay(retry, header); err != nil {
+		t.Fatalf("checkReplay() of retry error = %v", err)
+	}
+	var replayErr *model.ReplayErr
+	if err := s.checkReplay(newCtx(), header); !errors.As(err, &replayErr) {
+		t.Errorf("checkReplay() after successful retry error = %v, want ReplayErr", err)
+	}
+}
+
+func TestCheckReplayCacheError(t *testing.T) {
+	s := &validateSignStep{cache: &setIfAbsentCache{err: errors.New("unavailable")}, replaySkew: time.Minute}
+	ctx := &model.StepContext{Context: context.Background(), Body: []byte(`{}`), SubID: "bpp1"}
+	err := s.checkReplay(ctx, authheader.New("bap1", "k1", 0, time.Now().Unix()+60, "c2ln"))
+	var replayErr *model.ReplayErr
+	if err == nil || errors.As(err, &replayErr) {
+		t.Errorf("checkReplay() error = %v, want a cache error", err)
+	}
+}
+
+func TestBridgeStep(t *testing.T) {
+	callback := func(bppID string) []byte {
+		return []byte(`{"context":{"action":"on_search","message_id":"msg-1","bpp_id":"` + bppID + `"}}`)
+	}
+	tests := []struct {
+		name        string
+		waitFor     string
+		body        []byte
+		signer      string
+		wantErr     bool
+		wantBridged bool
+	}{
+		{name: "signed by bpp_id", waitFor: "bpp1", body: callback("bpp1"), signer: "bpp1", wantBridged: true},
+		{name: "waiting for any bpp", body: callback("bpp2"), signer: "bpp2", wantBridged: true},
+		{name: "signed by other than bpp_id", waitFor: "bpp1", body: callback("bpp1"), signer: "bpp2", wantErr: true},
+		{name: "from other bpp than the request", waitFor: "bpp1", body: callback("bpp2"), signer: "bpp2", wantErr: true},
+		{name: "signed by other than bpp_id without waiter", body: []byte(`{"context":{"action":"on_search","message_id":"msg-2","bpp_id":"bpp1"}}`), signer: "gw1"},
+		{name: "not a callback", body: []byte(`{"context":{"action":"search","message_id":"msg-1"}}`), signer: "bap1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &callbackHub{waiters: map[string]*waiter{}}
+			w, err := hub.wait("msg-1", tt.waitFor)
+			if err != nil {
+				t.Fatalf("wait() error = %v", err)
+			}
+			req, _ := http.NewRequest(http.MethodPost, "/bap/receiver/on_search", nil)
+			req.Header.Set(model.AuthHeaderSubscriber, authheader.New(tt.signer, "k1", 0, time.Now().Unix()+60, "c2ln").String())
+			route := &model.Route{Type: "url"}
+			ctx := &model.StepContext{Context: context.Background(), Request: req, Body: tt.body, Route: route}
+			err = (&bridgeStep{hub: hub}).Run(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bridged := len(w.since(0)) != 0; bridged != tt.wantBridged {
+				t.Errorf("bridged = %v, want %v", bridged, tt.wantBridged)
+			}
+			if !tt.wantErr && (ctx.Route == nil) != tt.wantBridged {
+				t.Errorf("route = %v, want cleared %v", ctx.Route, tt.wantBridged)
+			}
+		})
+	}
+}
@@ -4,53 +4,124 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/ashishGuliya/onix/core/module/client"
+	"github.com/ashishGuliya/onix/pkg/authheader"
 	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/model"
 	"github.com/ashishGuliya/onix/pkg/plugin"
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/sealbox"
+	"github.com/google/uuid"
 )
 
 type registryClient interface {
-	Subscribe(ctx context.Context, subscription *model.Subscription) error
+	Subscribe(ctx context.Context, subscription *model.Subscription, signingPrivateKey string) error
 	Lookup(ctx context.Context, subscription *model.Subscription) ([]model.Subscription, error)
 }
 
+// defaultRotationGrace is how long the previous keyset stays valid when no grace is configured.
+const defaultRotationGrace = 24 * time.Hour
+
+// rotatePath is the path suffix on which the npSub handler serves key rotation requests.
+const rotatePath = "/rotate"
+
+// pendingSubscribeTTL is how long the on_subscribe handler answers the challenge of a subscribe request.
+const pendingSubscribeTTL = 10 * time.Minute
+
 // regSubscibeHandler encapsulates the subscription logic.
 type npSubscibeHandler struct {
 	km      definition.KeyManager
+	cache   definition.Cache
 	rClient registryClient
+	grace   time.Duration
 }
 
 // NewRegSubscibeHandler creates a new instance of SubscriptionService.
 func NewNPSubscibeHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	rCfg := &client.Config{RegisteryURL: cfg.RegistryURL}
 	s := &npSubscibeHandler{
-		rClient: client.NewRegisteryClient(&client.Config{RegisteryURL: cfg.RegistryURL}),
+		rClient: client.NewRegisteryClient(rCfg),
+		grace:   defaultRotationGrace,
 	}
 	// Initialize plugins
 	if err := s.initPlugins(ctx, mgr, &cfg.Plugins); err != nil {
 		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
 	}
-
+	if cfg.Plugins.Signer == nil {
+		return nil, fmt.Errorf("failed to initialize plugins: invalid config: Signer missing")
+	}
+	var err error
+	if rCfg.Signer, err = mgr.Signer(ctx, cfg.Plugins.Signer); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugins: failed to load signer: %w", err)
+	}
+	if err := s.initRotation(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize key rotation: %w", err)
+	}
 	return s, nil
 }
 
+// initRotation applies the key rotation config and starts the scheduled rotation job.
+func (h *npSubscibeHandler) initRotation(ctx context.Context, cfg *Config) error {
+	rc := cfg.KeyRotation
+	if rc == nil {
+		return nil
+	}
+	if rc.Grace < 0 || rc.Interval < 0 {
+		return fmt.Errorf("invalid config: keyRotation interval and grace cannot be negative")
+	}
+	if rc.Grace > 0 {
+		h.grace = rc.Grace
+	}
+	if rc.Interval == 0 {
+		return nil
+	}
+	if len(cfg.SubscriberID) == 0 {
+		return fmt.Errorf("invalid config: subscriberId is required for scheduled key rotation")
+	}
+	go h.rotateEvery(ctx, cfg.SubscriberID, rc.Interval)
+	log.Infof(ctx, "Scheduled key rotation for %s every %s", cfg.SubscriberID, rc.Interval)
+	return nil
+}
+
+// rotateEvery rotates the keys of subID at every interval until ctx is done.
+func (h *npSubscibeHandler) rotateEvery(ctx context.Context, subID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sub, err := h.subscriber(ctx, subID)
+			if err != nil {
+				log.Errorf(ctx, err, "Scheduled key rotation for %s skipped", subID)
+				continue
+			}
+			if err := h.rotate(ctx, sub); err != nil {
+				log.Errorf(ctx, err, "Scheduled key rotation for %s failed", subID)
+			}
+		}
+	}
+}
+
 // initPlugins initializes required plugins for the processor.
 func (h *npSubscibeHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg) error {
 	var err error
 	if cfg.Cache == nil {
 		return fmt.Errorf("invalid config: Cache missing")
 	}
-	cache, err := mgr.Cache(ctx, cfg.Cache)
-	if err != nil {
+	if h.cache, err = mgr.Cache(ctx, cfg.Cache); err != nil {
 		return fmt.Errorf("failed to load cache: %w", err)
 	}
 	if cfg.KeyManager == nil {
 		return fmt.Errorf("invalid config: KeyManager missing")
 	}
-	if h.km, err = mgr.KeyManager(ctx, cache, h.rClient, cfg.KeyManager); err != nil {
+	if h.km, err = mgr.KeyManager(ctx, h.cache, h.rClient, cfg.KeyManager); err != nil {
 		return fmt.Errorf("failed to load cache: %w", err)
 	}
 	return nil
@@ -77,6 +148,10 @@ func (h *npSubscibeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing subscriber_id", http.StatusBadRequest)
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, rotatePath) {
+		h.serveRotate(w, r, &reqPayload.Subscriber)
+		return
+	}
 	// Validate subscriber_id
 	if reqPayload.URL == "" {
 		http.Error(w, "missing subscriber url", http.StatusBadRequest)
@@ -88,16 +163,7 @@ func (h *npSubscibeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to generate keys", http.StatusInternalServerError)
 		return
 	}
-	log.Debugf(r.Context(), "got keys %#v", keys)
-	// Create subscription request
-	reqData := &model.Subscription{
-		KeyID:            keys.UniqueKeyID,
-		SigningPublicKey: keys.SigningPublic,
-		EncrPublicKey:    keys.EncrPublic,
-		Subscriber:       reqPayload.Subscriber,
-	}
-
-	if err := h.rClient.Subscribe(r.Context(), reqData); err != nil {
+	if err := h.subscribe(r.Context(), &reqPayload.Subscriber, keys); err != nil {
 		log.Errorf(r.Context(), err, "Call to registery failed")
 		http.Error(w, "failed to send request", http.StatusInternalServerError)
 		return
@@ -107,7 +173,226 @@ func (h *npSubscibeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to StorePrivateKeys", http.StatusInternalServerError)
 		return
 	}
+	h.storeSubscriber(r.Context(), &reqPayload.Subscriber)
 	// Forward the response back to the client
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Successful"))
 }
+
+// serveRotate rotates the keys of the subscriber, using the details recorded at
+// subscription time for any fields missing from the request.
+func (h *npSubscibeHandler) serveRotate(w http.ResponseWriter, r *http.Request, sub *model.Subscriber) {
+	if sub.URL == "" {
+		stored, err := h.subscriber(r.Context(), sub.SubscriberID)
+		if err != nil {
+			log.Errorf(r.Context(), err, "failed to load subscriber")
+			http.Error(w, "missing subscriber url", http.StatusBadRequest)
+			return
+		}
+		sub = stored
+	}
+	if err := h.rotate(r.Context(), sub); err != nil {
+		log.Errorf(r.Context(), err, "Key rotation failed")
+		http.Error(w, "failed to rotate keys", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Successful"))
+}
+
+// rotate generates a new keyset, subscribes it with the registry and makes it
+// the active keyset, keeping the previous one valid for the grace period. The previous
+// keyset is then renewed with the registry until the end of the grace period.
+func (h *npSubscibeHandler) rotate(ctx context.Context, sub *model.Subscriber) error {
+	prevKeyID, _, err := h.km.SigningPrivateKey(ctx, sub.SubscriberID)
+	if err != nil {
+		return fmt.Errorf("failed to read current keys: %w", err)
+	}
+	keys, err := h.km.GenerateKeyPairs()
+	if err != nil {
+		return fmt.Errorf("failed to generate keys: %w", err)
+	}
+	if err := h.subscribe(ctx, sub, keys); err != nil {
+		return fmt.Errorf("call to registery failed: %w", err)
+	}
+	if err := h.km.RotatePrivateKeys(ctx, sub.SubscriberID, keys, h.grace); err != nil {
+		return fmt.Errorf("failed to rotate private keys: %w", err)
+	}
+	h.storeSubscriber(ctx, sub)
+	log.Infof(ctx, "Rotated keys for %s to %s", sub.SubscriberID, keys.UniqueKeyID)
+
+	prev, err := h.km.Keyset(ctx, sub.SubscriberID, prevKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to read previous keys %s: %w", prevKeyID, err)
+	}
+	if err := h.subscribe(ctx, sub, prev); err != nil {
+		return fmt.Errorf("failed to renew previous keys %s with registery: %w", prevKeyID, err)
+	}
+	return nil
+}
+
+// subscribe sends the subscribe request for keys, signed with their signing key, recording its
+// request id so that the on_subscribe handler answers the registry's challenge for it.
+func (h *npSubscibeHandler) subscribe(ctx context.Context, sub *model.Subscriber, keys *definition.Keyset) error {
+	reqID, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to generate request id: %w", err)
+	}
+	if err := h.cache.Set(ctx, pendingSubscribeKey(sub.SubscriberID, reqID.String()), keys.UniqueKeyID, pendingSubscribeTTL); err != nil {
+		return fmt.Errorf("failed to record subscribe request: %w", err)
+	}
+	return h.rClient.Subscribe(ctx, &model.Subscription{
+		KeyID:            keys.UniqueKeyID,
+		SigningPublicKey: keys.SigningPublic,
+		EncrPublicKey:    keys.EncrPublic,
+		Subscriber:       *sub,
+		RequestID:        reqID.String(),
+		ValidUntil:       keys.ValidUntil,
+	}, keys.SigningPrivate)
+}
+
+// pendingSubscribeKey is the cache key under which the key id of a subscribe request is recorded.
+func pendingSubscribeKey(subID, reqID string) string {
+	return fmt.Sprintf("np_subscribe_request:%s:%s", subID, reqID)
+}
+
+// subscriberKey is the cache key under which the subscriber details are recorded.
+func subscriberKey(subID string) string {
+	return fmt.Sprintf("np_subscriber:%s", subID)
+}
+
+// storeSubscriber records the subscriber details so that keys can be rotated later.
+func (h *npSubscibeHandler) storeSubscriber(ctx context.Context, sub *model.Subscriber) {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		log.Errorf(ctx, err, "failed to marshal subscriber")
+		return
+	}
+	if err := h.cache.Set(ctx, subscriberKey(sub.SubscriberID), string(data), 0); err != nil {
+		log.Errorf(ctx, err, "failed to store subscriber %s", sub.SubscriberID)
+	}
+}
+
+// subscriber returns the subscriber details recorded at subscription time.
+func (h *npSubscibeHandler) subscriber(ctx context.Context, subID string) (*model.Subscriber, error) {
+	data, err := h.cache.Get(ctx, subscriberKey(subID))
+	if err != nil {
+		return nil, fmt.Errorf("subscriber %s not found: %w", subID, err)
+	}
+	var sub model.Subscriber
+	if err := json.Unmarshal([]byte(data), &sub); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal subscriber: %w", err)
+	}
+	return &sub, nil
+}
+
+// npOnSubscribeHandler answers the registry's on_subscribe challenge.
+type npOnSubscribeHandler struct {
+	km        definition.KeyManager
+	cache     definition.Cache
+	validator definition.SignValidator
+	// registrySigningKey and registryEncrKey are the pinned public keys of the registry.
+	registrySigningKey string
+	registryEncrKey    string
+}
+
+// NewNPOnSubscribeHandler creates a new instance of the on_subscribe handler.
+func NewNPOnSubscribeHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	if len(cfg.RegistryPublicKey) == 0 || len(cfg.RegistryEncrPublicKey) == 0 {
+		return nil, fmt.Errorf("invalid config: registryPublicKey and registryEncrPublicKey are required to answer on_subscribe")
+	}
+	h := &npOnSubscribeHandler{registrySigningKey: cfg.RegistryPublicKey, registryEncrKey: cfg.RegistryEncrPublicKey}
+	if err := h.initPlugins(ctx, mgr, &cfg.Plugins, cfg.RegistryURL); err != nil {
+		return nil, fmt.Errorf("failed to initialize plugins: %w", err)
+	}
+	return h, nil
+}
+
+// initPlugins initializes required plugins for the handler.
+func (h *npOnSubscribeHandler) initPlugins(ctx context.Context, mgr *plugin.Manager, cfg *pluginCfg, regURL string) error {
+	var err error
+	if cfg.Cache == nil {
+		return fmt.Errorf("invalid config: Cache missing")
+	}
+	if h.cache, err = mgr.Cache(ctx, cfg.Cache); err != nil {
+		return fmt.Errorf("failed to load cache: %w", err)
+	}
+	if cfg.KeyManager == nil {
+		return fmt.Errorf("invalid config: KeyManager missing")
+	}
+	rClient := client.NewRegisteryClient(&client.Config{RegisteryURL: regURL})
+	if h.km, err = mgr.KeyManager(ctx, h.cache, rClient, cfg.KeyManager); err != nil {
+		return fmt.Errorf("failed to load key manager: %w", err)
+	}
+	if cfg.SignValidator == nil {
+		return fmt.Errorf("invalid config: SignValidator missing")
+	}
+	if h.validator, err = mgr.SignValidator(ctx, cfg.SignValidator); err != nil {
+		return fmt.Errorf("failed to load sign validator: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP decrypts the challenge with the subscriber's encryption private key and returns it as the answer.
+// Only challenges signed by the registry, for a subscribe request sent by this subscriber and
+// sealed with the registry's encryption key are answered.
+func (h *npOnSubscribeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debug(r.Context(), "NP on_subscribe handler called.")
+	if r.Method != http.MethodPost {
+		http.Error(w, "invalid request method, only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate(r.Context(), body, r.Header.Get(model.AuthHeaderSubscriber)); err != nil {
+		log.Errorf(r.Context(), err, "on_subscribe signature validation failed")
+		w.Header().Set(model.UnaAuthorizedHeaderSubscriber, authheader.Challenge(""))
+		http.Error(w, "invalid on_subscribe signature", http.StatusUnauthorized)
+		return
+	}
+	var req model.OnSubscribeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.SubscriberID == "" || req.KeyID == "" || req.RequestID == "" || req.Challenge == "" {
+		http.Error(w, "missing subscriber_id, key_id, request_id or challenge", http.StatusBadRequest)
+		return
+	}
+	keyID, err := h.cache.Get(r.Context(), pendingSubscribeKey(req.SubscriberID, req.RequestID))
+	if err != nil || keyID != req.KeyID {
+		log.Errorf(r.Context(), err, "no pending subscribe request %s for key %s of %s", req.RequestID, req.KeyID, req.SubscriberID)
+		http.Error(w, "unknown subscribe request", http.StatusNotFound)
+		return
+	}
+
+	keys, err := h.km.Keyset(r.Context(), req.SubscriberID, req.KeyID)
+	if err != nil {
+		// The keys are stored once the registry accepted the subscribe request, the registry retries.
+		log.Errorf(r.Context(), err, "encryption key %s of %s not stored yet", req.KeyID, req.SubscriberID)
+		http.Error(w, "unknown subscriber key", http.StatusNotFound)
+		return
+	}
+	answer, err := sealbox.Open(req.Challenge, keys.EncrPrivate, h.registryEncrKey, sealbox.LabelChallenge)
+	if err != nil {
+		log.Errorf(r.Context(), err, "failed to decrypt challenge")
+		http.Error(w, "failed to decrypt challenge", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&model.OnSubscribeResponse{Answer: string(answer)}); err != nil {
+		log.Errorf(r.Context(), err, "Error encoding JSON")
+	}
+}
+
+// validate checks that the on_subscribe request is signed with the pinned registry signing key.
+func (h *npOnSubscribeHandler) validate(ctx context.Context, body []byte, authHeader string) error {
+	if len(authHeader) == 0 {
+		return fmt.Errorf("%s missing", model.AuthHeaderSubscriber)
+	}
+	return h.validator.Validate(ctx, body, authHeader, h.registrySigningKey)
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin"
+	"github.com/ashishGuliya/onix/pkg/response"
+)
+
+// defaultSyncTimeout is how long callbacks are collected when not configured.
+const defaultSyncTimeout = 10 * time.Second
+
+// waiter collects the callbacks of a message.
+type waiter struct {
+	// bppID is the bpp_id of the request, whose callbacks must be sent by it when set.
+	bppID  string
+	mu     sync.Mutex
+	bodies []json.RawMessage
+	// notify is signalled when a callback is added.
+	notify chan struct{}
+}
+
+// add stores a callback and notifies the caller waiting for it.
+func (w *waiter) add(body []byte) {
+	w.mu.Lock()
+	w.bodies = append(w.bodies, bytes.Clone(body))
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// since returns the callbacks received after the first n.
+func (w *waiter) since(n int) []json.RawMessage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bodies[n:]
+}
+
+// callbackHub hands on_* callbacks received by the bridge step to the sync handler waiting for them.
+type callbackHub struct {
+	mu      sync.Mutex
+	waiters map[string]*waiter
+}
+
+// callbacks is shared by all handlers, as callbacks are received by a different module than the one waiting for them.
+var callbacks = &callbackHub{waiters: map[string]*waiter{}}
+
+// wait registers a waiter for the callbacks of msgID sent by bppID, or by any sender when
+// bppID is empty, failing if one is already registered.
+func (h *callbackHub) wait(msgID, bppID string) (*waiter, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.waiters[msgID]; ok {
+		return nil, model.NewBadReqErrf("already waiting for callbacks of message_id %s", msgID)
+	}
+	w := &waiter{bppID: bppID, notify: make(chan struct{}, 1)}
+	h.waiters[msgID] = w
+	return w, nil
+}
+
+// release removes the waiter of msgID, later callbacks are routed as usual.
+func (h *callbackHub) release(msgID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.waiters, msgID)
+}
+
+// deliver hands body, the callback of bppID signed by senderID, to the waiter of msgID, reporting
+// whether one was waiting. It fails when a waiter exists and the callback is not signed by its
+// bpp_id, or the waiter expects callbacks from another sender.
+func (h *callbackHub) deliver(msgID, bppID, senderID string, body []byte) (bool, error) {
+	h.mu.Lock()
+	w, ok := h.waiters[msgID]
+	h.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if senderID != bppID {
+		return false, model.NewSignValidationErrf("%s signed by %s, not by the bpp_id %s of the callback", model.AuthHeaderSubscriber, senderID, bppID)
+	}
+	if len(w.bppID) != 0 && w.bppID != senderID {
+		return false, model.NewBadReqErrf("callback for message_id %s sent by %s, not by %s the request was sent to", msgID, senderID, w.bppID)
+	}
+	w.add(body)
+	return true, nil
+}
+
+// syncHandler sends a request and holds the connection until its callbacks arrive, so that
+// clients can use the asynchronous Beckn protocol as a synchronous API. The callbacks are
+// received by a module with the bridge step, which must run in the same process.
+type syncHandler struct {
+	std          *stdHandler
+	client       *http.Client
+	timeout      time.Duration
+	maxResponses int
+}
+
+// syncResponse is returned to the client with the callbacks received before the timeout.
+type syncResponse struct {
+	MessageID string            `json:"message_id"`
+	Responses []json.RawMessage `json:"responses"`
+}
+
+// NewSyncHandler creates the sync handler.
+func NewSyncHandler(ctx context.Context, mgr *plugin.Manager, cfg *Config) (http.Handler, error) {
+	if cfg.Sync != nil && cfg.Sync.MaxResponses < 0 {
+		return nil, fmt.Errorf("invalid config: sync maxResponses cannot be negative")
+	}
+	if cfg.Plugins.Outbox != nil {
+		return nil, fmt.Errorf("invalid config: Outbox not supported by sync handler")
+	}
+	std, err := newStdHandler(ctx, mgr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	h := &syncHandler{
+		std:     std,
+		client:  &http.Client{Timeout: forwardTimeout},
+		timeout: defaultSyncTimeout,
+	}
+	if cfg.Sync != nil {
+		if cfg.Sync.Timeout != 0 {
+			h.timeout = cfg.Sync.Timeout
+		}
+		h.maxResponses = cfg.Sync.MaxResponses
+	}
+	return h, nil
+}
+
+// ServeHTTP sends the request and returns its callbacks together once the timeout expires or
+// maxResponses callbacks arrived. Clients accepting text/event-stream receive every callback
+// as a server-sent event when it arrives instead.
+func (h *syncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, err := h.std.stepCtx(r, w.Header())
+	if err != nil {
+		log.Errorf(r.Context(), err, "stepCtx(r):%v", err)
+		response.SendNack(ctx, w, err)
+		return
+	}
+	log.Request(r.Context(), r, ctx.Body)
+	bc, err := parseContext(ctx.Body)
+	if err != nil {
+		response.SendNack(ctx, w, err)
+		return
+	}
+	if len(bc.MessageID) == 0 {
+		response.SendNack(ctx, w, model.NewBadReqErrf("context.message_id missing"))
+		return
+	}
+	// Wait before sending, so that no callback arrives unnoticed.
+	wt, err := callbacks.wait(bc.MessageID, bc.BppID)
+	if err != nil {
+		response.SendNack(ctx, w, err)
+		return
+	}
+	defer callbacks.release(bc.MessageID)
+
+	for _, step := range h.std.steps {
+		if err := step.Run(ctx); err != nil {
+			log.Errorf(ctx, err, "%T.run(%v):%v", step, ctx, err)
+			response.SendNack(ctx, w, err)
+			undo(ctx)
+			return
+		}
+	}
+	if ctx.Route != nil {
+		if err := h.std.forward(ctx, h.client); err != nil {
+			log.Errorf(ctx, err, "Failed to send message %s", bc.MessageID)
+			response.SendNack(ctx, w, err)
+			undo(ctx)
+			return
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.stream(ctx, w, wt, bc.MessageID)
+		return
+	}
+	resp := syncResponse{MessageID: bc.MessageID, Responses: []json.RawMessage{}}
+	h.await(ctx, wt, func(bodies []json.RawMessage) {
+		resp.Responses = append(resp.Responses, bodies...)
+	})
+	log.Infof(ctx, "Returning %d callbacks for message %s", len(resp.Responses), bc.MessageID)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, err, "Error encoding JSON")
+	}
+}
+
+// await calls emit with the callbacks as they arrive, until the timeout expires, maxResponses
+// callbacks arrived or the client went away.
+func (h *syncHandler) await(ctx context.Context, wt *waiter, emit func([]json.RawMessage)) {
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	n := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-wt.notify:
+		}
+		bodies := wt.since(n)
+		n += len(bodies)
+		emit(bodies)
+		if h.maxResponses > 0 && n >= h.maxResponses {
+			return
+		}
+	}
+}
+
+// stream sends every callback as a server-sent event named by its action, followed by a done event.
+func (h *syncHandler) stream(ctx context.Context, w http.ResponseWriter, wt *waiter, msgID string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		log.Errorf(ctx, err, "Streaming callbacks not supported")
+	}
+	n := 0
+	h.await(ctx, wt, func(bodies []json.RawMessage) {
+		for _, body := range bodies {
+			action := "callback"
+			if bc, err := parseContext(body); err == nil && len(bc.Action) != 0 {
+				action = bc.Action
+			}
+			var data bytes.Buffer
+			if err := json.Compact(&data, body); err != nil {
+				log.Errorf(ctx, err, "Skipping invalid callback for message %s", msgID)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", action, data.Bytes())
+			n++
+		}
+		_ = rc.Flush()
+	})
+	done, _ := json.Marshal(map[string]any{"message_id": msgID, "count": n})
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", done)
+	_ = rc.Flush()
+}
@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
+)
+
+// Mapping operations, see mappingOp.
+const (
+	opRename  = "rename"
+	opDefault = "default"
+	opDrop    = "drop"
+	opCompute = "compute"
+)
+
+// mappingOp is an operation on a field of a JSON body, addressed by a dot separated path
+// in which numeric segments index arrays, e.g. message.order.items.0.id.
+type mappingOp struct {
+	// Op is rename, default, drop or compute.
+	Op string `yaml:"op"`
+	// From is the field moved to To by rename.
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Path is the field set by default when it is missing, removed by drop and set by compute.
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+	// Template is the Go template computing the field from the body, e.g. {{.context.bap_id}}.
+	Template string `yaml:"template"`
+	// JSON parses the output of Template as a JSON value, e.g. a number, instead of a string.
+	JSON bool `yaml:"json"`
+
+	tmpl *template.Template
+}
+
+// mapping transforms the bodies of the requests of an action and of their responses.
+type mapping struct {
+	// Request is applied to the body of the request by the transform step.
+	Request []mappingOp `yaml:"request"`
+	// Response is applied to the body of the response to a request proxied to a url route.
+	Response []mappingOp `yaml:"response"`
+}
+
+// transformer holds the mappings of the actions, read from a file per action.
+type transformer struct {
+	mappings map[string]*mapping
+}
+
+// templateFuncs are the functions available to compute templates besides the builtins.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"now":  func() string { return time.Now().UTC().Format(time.RFC3339) },
+	"uuid": func() string { return uuid.NewString() },
+}
+
+// newTransformer reads the mapping files in dir, named after their action, e.g. search.yaml.
+func newTransformer(dir string) (*transformer, error) {
+	if len(dir) == 0 {
+		return nil, fmt.Errorf("invalid config: transform mappingDir cannot be empty")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mapping files: %w", err)
+	}
+	t := &transformer{mappings: map[string]*mapping{}}
+	for _, file := range files {
+		m, err := readMapping(file)
+		if err != nil {
+			return nil, err
+		}
+		t.mappings[strings.TrimSuffix(filepath.Base(file), ".yaml")] = m
+	}
+	return t, nil
+}
+
+// readMapping reads and validates a mapping file.
+func readMapping(file string) (*mapping, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+	var m mapping
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file %s: %w", file, err)
+	}
+	for _, ops := range [][]mappingOp{m.Request, m.Response} {
+		for i := range ops {
+			if err := ops[i].init(); err != nil {
+				return nil, fmt.Errorf("invalid mapping file %s: operation %d: %w", file, i+1, err)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// init validates the operation and parses its template.
+func (o *mappingOp) init() error {
+	switch o.Op {
+	case opRename:
+		if len(o.From) == 0 || len(o.To) == 0 {
+			return fmt.Errorf("rename requires from and to")
+		}
+	case opDefault:
+		if len(o.Path) == 0 || o.Value == nil {
+			return fmt.Errorf("default requires path and value")
+		}
+		o.Value = jsonValue(o.Value)
+	case opDrop:
+		if len(o.Path) == 0 {
+			return fmt.Errorf("drop requires path")
+		}
+	case opCompute:
+		if len(o.Path) == 0 || len(o.Template) == 0 {
+			return fmt.Errorf("compute requires path and template")
+		}
+		// A field missing from the body fails the operation rather than computing "<no value>".
+		tmpl, err := template.New(o.Path).Option("missingkey=error").Funcs(templateFuncs).Parse(o.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		o.tmpl = tmpl
+	default:
+		return fmt.Errorf("unknown op: %q", o.Op)
+	}
+	return nil
+}
+
+// apply runs the operations on body in order, returning the transformed body.
+func apply(ops []mappingOp, body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var root map[string]any
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid json body: %w", err)
+	}
+	for _, o := range ops {
+		switch o.Op {
+		case opRename:
+			if v, ok := getPath(root, o.From); ok {
+				deletePath(root, o.From)
+				if err := setPath(root, o.To, v); err != nil {
+					return nil, err
+				}
+			}
+		case opDefault:
+			if _, ok := getPath(root, o.Path); !ok {
+				if err := setPath(root, o.Path, o.Value); err != nil {
+					return nil, err
+				}
+			}
+		case opDrop:
+			deletePath(root, o.Path)
+		case opCompute:
+			v, err := o.compute(root)
+			if err != nil {
+				return nil, err
+			}
+			if err := setPath(root, o.Path, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(root)
+}
+
+// compute executes the template of the operation on root.
+func (o *mappingOp) compute(root map[string]any) (any, error) {
+	var out bytes.Buffer
+	if err := o.tmpl.Execute(&out, root); err != nil {
+		return nil, fmt.Errorf("failed to compute %s: %w", o.Path, err)
+	}
+	if !o.JSON {
+		return out.String(), nil
+	}
+	dec := json.NewDecoder(&out)
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("computed %s is not json: %w", o.Path, err)
+	}
+	return v, nil
+}
+
+// getPath returns the value of field.
+func getPath(root map[string]any, field string) (any, bool) {
+	var cur any = root
+	for _, seg := range strings.Split(field, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			v, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setPath sets the value at field, creating the missing objects on the way.
+func setPath(root map[string]any, field string, v any) error {
+	segs := strings.Split(field, ".")
+	var cur any = root
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch node := cur.(type) {
+		case map[string]any:
+			if last {
+				node[seg] = v
+				return nil
+			}
+			next, ok := node[seg]
+			if !ok {
+				next = map[string]any{}
+				node[seg] = next
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return fmt.Errorf("cannot set %s: no array element %s", field, seg)
+			}
+			if last {
+				node[idx] = v
+				return nil
+			}
+			cur = node[idx]
+		default:
+			return fmt.Errorf("cannot set %s: %s is not an object or array", field, strings.Join(segs[:i], "."))
+		}
+	}
+	return nil
+}
+
+// deletePath removes field, array elements are not removed.
+func deletePath(root map[string]any, field string) {
+	i := strings.LastIndex(field, ".")
+	if i < 0 {
+		delete(root, field)
+		return
+	}
+	if parent, ok := getPath(root, field[:i]); ok {
+		if obj, ok := parent.(map[string]any); ok {
+			delete(obj, field[i+1:])
+		}
+	}
+}
+
+// jsonValue converts the maps decoded from YAML to JSON objects.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]any, len(v))
+		for k, e := range v {
+			obj[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return obj
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// response transforms the body of resp, the response to a request of action, with the
+// response mapping of the action. The signatures of the upstream no longer match the
+// transformed body and are dropped. Server errors are returned as they are.
+func (t *transformer) response(action string, resp *http.Response) error {
+	m, ok := t.mappings[action]
+	if !ok || len(m.Response) == 0 || resp.StatusCode >= http.StatusInternalServerError {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return &rejectedResponseErr{err: fmt.Errorf("failed to read upstream response: %w", err)}
+	}
+	if body, err = apply(m.Response, body); err != nil {
+		return &rejectedResponseErr{err: fmt.Errorf("failed to transform %s response: %w", action, err)}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del(model.AuthHeaderSubscriber)
+	resp.Header.Del(model.AuthHeaderGateway)
+	return nil
+}
+
+// 🔹 Transform Step
+type transformStep struct {
+	transformer *transformer
+}
+
+// newTransformStep creates and returns the transform step after validation
+func newTransformStep(t *transformer) (definition.Step, error) {
+	if t == nil {
+		return nil, fmt.Errorf("invalid config: transform not configured")
+	}
+	return &transformStep{transformer: t}, nil
+}
+
+// Run transforms the request body with the request mapping of its action, if there is one.
+func (s *transformStep) Run(ctx *model.StepContext) error {
+	action := requestAction(ctx)
+	m, ok := s.transformer.mappings[action]
+	if !ok || len(m.Request) == 0 {
+		return nil
+	}
+	body, err := apply(m.Request, ctx.Body)
+	if err != nil {
+		return model.NewBadReqErrf("failed to transform %s request: %w", action, err)
+	}
+	log.Debugf(ctx, "Transformed %s request", action)
+	ctx.Body = body
+	return nil
+}
+
+// requestAction returns context.action of the request body or, for bodies without a Beckn
+// context such as those of backends, the last segment of the request path.
+func requestAction(ctx *model.StepContext) string {
+	if bc, err := parseContext(ctx.Body); err == nil && len(bc.Action) != 0 {
+		return bc.Action
+	}
+	return path.Base(ctx.Request.URL.Path)
+}
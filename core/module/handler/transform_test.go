@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+func TestApply(t *testing.T) {
+	body := `{"context":{"action":"search","bap_id":"bap1"},"message":{"items":[{"id":"i1","qty":2}],"note":"x"}}`
+	tests := []struct {
+		name    string
+		ops     []mappingOp
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "rename",
+			ops:  []mappingOp{{Op: opRename, From: "message.note", To: "message.intent.note"}},
+			want: `{"context":{"action":"search","bap_id":"bap1"},"message":{"intent":{"note":"x"},"items":[{"id":"i1","qty":2}]}}`,
+		},
+		{
+			name: "rename missing field",
+			ops:  []mappingOp{{Op: opRename, From: "message.missing", To: "message.other"}},
+			want: body,
+		},
+		{
+			name: "default missing field",
+			ops:  []mappingOp{{Op: opDefault, Path: "context.city", Value: "std:080"}},
+			want: `{"context":{"action":"search","bap_id":"bap1","city":"std:080"},"message":{"items":[{"id":"i1","qty":2}],"note":"x"}}`,
+		},
+		{
+			name: "default present field",
+			ops:  []mappingOp{{Op: opDefault, Path: "message.note", Value: "y"}},
+			want: body,
+		},
+		{
+			name: "drop array element field",
+			ops:  []mappingOp{{Op: opDrop, Path: "message.items.0.qty"}},
+			want: `{"context":{"action":"search","bap_id":"bap1"},"message":{"items":[{"id":"i1"}],"note":"x"}}`,
+		},
+		{
+			name: "compute string",
+			ops:  []mappingOp{{Op: opCompute, Path: "message.buyer", Template: "{{.context.bap_id}}"}},
+			want: `{"context":{"action":"search","bap_id":"bap1"},"message":{"buyer":"bap1","items":[{"id":"i1","qty":2}],"note":"x"}}`,
+		},
+		{
+			name: "compute json",
+			ops:  []mappingOp{{Op: opCompute, Path: "message.count", Template: "{{len .message.items}}", JSON: true}},
+			want: `{"context":{"action":"search","bap_id":"bap1"},"message":{"count":1,"items":[{"id":"i1","qty":2}],"note":"x"}}`,
+		},
+		{
+			name:    "compute missing field",
+			ops:     []mappingOp{{Op: opCompute, Path: "message.buyer", Template: "{{.context.bpp_id}}"}},
+			wantErr: true,
+		},
+		{
+			name:    "set through a string",
+			ops:     []mappingOp{{Op: opDefault, Path: "message.note.text", Value: "y"}},
+			wantErr: true,
+		},
+		{
+			name:    "set missing array element",
+			ops:     []mappingOp{{Op: opDefault, Path: "message.items.1.id", Value: "i2"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.ops {
+				if err := tt.ops[i].init(); err != nil {
+					t.Fatalf("init() error = %v", err)
+				}
+			}
+			got, err := apply(tt.ops, []byte(body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingOpInit(t *testing.T) {
+	tests := []struct {
+		name string
+		op   mappingOp
+	}{
+		{name: "rename without to", op: mappingOp{Op: opRename, From: "a"}},
+		{name: "default without value", op: mappingOp{Op: opDefault, Path: "a"}},
+		{name: "drop without path", op: mappingOp{Op: opDrop}},
+		{name: "compute without template", op: mappingOp{Op: opCompute, Path: "a"}},
+		{name: "invalid template", op: mappingOp{Op: opCompute, Path: "a", Template: "{{.a"}},
+		{name: "unknown op", op: mappingOp{Op: "copy", Path: "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op.init(); err == nil {
+				t.Error("init() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestTransformerResponse(t *testing.T) {
+	tr := &transformer{mappings: map[string]*mapping{
+		"search": {Response: []mappingOp{{Op: opDefault, Path: "message.ack.status", Value: "ACK"}}},
+	}}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			model.AuthHeaderSubscriber: {`Signature keyId="bpp1|k1|ed25519"`},
+			model.AuthHeaderGateway:    {`Signature keyId="bg1|k1|ed25519"`},
+		},
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"message":{}}`))),
+	}
+	if err := tr.response("search", resp); err != nil {
+		t.Fatalf("response() error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !jsonEqual(t, body, []byte(`{"message":{"ack":{"status":"ACK"}}}`)) {
+		t.Errorf("body = %s", body)
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(body))
+	}
+	for _, name := range []string{model.AuthHeaderSubscriber, model.AuthHeaderGateway} {
+		if v := resp.Header.Get(name); v != "" {
+			t.Errorf("%s = %q, want it dropped", name, v)
+		}
+	}
+}
+
+// jsonEqual reports whether a and b are the same JSON value.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid json %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid json %s: %v", b, err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
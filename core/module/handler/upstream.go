@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// UpstreamConfig configures the health tracking of weighted route targets.
+type UpstreamConfig struct {
+	// HealthPath is probed with GET on the host of every target, active probing is disabled when empty.
+	HealthPath    string        `yaml:"healthPath"`
+	ProbeInterval time.Duration `yaml:"probeInterval"`
+	ProbeTimeout  time.Duration `yaml:"probeTimeout"`
+	// MaxFails is the number of consecutive 5xx responses or transport errors that eject a target.
+	MaxFails int `yaml:"maxFails"`
+	// EjectFor is how long an ejected target is skipped, unless a probe finds it healthy earlier.
+	EjectFor time.Duration `yaml:"ejectFor"`
+	// Timeout bounds the wait for the response headers of a target, unlimited when zero.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const (
+	defaultProbeInterval = 10 * time.Second
+	defaultProbeTimeout  = 2 * time.Second
+	defaultMaxFails      = 3
+	defaultEjectFor      = 30 * time.Second
+)
+
+// upstream is the health state of a route target.
+type upstream struct {
+	URL          string    `json:"url"`
+	Healthy      bool      `json:"healthy"`
+	Fails        int       `json:"consecutiveFails"`
+	EjectedUntil time.Time `json:"ejectedUntil,omitzero"`
+	LastProbe    time.Time `json:"lastProbe,omitzero"`
+	LastErr      string    `json:"lastError,omitempty"`
+}
+
+// available reports whether requests may be sent to the upstream at now.
+func (u *upstream) available(now time.Time) bool {
+	return u.Healthy && !now.Before(u.EjectedUntil)
+}
+
+// upstreamPool tracks the health of route targets and proxies requests across them.
+type upstreamPool struct {
+	cfg       UpstreamConfig
+	transport http.RoundTripper
+	client    *http.Client
+
+	mu      sync.Mutex
+	targets map[string]*upstream
+}
+
+// upstreams is shared by all handlers, as the health of a target does not depend on the module routing to it.
+// ConfigureUpstreams replaces it while requests may be served, so it is only accessed through Load and Store.
+var upstreams atomic.Pointer[upstreamPool]
+
+func init() {
+	upstreams.Store(newUpstreamPool(UpstreamConfig{}))
+}
+
+// newUpstreamPool creates a pool with the defaults applied to cfg.
+func newUpstreamPool(cfg UpstreamConfig) *upstreamPool {
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout == 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	if cfg.MaxFails == 0 {
+		cfg.MaxFails = defaultMaxFails
+	}
+	if cfg.EjectFor == 0 {
+		cfg.EjectFor = defaultEjectFor
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfg.Timeout
+	return &upstreamPool{
+		cfg:       cfg,
+		transport: transport,
+		client:    &http.Client{Timeout: cfg.ProbeTimeout},
+		targets:   map[string]*upstream{},
+	}
+}
+
+// ConfigureUpstreams applies cfg to the health tracking of route targets and starts
+// probing them when a health path is set. The returned func stops the probing.
+func ConfigureUpstreams(ctx context.Context, cfg *UpstreamConfig) (func(), error) {
+	if cfg.ProbeInterval < 0 || cfg.ProbeTimeout < 0 || cfg.MaxFails < 0 || cfg.EjectFor < 0 || cfg.Timeout < 0 {
+		return nil, fmt.Errorf("invalid config: upstream durations and maxFails cannot be negative")
+	}
+	pool := newUpstreamPool(*cfg)
+	upstreams.Store(pool)
+	if len(cfg.HealthPath) == 0 {
+		return func() {}, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go pool.probeEvery(ctx)
+	log.Infof(ctx, "Probing route targets at %s every %s", cfg.HealthPath, pool.cfg.ProbeInterval)
+	return cancel, nil
+}
+
+// UpstreamsHandler serves the health state of all route targets as JSON.
+var UpstreamsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(upstreams.Load().snapshot()); err != nil {
+		log.Errorf(r.Context(), err, "Error encoding JSON")
+	}
+})
+
+// snapshot returns a copy of the health state of all targets, sorted by URL.
+func (p *upstreamPool) snapshot() []upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := make([]upstream, 0, len(p.targets))
+	for _, u := range p.targets {
+		state = append(state, *u)
+	}
+	sort.Slice(state, func(i, j int) bool { return state[i].URL < state[j].URL })
+	return state
+}
+
+// track returns the health state of target, tracking it from now on. Callers must hold p.mu.
+func (p *upstreamPool) track(target *url.URL) *upstream {
+	key := target.String()
+	u, ok := p.targets[key]
+	if !ok {
+		u = &upstream{URL: key, Healthy: true}
+		p.targets[key] = u
+	}
+	return u
+}
+
+// order returns the targets in the order to try them: available targets picked at random by
+// weight, then available standby targets, then unavailable targets as a last resort.
+func (p *upstreamPool) order(targets []model.Target) []*url.URL {
+	now := time.Now()
+	var weighted []model.Target
+	var standby, unavailable []*url.URL
+	p.mu.Lock()
+	for _, t := range targets {
+		switch {
+		case !p.track(t.URL).available(now):
+			unavailable = append(unavailable, t.URL)
+		case t.Weight == 0:
+			standby = append(standby, t.URL)
+		default:
+			weighted = append(weighted, t)
+		}
+	}
+	p.mu.Unlock()
+
+	order := make([]*url.URL, 0, len(targets))
+	for len(weighted) != 0 {
+		total := 0
+		for _, t := range weighted {
+			total += t.Weight
+		}
+		n := rand.IntN(total)
+		i := 0
+		for ; n >= weighted[i].Weight; i++ {
+			n -= weighted[i].Weight
+		}
+		order = append(order, weighted[i].URL)
+		weighted = append(weighted[:i], weighted[i+1:]...)
+	}
+	order = append(order, standby...)
+	return append(order, unavailable...)
+}
+
+// record updates the health of target with the outcome of a request, ejecting it after MaxFails consecutive failures.
+func (p *upstreamPool) record(ctx context.Context, target *url.URL, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.track(target)
+	if err == nil {
+		u.Fails = 0
+		return
+	}
+	u.Fails++
+	u.LastErr = err.Error()
+	if u.Fails >= p.cfg.MaxFails {
+		u.EjectedUntil = time.Now().Add(p.cfg.EjectFor)
+		log.Errorf(ctx, err, "Ejecting %s for %s after %d consecutive failures", u.URL, p.cfg.EjectFor, u.Fails)
+	}
+}
+
+// upstreamStatusErr is the error for a 5xx response of a target.
+type upstreamStatusErr struct {
+	status string
+}
+
+func (e *upstreamStatusErr) Error() string {
+	return fmt.Sprintf("upstream responded with status: %s", e.status)
+}
+
+// proxy forwards the request to the targets in order, failing over to the next target on a
+// transport error or 5xx response. The response of the last target tried is returned, unless
+// it fails modify, when set, which is answered with 502 Bad Gateway without failing over,
+// as the target already received the request.
+func (p *upstreamPool) proxy(w http.ResponseWriter, r *http.Request, body []byte, targets []model.Target, modify func(*http.Response) error) {
+	order := p.order(targets)
+	for i, target := range order {
+		last := i == len(order)-1
+		var failed error
+		rp := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Scheme = target.Scheme
+				pr.Out.URL.Host = target.Host
+				pr.Out.URL.Path = target.Path
+				pr.Out.URL.RawPath = target.RawPath
+				pr.Out.Host = target.Host
+				pr.SetXForwarded()
+			},
+			Transport: p.transport,
+			ModifyResponse: func(resp *http.Response) error {
+				if resp.StatusCode < http.StatusInternalServerError {
+					p.record(r.Context(), target, nil)
+				} else {
+					err := &upstreamStatusErr{status: resp.Status}
+					p.record(r.Context(), target, err)
+					if !last {
+						return err
+					}
+				}
+				if modify != nil {
+					return modify(resp)
+				}
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+				var statusErr *upstreamStatusErr
+				var rejectedErr *rejectedResponseErr
+				if errors.As(err, &rejectedErr) {
+					log.Errorf(r.Context(), err, "Rejecting response of %s", target)
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				if !errors.As(err, &statusErr) {
+					p.record(r.Context(), target, err)
+				}
+				if !last && r.Context().Err() == nil {
+					failed = err
+					return
+				}
+				log.Errorf(r.Context(), err, "Proxying request to %s failed", target)
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		}
+		req := r.Clone(r.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		log.Infof(r.Context(), "Proxying request to: %s", target)
+		rp.ServeHTTP(w, req)
+		if failed == nil {
+			return
+		}
+		log.Errorf(r.Context(), failed, "Failing over from %s", target)
+	}
+}
+
+// deliver posts body with header to the route URL, or to its targets in order until one
+// acknowledges it, recording the outcome of every target tried.
+func (p *upstreamPool) deliver(ctx context.Context, client *http.Client, route *model.Route, header http.Header, body []byte) error {
+	if len(route.Targets) == 0 {
+		return post(ctx, client, route.URL, header, body)
+	}
+	var err error
+	for _, target := range p.order(route.Targets) {
+		err = post(ctx, client, target, header, body)
+		p.record(ctx, target, err)
+		if err == nil {
+			return nil
+		}
+		log.Errorf(ctx, err, "Failing over from %s", target)
+	}
+	return err
+}
+
+// post sends body with header to target and checks that it was acknowledged.
+func post(ctx context.Context, client *http.Client, target *url.URL, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward request to %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status: %s", target, resp.Status)
+	}
+	var ack model.Response
+	if json.Unmarshal(respBody, &ack) == nil && ack.Message.Ack.Status == model.StatusNACK {
+		return fmt.Errorf("%s responded with NACK", target)
+	}
+	log.Infof(ctx, "Forwarded request to %s", target)
+	return nil
+}
+
+// probeEvery probes all tracked targets every probe interval until ctx is done.
+func (p *upstreamPool) probeEvery(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.probeAll(ctx)
+		}
+	}
+}
+
+// probeAll probes the tracked targets concurrently and updates their health.
+func (p *upstreamPool) probeAll(ctx context.Context) {
+	p.mu.Lock()
+	keys := make([]string, 0, len(p.targets))
+	for key := range p.targets {
+		keys = append(keys, key)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.probe(ctx, key)
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			u := p.targets[key]
+			u.LastProbe = time.Now()
+			if err != nil {
+				if u.Healthy {
+					log.Errorf(ctx, err, "Route target %s is unhealthy", key)
+				}
+				u.Healthy = false
+				u.LastErr = err.Error()
+				return
+			}
+			if !u.Healthy {
+				log.Infof(ctx, "Route target %s is healthy", key)
+			}
+			u.Healthy = true
+			u.Fails = 0
+			u.EjectedUntil = time.Time{}
+		}()
+	}
+	wg.Wait()
+}
+
+// probe calls the health path on the host of the target.
+func (p *upstreamPool) probe(ctx context.Context, target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	healthURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: p.cfg.HealthPath}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check responded with status: %s", resp.Status)
+	}
+	return nil
+}
@@ -20,10 +20,14 @@ type Config struct {
 type handlerProvider func(ctx context.Context, mgr *plugin.Manager, cfg *handler.Config) (http.Handler, error)
 
 var handlerProviders = map[handler.HandlerType]handlerProvider{
-	handler.HandlerTypeStd:    handler.NewStdHandler,
-	handler.HandlerTypeRegSub: handler.NewRegSubscibeHandler,
-	handler.HandlerTypeNPSub:  handler.NewNPSubscibeHandler,
-	handler.HandlerTypeLookup: handler.NewLookHandler,
+	handler.HandlerTypeStd:      handler.NewStdHandler,
+	handler.HandlerTypeRegSub:   handler.NewRegSubscibeHandler,
+	handler.HandlerTypeNPSub:    handler.NewNPSubscibeHandler,
+	handler.HandlerTypeNPOnSub:  handler.NewNPOnSubscribeHandler,
+	handler.HandlerTypeLookup:   handler.NewLookHandler,
+	handler.HandlerTypeConsumer: handler.NewConsumerHandler,
+	handler.HandlerTypeOutbox:   handler.NewOutboxHandler,
+	handler.HandlerTypeSync:     handler.NewSyncHandler,
 }
 
 // AddHandlers registers the handlers for the application.
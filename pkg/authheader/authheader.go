@@ -0,0 +1,220 @@
+// Package authheader parses and formats the Beckn signature Authorization header:
+//
+//	Signature keyId="{subscriber_id}|{unique_key_id}|{algorithm}",algorithm="ed25519",
+//	created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="Base64(...)"
+package authheader
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// scheme is the authentication scheme of the header.
+const scheme = "Signature"
+
+// Signature algorithms, as named in the keyId and algorithm parameters.
+const (
+	// AlgorithmEd25519 is the signature algorithm used in the Beckn network.
+	AlgorithmEd25519 = "ed25519"
+	// AlgorithmECDSAP256SHA256 is ECDSA on P-256 over the SHA-256 digest of the signing string,
+	// with an ASN.1 DER signature and a PKIX DER public key, for keys in HSMs without ed25519.
+	AlgorithmECDSAP256SHA256 = "ecdsa-p256-sha256"
+)
+
+// SignedHeaders are the components of the Beckn signing string, in order.
+var SignedHeaders = []string{"(created)", "(expires)", "digest"}
+
+// paramNames are the parameters of the header, all of which are required.
+var paramNames = []string{"keyId", "algorithm", "created", "expires", "headers", "signature"}
+
+// Header is a parsed signature Authorization header.
+type Header struct {
+	SubscriberID string
+	UniqueKeyID  string
+	// Algorithm is the algorithm of the keyId and of the algorithm parameter, which must agree.
+	Algorithm string
+	Created   int64
+	Expires   int64
+	// Headers lists the components of the signing string.
+	Headers   []string
+	Signature string
+}
+
+// New returns the header for an ed25519 signature over the Beckn signing string.
+func New(subscriberID, uniqueKeyID string, created, expires int64, signature string) *Header {
+	return &Header{
+		SubscriberID: subscriberID,
+		UniqueKeyID:  uniqueKeyID,
+		Algorithm:    AlgorithmEd25519,
+		Created:      created,
+		Expires:      expires,
+		Headers:      SignedHeaders,
+		Signature:    signature,
+	}
+}
+
+// String formats the header value.
+func (h *Header) String() string {
+	return fmt.Sprintf("%s keyId=%s,algorithm=%s,created=\"%d\",expires=\"%d\",headers=%s,signature=%s", scheme,
+		quote(h.SubscriberID+"|"+h.UniqueKeyID+"|"+h.Algorithm), quote(h.Algorithm), h.Created, h.Expires,
+		quote(strings.Join(h.Headers, " ")), quote(h.Signature))
+}
+
+// SigningString returns the Beckn signing string of body, over SignedHeaders with a BLAKE-512 digest.
+func SigningString(body []byte, created, expires int64) string {
+	digest := blake2b.Sum512(body)
+	return fmt.Sprintf("(created): %d\n(expires): %d\ndigest: BLAKE-512=%s", created, expires,
+		base64.StdEncoding.EncodeToString(digest[:]))
+}
+
+// Challenge returns the WWW-Authenticate header value asking for a signature over SignedHeaders,
+// with realm when it is not empty.
+func Challenge(realm string) string {
+	if len(realm) == 0 {
+		return fmt.Sprintf("%s headers=%s", scheme, quote(strings.Join(SignedHeaders, " ")))
+	}
+	return fmt.Sprintf("%s realm=%s,headers=%s", scheme, quote(realm), quote(strings.Join(SignedHeaders, " ")))
+}
+
+// Parse parses a signature header value. Parameters may appear in any order, separated by commas
+// with optional whitespace, and their values must be quoted strings, in which a backslash escapes
+// the next character. Every parameter is required, exactly once, and no other parameter is allowed.
+func Parse(value string) (*Header, error) {
+	rest, ok := strings.CutPrefix(value, scheme+" ")
+	if !ok {
+		return nil, fmt.Errorf("%w: expected %q scheme", ErrMalformed, scheme)
+	}
+	params, err := parseParams(rest)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range paramNames {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingParam, name)
+		}
+	}
+
+	h := &Header{Signature: params["signature"]}
+	keyID := strings.Split(params["keyId"], "|")
+	if len(keyID) != 3 || slices.Contains(keyID, "") {
+		return nil, fmt.Errorf("%w: keyId %q is not subscriber_id|unique_key_id|algorithm", ErrInvalidParam, params["keyId"])
+	}
+	h.SubscriberID, h.UniqueKeyID, h.Algorithm = keyID[0], keyID[1], keyID[2]
+	if params["algorithm"] != h.Algorithm {
+		return nil, fmt.Errorf("%w: algorithm %q does not match keyId algorithm %q", ErrInvalidParam, params["algorithm"], h.Algorithm)
+	}
+	if h.Created, err = parseTimestamp("created", params["created"]); err != nil {
+		return nil, err
+	}
+	if h.Expires, err = parseTimestamp("expires", params["expires"]); err != nil {
+		return nil, err
+	}
+	if h.Headers = strings.Fields(params["headers"]); len(h.Headers) == 0 {
+		return nil, fmt.Errorf("%w: headers is empty", ErrInvalidParam)
+	}
+	if len(h.Signature) == 0 {
+		return nil, fmt.Errorf("%w: signature is empty", ErrInvalidParam)
+	}
+	return h, nil
+}
+
+// parseParams parses the comma separated name="value" parameters of the header.
+func parseParams(s string) (map[string]string, error) {
+	params := map[string]string{}
+	i := 0
+	for {
+		i = skipSpace(s, i)
+		start := i
+		for i < len(s) && isTokenChar(s[i]) {
+			i++
+		}
+		if start == i {
+			return nil, fmt.Errorf("%w: expected parameter name at offset %d", ErrMalformed, start)
+		}
+		name := s[start:i]
+		i = skipSpace(s, i)
+		if i == len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("%w: expected '=' after %s at offset %d", ErrMalformed, name, i)
+		}
+		i = skipSpace(s, i+1)
+		value, next, err := parseQuoted(s, i)
+		if err != nil {
+			return nil, fmt.Errorf("%w: value of %s: %w", ErrMalformed, name, err)
+		}
+		if _, ok := params[name]; ok {
+			return nil, fmt.Errorf("%w: %s given more than once", ErrInvalidParam, name)
+		}
+		if !slices.Contains(paramNames, name) {
+			return nil, fmt.Errorf("%w: unknown parameter %s", ErrInvalidParam, name)
+		}
+		params[name] = value
+		i = skipSpace(s, next)
+		if i == len(s) {
+			return params, nil
+		}
+		if s[i] != ',' {
+			return nil, fmt.Errorf("%w: expected ',' at offset %d", ErrMalformed, i)
+		}
+		i++
+	}
+}
+
+// parseQuoted parses the quoted string at s[i:], returning its unescaped value and the offset after it.
+func parseQuoted(s string, i int) (string, int, error) {
+	if i == len(s) || s[i] != '"' {
+		return "", i, fmt.Errorf("expected '\"' at offset %d", i)
+	}
+	var b strings.Builder
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i++; i == len(s) {
+				return "", i, fmt.Errorf("unterminated escape at offset %d", i-1)
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", i, fmt.Errorf("unterminated quoted string")
+}
+
+// parseTimestamp parses a unix timestamp parameter.
+func parseTimestamp(name, value string) (int64, error) {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts < 0 {
+		return 0, fmt.Errorf("%w: %s %q is not a unix timestamp", ErrInvalidParam, name, value)
+	}
+	return ts, nil
+}
+
+// quote returns s as a quoted string, escaping quotes and backslashes.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// skipSpace returns the offset of the first character at or after i that is not a space or tab.
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// isTokenChar reports whether c may appear in a parameter name.
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_'
+}
+
+// Error definitions.
+var (
+	ErrMalformed    = errors.New("malformed signature header")
+	ErrMissingParam = errors.New("signature header parameter missing")
+	ErrInvalidParam = errors.New("invalid signature header parameter")
+)
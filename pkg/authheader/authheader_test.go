@@ -0,0 +1,129 @@
+package authheader
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := &Header{
+		SubscriberID: "bap1.example.com",
+		UniqueKeyID:  "k1",
+		Algorithm:    AlgorithmEd25519,
+		Created:      1606970629,
+		Expires:      1607030629,
+		Headers:      SignedHeaders,
+		Signature:    "c2ln",
+	}
+	tests := []struct {
+		name    string
+		value   string
+		want    *Header
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			value: `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			want:  valid,
+		},
+		{
+			name:  "any order and whitespace",
+			value: "Signature signature=\"c2ln\" , headers = \"(created) (expires) digest\",\texpires=\"1607030629\",created=\"1606970629\",algorithm=\"ed25519\",keyId=\"bap1.example.com|k1|ed25519\"",
+			want:  valid,
+		},
+		{
+			name:  "escaped characters",
+			value: `Signature keyId="bap1.example.com|k\1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			want:  valid,
+		},
+		{
+			name:  "comma in quoted value",
+			value: `Signature keyId="bap1,example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			want:  &Header{SubscriberID: "bap1,example.com", UniqueKeyID: "k1", Algorithm: AlgorithmEd25519, Created: 1606970629, Expires: 1607030629, Headers: SignedHeaders, Signature: "c2ln"},
+		},
+		{
+			name:    "other scheme",
+			value:   `Bearer keyId="bap1.example.com|k1|ed25519"`,
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "unquoted value",
+			value:   `Signature keyId=bap1.example.com|k1|ed25519,algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "unterminated value",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln`,
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "trailing comma",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln",`,
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "missing parameter",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",signature="c2ln"`,
+			wantErr: ErrMissingParam,
+		},
+		{
+			name:    "duplicate parameter",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",keyId="bap2.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			wantErr: ErrInvalidParam,
+		},
+		{
+			name:    "unknown parameter",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln",realm="x"`,
+			wantErr: ErrInvalidParam,
+		},
+		{
+			name:    "keyId without algorithm",
+			value:   `Signature keyId="bap1.example.com|k1",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			wantErr: ErrInvalidParam,
+		},
+		{
+			name:    "algorithm mismatch",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ecdsa-p256-sha256",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			wantErr: ErrInvalidParam,
+		},
+		{
+			name:    "invalid timestamp",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="-1",expires="1607030629",headers="(created) (expires) digest",signature="c2ln"`,
+			wantErr: ErrInvalidParam,
+		},
+		{
+			name:    "empty signature",
+			value:   `Signature keyId="bap1.example.com|k1|ed25519",algorithm="ed25519",created="1606970629",expires="1607030629",headers="(created) (expires) digest",signature=""`,
+			wantErr: ErrInvalidParam,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	h := New(`bap"1\x`, "k1", 1606970629, 1607030629, "c2ln")
+	got, err := Parse(h.String())
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", h.String(), err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("Parse(String()) = %+v, want %+v", got, h)
+	}
+}
@@ -0,0 +1,151 @@
+// Package keyring holds the key management shared by the KeyManager plugins: the rotation of
+// the keysets of a subscriber and the resolution of public keys through the cache, the keysets
+// of the subscriber itself and the registry.
+package keyring
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+)
+
+// publicKeysTTL is the longest time public keys are cached for.
+const publicKeysTTL = time.Hour
+
+// Rotate returns the keysets of a subscriber after keys became the active keyset: keys first,
+// then the keysets of ring that are still valid. Keysets without ValidUntil, i.e. the keyset
+// active until now, stay valid until grace after now.
+func Rotate(ring []definition.Keyset, keys *definition.Keyset, grace time.Duration, now time.Time) []definition.Keyset {
+	rotated := []definition.Keyset{*keys}
+	for _, k := range ring {
+		if k.ValidUntil.IsZero() {
+			k.ValidUntil = now.Add(grace)
+		}
+		if k.ValidUntil.After(now) {
+			rotated = append(rotated, k)
+		}
+	}
+	return rotated
+}
+
+// Find returns the keyset of ring with uniqueKeyID, with its public keys derived from its private keys.
+func Find(ring []definition.Keyset, uniqueKeyID string, now time.Time) (*definition.Keyset, error) {
+	for _, k := range ring {
+		if k.UniqueKeyID != uniqueKeyID {
+			continue
+		}
+		if !k.ValidUntil.IsZero() && !now.Before(k.ValidUntil) {
+			return nil, ErrKeyExpired
+		}
+		if err := SetPublicKeys(&k); err != nil {
+			return nil, err
+		}
+		return &k, nil
+	}
+	return nil, ErrKeysetNotFound
+}
+
+// SetPublicKeys derives the public keys of the keyset from its private keys.
+func SetPublicKeys(keys *definition.Keyset) error {
+	signingPrivate, err := base64.StdEncoding.DecodeString(keys.SigningPrivate)
+	if err != nil || len(signingPrivate) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid signing private key of %s", keys.UniqueKeyID)
+	}
+	encrPrivate, err := base64.StdEncoding.DecodeString(keys.EncrPrivate)
+	if err != nil {
+		return fmt.Errorf("invalid encryption private key of %s: %w", keys.UniqueKeyID, err)
+	}
+	encrKey, err := ecdh.X25519().NewPrivateKey(encrPrivate)
+	if err != nil {
+		return fmt.Errorf("invalid encryption private key of %s: %w", keys.UniqueKeyID, err)
+	}
+	keys.SigningPublic = base64.StdEncoding.EncodeToString(ed25519.PrivateKey(signingPrivate).Public().(ed25519.PublicKey))
+	keys.EncrPublic = base64.StdEncoding.EncodeToString(encrKey.PublicKey().Bytes())
+	return nil
+}
+
+// PublicKeys resolves the public keys of subscribers.
+type PublicKeys struct {
+	Cache    definition.Cache
+	Registry definition.RegistryLookup
+	// Local returns a keyset the key manager holds for the subscriber, so that keysets retained
+	// after a rotation are found before the registry lists them.
+	Local func(ctx context.Context, subscriberID, uniqueKeyID string) (*definition.Keyset, error)
+}
+
+// Get returns the public keys of the subscriber's key from the cache, the key manager's own
+// keysets or the registry, caching them for at most an hour and no longer than they are valid.
+func (p *PublicKeys) Get(ctx context.Context, subscriberID, uniqueKeyID string) (*definition.Keyset, error) {
+	if subscriberID == "" {
+		return nil, ErrEmptySubscriberID
+	}
+	if uniqueKeyID == "" {
+		return nil, ErrEmptyUniqueKeyID
+	}
+
+	cacheKey := fmt.Sprintf("%s_%s", subscriberID, uniqueKeyID)
+	if cached, err := p.Cache.Get(ctx, cacheKey); err == nil {
+		var keys definition.Keyset
+		if err := json.Unmarshal([]byte(cached), &keys); err == nil {
+			return &keys, nil
+		}
+	}
+
+	var publicKeys *definition.Keyset
+	if keys, err := p.Local(ctx, subscriberID, uniqueKeyID); err == nil {
+		publicKeys = &definition.Keyset{SigningPublic: keys.SigningPublic, EncrPublic: keys.EncrPublic, ValidUntil: keys.ValidUntil}
+	} else if publicKeys, err = p.lookupRegistry(ctx, subscriberID, uniqueKeyID); err != nil {
+		return nil, err
+	}
+
+	ttl := publicKeysTTL
+	if !publicKeys.ValidUntil.IsZero() {
+		ttl = min(ttl, time.Until(publicKeys.ValidUntil))
+	}
+	if data, err := json.Marshal(publicKeys); err == nil && ttl > 0 {
+		if err := p.Cache.Set(ctx, cacheKey, string(data), ttl); err != nil {
+			log.Errorf(ctx, err, "Failed to cache public keys for %s", cacheKey)
+		}
+	}
+	return publicKeys, nil
+}
+
+// lookupRegistry returns the public keys of the subscription of the subscriber's key. Only a
+// subscription of the requested subscriber and key is used, whatever else the registry returned.
+func (p *PublicKeys) lookupRegistry(ctx context.Context, subscriberID, uniqueKeyID string) (*definition.Keyset, error) {
+	subs, err := p.Registry.Lookup(ctx, &model.Subscription{
+		Subscriber: model.Subscriber{SubscriberID: subscriberID},
+		KeyID:      uniqueKeyID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup registry: %w", err)
+	}
+	for _, sub := range subs {
+		if sub.SubscriberID == subscriberID && sub.KeyID == uniqueKeyID {
+			return &definition.Keyset{
+				SigningPublic: sub.SigningPublicKey,
+				EncrPublic:    sub.EncrPublicKey,
+				ValidUntil:    sub.ValidUntil,
+			}, nil
+		}
+	}
+	return nil, ErrSubscriberNotFound
+}
+
+// Error definitions.
+var (
+	ErrEmptySubscriberID  = errors.New("invalid request: subscriberID cannot be empty")
+	ErrEmptyUniqueKeyID   = errors.New("invalid request: uniqueKeyID cannot be empty")
+	ErrKeysetNotFound     = errors.New("no keyset found with given uniqueKeyID")
+	ErrKeyExpired         = errors.New("keyset expired")
+	ErrSubscriberNotFound = errors.New("no subscriber found with given credentials")
+)
@@ -2,14 +2,23 @@ package model
 
 import (
 	"fmt"
-	"net/http"
 	"strings"
 )
 
+// Beckn error types, see Error.Type.
+const (
+	ErrorTypeContext    string = "CONTEXT-ERROR"
+	ErrorTypeCore       string = "CORE-ERROR"
+	ErrorTypeDomain     string = "DOMAIN-ERROR"
+	ErrorTypePolicy     string = "POLICY-ERROR"
+	ErrorTypeJSONSchema string = "JSON-SCHEMA-ERROR"
+)
+
 // Error represents an error response.
 type Error struct {
+	Type    string `json:"type,omitempty"`
 	Code    string `json:"code"`
-	Paths   string `json:"paths,omitempty"`
+	Paths   string `json:"path,omitempty"`
 	Message string `json:"message"`
 }
 
@@ -35,7 +44,7 @@ func (e *SchemaValidationErr) Error() string {
 func (e *SchemaValidationErr) BecknError() *Error {
 	if len(e.Errors) == 0 {
 		return &Error{
-			Code:    http.StatusText(http.StatusBadRequest),
+			Type:    ErrorTypeJSONSchema,
 			Message: "Schema validation error.",
 		}
 	}
@@ -51,7 +60,7 @@ func (e *SchemaValidationErr) BecknError() *Error {
 	}
 
 	return &Error{
-		Code:    http.StatusText(http.StatusBadRequest),
+		Type:    ErrorTypeJSONSchema,
 		Paths:   strings.Join(paths, ";"),
 		Message: strings.Join(messages, "; "),
 	}
@@ -72,7 +81,7 @@ func NewSignValidationErr(e error) *SignValidationErr {
 
 func (e *SignValidationErr) BecknError() *Error {
 	return &Error{
-		Code:    http.StatusText(http.StatusUnauthorized),
+		Type:    ErrorTypePolicy,
 		Message: "Signature Validation Error: " + e.Error(),
 	}
 }
@@ -92,7 +101,7 @@ func NewBadReqErrf(format string, a ...any) *BadReqErr {
 
 func (e *BadReqErr) BecknError() *Error {
 	return &Error{
-		Code:    http.StatusText(http.StatusBadRequest),
+		Type:    ErrorTypeContext,
 		Message: "BAD Request: " + e.Error(),
 	}
 }
@@ -112,7 +121,27 @@ func NewNotFoundErrf(format string, a ...any) *NotFoundErr {
 
 func (e *NotFoundErr) BecknError() *Error {
 	return &Error{
-		Code:    http.StatusText(http.StatusNotFound),
+		Type:    ErrorTypeContext,
 		Message: "Endpoint not found: " + e.Error(),
 	}
 }
+
+// ReplayErr represents a signed request received again within the validity of its signature.
+type ReplayErr struct {
+	error
+}
+
+func NewReplayErr(err error) *ReplayErr {
+	return &ReplayErr{err}
+}
+
+func NewReplayErrf(format string, a ...any) *ReplayErr {
+	return &ReplayErr{fmt.Errorf(format, a...)}
+}
+
+func (e *ReplayErr) BecknError() *Error {
+	return &Error{
+		Type:    ErrorTypePolicy,
+		Message: "Replayed Request: " + e.Error(),
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -14,6 +15,7 @@ type Subscriber struct {
 	URL          string `json:"url" format:"uri"`
 	Type         string `json:"type" enum:"BAP,BPP,BG"`
 	Domain       string `json:"domain"`
+	City         string `json:"city"`
 }
 
 // SubscriptionDetails represents subscription details of a Network Participant.
@@ -28,6 +30,44 @@ type Subscription struct {
 	Created          time.Time `json:"created" format:"date-time"`
 	Updated          time.Time `json:"updated" format:"date-time"`
 	Nonce            string
+	// RequestID identifies the subscribe request, which the registry echoes in its on_subscribe challenge.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Subscription statuses, see Subscription.Status.
+const (
+	SubscriptionStatusInitiated         string = "INITIATED"
+	SubscriptionStatusUnderSubscription string = "UNDER_SUBSCRIPTION"
+	SubscriptionStatusSubscribed        string = "SUBSCRIBED"
+	SubscriptionStatusExpired           string = "EXPIRED"
+	SubscriptionStatusUnsubscribed      string = "UNSUBSCRIBED"
+	SubscriptionStatusInvalidSSL        string = "INVALID_SSL"
+)
+
+// OnSubscribeRequest is sent by the registry, signed with its signing key, to a subscriber's
+// on_subscribe endpoint to verify that it holds the private key of the encryption public key
+// it subscribed with.
+type OnSubscribeRequest struct {
+	SubscriberID string `json:"subscriber_id"`
+	// KeyID and RequestID identify the subscribe request the challenge is for.
+	KeyID     string `json:"key_id"`
+	RequestID string `json:"request_id"`
+	// Challenge is sealed for the subscribed encryption key with the registry's encryption key.
+	Challenge string `json:"challenge"`
+}
+
+// OnSubscribeResponse carries the decrypted challenge back to the registry.
+type OnSubscribeResponse struct {
+	Answer string `json:"answer"`
+}
+
+// EncryptedMessage replaces the message of a request encrypted by the encrypt step. It names
+// the keys it was encrypted with, so that the recipient decrypts it with the keys of the sender
+// and the recipient that were current when it was sent.
+type EncryptedMessage struct {
+	SenderKeyID    string `json:"sender_key_id"`
+	RecipientKeyID string `json:"recipient_key_id"`
+	EncryptedData  string `json:"encrypted_data"`
 }
 
 const (
@@ -35,8 +75,22 @@ const (
 	AuthHeaderGateway             string = "X-Gateway-Authorization"
 	UnaAuthorizedHeaderSubscriber string = "WWW-Authenticate"
 	UnaAuthorizedHeaderGateway    string = "Proxy-Authenticate"
+	// LookupNonceHeader carries the nonce of a lookup request, which the registry signs with its response.
+	LookupNonceHeader string = "X-Lookup-Nonce"
+	// NextOffsetHeader carries the offset of the next page of a lookup response that has more subscriptions.
+	NextOffsetHeader string = "X-Next-Offset"
 )
 
+// LookupSigningPayload returns the payload the registry signs for a lookup response body, binding
+// it to the nonce of the lookup request so that a signed response cannot be replayed for another
+// request, and to the offset of the next page so that pages cannot be dropped.
+func LookupSigningPayload(nonce, nextOffset string, body []byte) []byte {
+	if len(nonce) == 0 {
+		return body
+	}
+	return append([]byte(nonce+"\n"+nextOffset+"\n"), body...)
+}
+
 const MsgIDKey = "message_id"
 
 type Role string
@@ -56,6 +110,11 @@ var validRoles = map[Role]bool{
 	RoleRegistery: true,
 }
 
+// Valid reports whether r is an allowed role.
+func (r Role) Valid() bool {
+	return validRoles[r]
+}
+
 // Custom YAML unmarshalling to validate Role names
 func (r *Role) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var roleName string
@@ -75,8 +134,52 @@ type Route struct {
 	Type      string
 	URL       *url.URL
 	Publisher string
+	// Targets lists weighted URLs to balance and fail over between, URL is the first of them.
+	Targets []Target
+}
+
+// Target is a weighted URL of a route.
+type Target struct {
+	URL *url.URL
+	// Weight is the share of requests sent to the URL, zero for a standby used only on failover.
+	Weight int
+}
+
+// Delivery records the outcome of forwarding a request to a single subscriber.
+type Delivery struct {
+	SubscriberID string
+	URL          string
+	StatusCode   int
+	Err          error
 }
 
+// OutboxEntry is an outbound request held in the outbox until it is delivered.
+type OutboxEntry struct {
+	// ID identifies the delivery of the message_id and action to the route targets, so that
+	// a request is held once per destination.
+	ID           string `json:"id"`
+	MessageID    string `json:"message_id"`
+	Action       string `json:"action"`
+	SubscriberID string `json:"subscriber_id"`
+	// URLs are the route targets, with their Weights when the route has several.
+	URLs        []string        `json:"urls"`
+	Weights     []int           `json:"weights,omitempty"`
+	Header      http.Header     `json:"header"`
+	Body        json.RawMessage `json:"body"`
+	Status      string          `json:"status" enum:"PENDING,DEAD"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt" format:"date-time"`
+	LastError   string          `json:"last_error,omitempty"`
+	Created     time.Time       `json:"created" format:"date-time"`
+	Updated     time.Time       `json:"updated" format:"date-time"`
+}
+
+// Outbox entry statuses, see OutboxEntry.Status.
+const (
+	OutboxStatusPending string = "PENDING"
+	OutboxStatusDead    string = "DEAD"
+)
+
 type StepContext struct {
 	context.Context
 	Request    *http.Request
@@ -85,6 +188,9 @@ type StepContext struct {
 	SubID      string
 	Role       Role
 	RespHeader http.Header
+	Deliveries []Delivery
+	// Undo reverts the effects of the steps run so far, it is called when the request fails.
+	Undo []func(context.Context)
 }
 
 func (ctx *StepContext) WithContext(newCtx context.Context) {
@@ -106,11 +212,13 @@ type Ack struct {
 
 // Message represents the message object in the response.
 type Message struct {
-	Ack   Ack    `json:"ack"`
-	Error *Error `json:"error,omitempty"`
+	Ack Ack `json:"ack"`
 }
 
-// Response represents the main response structure.
+// Response represents the main response structure. NACK responses echo the context
+// of the request and describe the error.
 type Response struct {
-	Message Message `json:"message"`
+	Context json.RawMessage `json:"context,omitempty"`
+	Message Message         `json:"message"`
+	Error   *Error          `json:"error,omitempty"`
 }
@@ -13,6 +13,10 @@ type Cache interface {
 	// Set stores a value in the cache with the given key and TTL (time-to-live) in seconds.
 	Set(ctx context.Context, key, value string, ttl time.Duration) error
 
+	// SetIfAbsent atomically stores a value with the given key and TTL unless the key exists,
+	// reporting whether it was stored.
+	SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+
 	// Delete removes a value from the cache based on the given key.
 	Delete(ctx context.Context, key string) error
 
@@ -2,10 +2,15 @@ package definition
 
 import "context"
 
+// Decryptor defines the method for decrypting payloads from a counterparty.
 type Decryptor interface {
-	Encrypt(ctx context.Context, b []byte) []byte
+	// Decrypt decrypts the base64 encoded ciphertext with the key agreed between
+	// privateKeyBase64 and the counterparty's publicKeyBase64.
+	Decrypt(ctx context.Context, encryptedData string, privateKeyBase64, publicKeyBase64 string) ([]byte, error)
 }
 
+// DecryptorProvider initializes a new decryptor instance with the given config.
 type DecryptorProvider interface {
-	New(ctx context.Context, cfg map[string]string) (Decryptor, error)
+	// New creates a new decryptor instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (Decryptor, func() error, error)
 }
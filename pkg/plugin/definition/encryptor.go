@@ -2,11 +2,15 @@ package definition
 
 import "context"
 
+// Encryptor defines the method for encrypting payloads for a counterparty.
 type Encryptor interface {
-	Encrypt(ctx context.Context, b []byte) []byte
-	Close() error // Close for releasing resources
+	// Encrypt encrypts data with the key agreed between privateKeyBase64 and the
+	// counterparty's publicKeyBase64, returning the base64 encoded ciphertext.
+	Encrypt(ctx context.Context, data []byte, privateKeyBase64, publicKeyBase64 string) (string, error)
 }
 
+// EncryptorProvider initializes a new encryptor instance with the given config.
 type EncryptorProvider interface {
-	New(ctx context.Context, cfg map[string]string) (Encryptor, error)
+	// New creates a new encryptor instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (Encryptor, func() error, error)
 }
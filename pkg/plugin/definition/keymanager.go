@@ -2,6 +2,7 @@ package definition
 
 import (
 	"context"
+	"time"
 )
 
 type Keyset struct {
@@ -10,14 +11,26 @@ type Keyset struct {
 	SigningPublic  string
 	EncrPrivate    string
 	EncrPublic     string
+	// ValidUntil is set on keysets retained after a rotation, zero for the active keyset.
+	ValidUntil time.Time
 }
 
 // KeyManager defines the interface for key management operations/methods.
 type KeyManager interface {
 	GenerateKeyPairs() (*Keyset, error)
 	StorePrivateKeys(ctx context.Context, keyID string, keys *Keyset) error
+	// RotatePrivateKeys makes keys the active keyset for keyID and retains the
+	// previously active keyset until the grace period has elapsed.
+	RotatePrivateKeys(ctx context.Context, keyID string, keys *Keyset, grace time.Duration) error
+	// SigningPrivateKey returns the unique key id and the signing private key of the active keyset.
 	SigningPrivateKey(ctx context.Context, keyID string) (string, string, error)
+	// EncrPrivateKey returns the unique key id and the encryption private key of the active keyset.
 	EncrPrivateKey(ctx context.Context, keyID string) (string, string, error)
+	// Keyset returns the keyset of keyID with uniqueKeyID, the active keyset or a previous one
+	// retained until its ValidUntil, with its public keys.
+	Keyset(ctx context.Context, keyID, uniqueKeyID string) (*Keyset, error)
+	// SigningPublicKey and EncrPublicKey resolve the keys of the subscriber's own keysets,
+	// including those retained after a rotation, and of other subscribers from the registry.
 	SigningPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error)
 	EncrPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error)
 	DeletePrivateKeys(ctx context.Context, keyID string) error
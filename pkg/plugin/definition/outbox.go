@@ -0,0 +1,37 @@
+package definition
+
+import (
+	"context"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// Outbox defines the persistent storage of outbound requests waiting to be delivered.
+// Entries are identified by their id, see model.OutboxEntry.ID.
+type Outbox interface {
+	// Add stores a new entry, returning false without changing the outbox if an entry
+	// with the same id already exists.
+	Add(ctx context.Context, entry *model.OutboxEntry) (bool, error)
+
+	// Due returns up to limit pending entries whose next attempt is not after now, oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]model.OutboxEntry, error)
+
+	// Update replaces an existing entry.
+	Update(ctx context.Context, entry *model.OutboxEntry) error
+
+	// Delete removes the entry with the id.
+	Delete(ctx context.Context, id string) error
+
+	// List returns the entries with the status, or all entries when status is empty.
+	List(ctx context.Context, status string) ([]model.OutboxEntry, error)
+
+	// Purge removes the dead entries last updated before the given time and returns their number.
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// OutboxProvider initializes a new outbox instance with the given config.
+type OutboxProvider interface {
+	// New creates a new outbox instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (Outbox, func() error, error)
+}
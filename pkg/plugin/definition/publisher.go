@@ -2,8 +2,6 @@ package definition
 
 import (
 	"context"
-
-	"google.golang.org/api/option"
 )
 
 type Publisher interface {
@@ -13,5 +11,5 @@ type Publisher interface {
 
 type PublisherProvider interface {
 	// New initializes a new publisher instance with the given configuration
-	New(ctx context.Context, config map[string]string, opts ...option.ClientOption) (Publisher, func(), error)
+	New(ctx context.Context, config map[string]string) (Publisher, func() error, error)
 }
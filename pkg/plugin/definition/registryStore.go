@@ -0,0 +1,33 @@
+package definition
+
+import (
+	"context"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// RegistryStore defines the persistent storage of network participant subscriptions.
+// Subscriptions are identified by their subscriber id and key id.
+type RegistryStore interface {
+	// Create stores a new subscription, failing if it already exists.
+	Create(ctx context.Context, sub *model.Subscription) error
+
+	// Get returns the subscription for the subscriber and key id, or the most
+	// recently updated subscription of the subscriber when keyID is empty.
+	Get(ctx context.Context, subscriberID, keyID string) (*model.Subscription, error)
+
+	// Update replaces an existing subscription.
+	Update(ctx context.Context, sub *model.Subscription) error
+
+	// Delete removes the subscription for the subscriber and key id.
+	Delete(ctx context.Context, subscriberID, keyID string) error
+
+	// List returns the subscriptions matching the non empty fields of filter.
+	List(ctx context.Context, filter *model.Subscription) ([]model.Subscription, error)
+}
+
+// RegistryStoreProvider initializes a new registry store instance with the given config.
+type RegistryStoreProvider interface {
+	// New creates a new registry store instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (RegistryStore, func() error, error)
+}
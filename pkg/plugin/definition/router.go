@@ -12,5 +12,5 @@ type Router interface {
 }
 
 type RouterProvider interface {
-	New(ctx context.Context, cfg map[string]string) (Router, error)
+	New(ctx context.Context, cfg map[string]string) (Router, func() error, error)
 }
@@ -1,6 +1,9 @@
 package definition
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // SignValidator defines the method for verifying signatures.
 type SignValidator interface {
@@ -8,6 +11,13 @@ type SignValidator interface {
 	Validate(ctx context.Context, body []byte, header string, publicKeyBase64 string) error
 }
 
+// SkewTolerant is implemented by sign validators that accept signatures outside their validity
+// period by up to a clock skew, so that replay protection covers the extended period.
+type SkewTolerant interface {
+	// AllowedSkew returns the clock skew tolerated before created and after expires.
+	AllowedSkew() time.Duration
+}
+
 // SignValidatorProvider initializes a new Verifier instance with the given config.
 type SignValidatorProvider interface {
 	// New creates a new Verifier instance based on the provided config.
@@ -21,3 +21,17 @@ type PrivateKeyManager interface {
 	// PrivateKey retrieves the private key for the given subscriberID and keyID.
 	PrivateKey(ctx context.Context, subscriberID string, keyID string) (string, error)
 }
+
+// RemoteSigner signs by key reference with private keys it holds, e.g. in an HSM or a KMS,
+// so that the key material is never returned to the caller.
+type RemoteSigner interface {
+	// Sign signs data with the signing key of subscriberID, returning the unique key id of the key,
+	// its algorithm as named in the signature header, and the base64 encoded signature.
+	Sign(ctx context.Context, subscriberID string, data []byte) (uniqueKeyID, algorithm, signature string, err error)
+}
+
+// RemoteSignerProvider initializes a new remote signer instance with the given config.
+type RemoteSignerProvider interface {
+	// New creates a new remote signer instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (RemoteSigner, func() error, error)
+}
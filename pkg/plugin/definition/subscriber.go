@@ -0,0 +1,27 @@
+package definition
+
+import (
+	"context"
+)
+
+// Message is a message received from a topic.
+type Message struct {
+	ID         string
+	Data       []byte
+	Attributes map[string]string
+	// Attempt is the delivery attempt of the message, starting at 1, or 0 when the broker does not track it.
+	Attempt int
+}
+
+// Subscriber defines the method for consuming messages from a topic.
+type Subscriber interface {
+	// Subscribe calls handle for every message received on topic until ctx is done or the subscriber is closed.
+	// A message is acknowledged when handle returns nil and negatively acknowledged for redelivery otherwise.
+	Subscribe(ctx context.Context, topic string, handle func(context.Context, *Message) error) error
+}
+
+// SubscriberProvider initializes a new subscriber instance with the given config.
+type SubscriberProvider interface {
+	// New creates a new subscriber instance based on the provided config.
+	New(ctx context.Context, config map[string]string) (Subscriber, func() error, error)
+}
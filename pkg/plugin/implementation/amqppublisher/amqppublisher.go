@@ -0,0 +1,154 @@
+package amqppublisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Config holds the AMQP publisher configuration.
+type Config struct {
+	URL string
+	// Exchange receives the messages, the default exchange routes them to the queue named by the routing key.
+	Exchange string
+	// RoutingKey is used when a message is published without a topic.
+	RoutingKey string
+	// Timeout bounds waiting for the broker to confirm a published message.
+	Timeout time.Duration
+}
+
+// defaultTimeout is the confirm timeout used when not configured.
+const defaultTimeout = 10 * time.Second
+
+// Channel publishes messages with publisher confirms, New wraps an *amqp.Channel in confirm mode.
+type Channel interface {
+	// Publish sends msg and returns its pending confirmation, nil when confirms are not enabled.
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (Confirmation, error)
+	Close() error
+}
+
+// Confirmation is the pending broker confirmation of a message, it is implemented by *amqp.DeferredConfirmation.
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// amqpChannel adapts *amqp.Channel to Channel.
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+func (c amqpChannel) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (Confirmation, error) {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil || confirm == nil {
+		return nil, err
+	}
+	return confirm, nil
+}
+
+// Publisher publishes messages to an AMQP exchange such as RabbitMQ.
+type Publisher struct {
+	channel Channel
+	config  *Config
+}
+
+// Error definitions.
+var (
+	ErrEmptyConfig        = errors.New("empty config")
+	ErrURLMissing         = errors.New("missing required field 'URL'")
+	ErrRoutingKeyMissing  = errors.New("missing routing key")
+	ErrChannelEmpty       = errors.New("nil channel")
+	ErrPublishNotAcked    = errors.New("message not acknowledged by broker")
+	ErrConfirmUnavailable = errors.New("publisher confirms not enabled")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil {
+		return ErrEmptyConfig
+	}
+	if strings.TrimSpace(cfg.URL) == "" {
+		return ErrURLMissing
+	}
+	return nil
+}
+
+// New connects to the configured broker, opens a channel in confirm mode and returns
+// the Publisher and its close function.
+func New(ctx context.Context, cfg *Config) (*Publisher, func() error, error) {
+	if err := validate(cfg); err != nil {
+		return nil, nil, err
+	}
+	conn, err := amqp.Dial(cfg.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to amqp broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to open amqp channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	p, closeChannel, err := NewWithChannel(cfg, amqpChannel{ch})
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return p, func() error {
+		return errors.Join(closeChannel(), conn.Close())
+	}, nil
+}
+
+// NewWithChannel creates a Publisher using ch, which lets a local broker stand-in replace AMQP.
+func NewWithChannel(cfg *Config, ch Channel) (*Publisher, func() error, error) {
+	if cfg == nil {
+		return nil, nil, ErrEmptyConfig
+	}
+	if ch == nil {
+		return nil, nil, ErrChannelEmpty
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Publisher{channel: ch, config: cfg}, ch.Close, nil
+}
+
+// Publish sends msg as a persistent message to the exchange with topic as routing key,
+// or the configured routing key when topic is empty, and waits for the broker to confirm it.
+func (p *Publisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	if len(topic) == 0 {
+		topic = p.config.RoutingKey
+	}
+	if len(topic) == 0 {
+		return ErrRoutingKeyMissing
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+	confirm, err := p.channel.Publish(ctx, p.config.Exchange, topic, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Body:         msg,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	if confirm == nil {
+		return ErrConfirmUnavailable
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm message: %w", err)
+	}
+	if !acked {
+		return ErrPublishNotAcked
+	}
+	log.Infof(ctx, "Published message to exchange %q with routing key %s", p.config.Exchange, topic)
+	return nil
+}
@@ -0,0 +1,110 @@
+package amqppublisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// confirmation is a broker confirmation decided by the test.
+type confirmation struct {
+	acked bool
+	// pending never confirms, so waiting for it times out.
+	pending bool
+}
+
+func (c confirmation) WaitContext(ctx context.Context) (bool, error) {
+	if c.pending {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return c.acked, nil
+}
+
+// brokerStandIn records the messages published to it instead of sending them to a broker.
+type brokerStandIn struct {
+	published []published
+	confirm   Confirmation
+	err       error
+}
+
+// published is a message received by brokerStandIn.
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+func (b *brokerStandIn) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (Confirmation, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.published = append(b.published, published{exchange: exchange, key: key, msg: msg})
+	return b.confirm, nil
+}
+
+func (b *brokerStandIn) Close() error { return nil }
+
+func TestPublish(t *testing.T) {
+	errBroker := errors.New("channel closed")
+	tests := []struct {
+		name          string
+		cfgRoutingKey string
+		topic         string
+		confirm       Confirmation
+		publishErr    error
+		wantKey       string
+		wantErr       error
+	}{
+		{name: "acked", topic: "search", confirm: confirmation{acked: true}, wantKey: "search"},
+		{name: "configured routing key", cfgRoutingKey: "default", confirm: confirmation{acked: true}, wantKey: "default"},
+		{name: "no routing key", confirm: confirmation{acked: true}, wantErr: ErrRoutingKeyMissing},
+		{name: "nacked", topic: "search", confirm: confirmation{}, wantKey: "search", wantErr: ErrPublishNotAcked},
+		{name: "confirms not enabled", topic: "search", wantKey: "search", wantErr: ErrConfirmUnavailable},
+		{name: "unconfirmed", topic: "search", confirm: confirmation{pending: true}, wantKey: "search", wantErr: context.DeadlineExceeded},
+		{name: "publish error", topic: "search", publishErr: errBroker, wantErr: errBroker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &brokerStandIn{confirm: tt.confirm, err: tt.publishErr}
+			p, _, err := NewWithChannel(&Config{URL: "amqp://localhost", Exchange: "beckn", RoutingKey: tt.cfgRoutingKey, Timeout: 50 * time.Millisecond}, broker)
+			if err != nil {
+				t.Fatalf("NewWithChannel() error = %v", err)
+			}
+			err = p.Publish(context.Background(), tt.topic, []byte(`{"context":{}}`))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Publish() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(tt.wantKey) == 0 {
+				if len(broker.published) != 0 {
+					t.Errorf("published %d messages, want none", len(broker.published))
+				}
+				return
+			}
+			if len(broker.published) != 1 {
+				t.Fatalf("published %d messages, want 1", len(broker.published))
+			}
+			got := broker.published[0]
+			if got.exchange != "beckn" || got.key != tt.wantKey {
+				t.Errorf("published to %q with key %q, want %q with key %q", got.exchange, got.key, "beckn", tt.wantKey)
+			}
+			if got.msg.DeliveryMode != amqp.Persistent || string(got.msg.Body) != `{"context":{}}` {
+				t.Errorf("published %+v, want a persistent message with the body", got.msg)
+			}
+		})
+	}
+}
+
+func TestNewWithChannel(t *testing.T) {
+	if _, _, err := NewWithChannel(nil, &brokerStandIn{}); !errors.Is(err, ErrEmptyConfig) {
+		t.Errorf("NewWithChannel(nil config) error = %v, want %v", err, ErrEmptyConfig)
+	}
+	if _, _, err := NewWithChannel(&Config{}, nil); !errors.Is(err, ErrChannelEmpty) {
+		t.Errorf("NewWithChannel(nil channel) error = %v, want %v", err, ErrChannelEmpty)
+	}
+	if _, _, err := New(context.Background(), &Config{}); !errors.Is(err, ErrURLMissing) {
+		t.Errorf("New(no URL) error = %v, want %v", err, ErrURLMissing)
+	}
+}
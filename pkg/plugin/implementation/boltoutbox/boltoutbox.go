@@ -0,0 +1,317 @@
+package boltoutbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Config Required for the module.
+type Config struct {
+	// Path is the database file, created if it does not exist.
+	Path string
+	// Bucket holds the entries of this outbox, so that modules can share a database file.
+	Bucket string
+	// Timeout to obtain the file lock on the database.
+	Timeout time.Duration
+}
+
+// outbox implements the Outbox interface on a bucket of a bbolt database, keyed by entry id.
+// Two index buckets order the pending entries by next attempt and the dead entries by
+// their last update, so that Due and Purge do not read every entry.
+type outbox struct {
+	db     *bolt.DB
+	bucket []byte
+	due    []byte
+	dead   []byte
+}
+
+// sharedDB is a database opened by one or more outboxes.
+type sharedDB struct {
+	db   *bolt.DB
+	refs int
+}
+
+// bbolt holds an exclusive lock on the database file, so outboxes configured with
+// the same path, e.g. for a caller module and its admin module, share one handle.
+var (
+	dbsMu sync.Mutex
+	dbs   = map[string]*sharedDB{}
+)
+
+// New opens the database at the configured path and returns an outbox and its close function.
+func New(ctx context.Context, cfg *Config) (*outbox, func() error, error) {
+	if err := validateCfg(cfg); err != nil {
+		return nil, nil, err
+	}
+	path, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	shared, ok := dbs[path]
+	if !ok {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: cfg.Timeout})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open outbox db: %w", err)
+		}
+		shared = &sharedDB{db: db}
+		dbs[path] = shared
+	}
+	o := &outbox{
+		db:     shared.db,
+		bucket: []byte(cfg.Bucket),
+		due:    []byte(cfg.Bucket + ".due"),
+		dead:   []byte(cfg.Bucket + ".dead"),
+	}
+	if err := shared.db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{o.bucket, o.due, o.dead} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		if shared.refs == 0 {
+			delete(dbs, path)
+			shared.db.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+	shared.refs++
+	return o, func() error { return release(path) }, nil
+}
+
+// release closes the database at path once no outbox uses it.
+func release(path string) error {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	shared, ok := dbs[path]
+	if !ok {
+		return nil
+	}
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	delete(dbs, path)
+	return shared.db.Close()
+}
+
+// Add stores a new entry, returning false without changing the outbox if an entry
+// with the same id already exists.
+func (o *outbox) Add(ctx context.Context, entry *model.OutboxEntry) (bool, error) {
+	if err := validateEntry(entry); err != nil {
+		return false, err
+	}
+	added := false
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(o.bucket).Get([]byte(entry.ID)) != nil {
+			return nil
+		}
+		added = true
+		return o.put(tx, entry)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add entry: %w", err)
+	}
+	return added, nil
+}
+
+// Due returns up to limit pending entries whose next attempt is not after now, oldest first.
+func (o *outbox) Due(ctx context.Context, now time.Time, limit int) ([]model.OutboxEntry, error) {
+	var due []model.OutboxEntry
+	err := o.db.View(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(o.bucket)
+		end := indexKey(now.Add(time.Nanosecond), "")
+		c := tx.Bucket(o.due).Cursor()
+		for k, id := c.First(); k != nil && bytes.Compare(k, end) < 0; k, id = c.Next() {
+			if limit > 0 && len(due) == limit {
+				break
+			}
+			entry, err := decode(entries.Get(id))
+			if err != nil {
+				return err
+			}
+			due = append(due, *entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read due entries: %w", err)
+	}
+	return due, nil
+}
+
+// Update replaces an existing entry.
+func (o *outbox) Update(ctx context.Context, entry *model.OutboxEntry) error {
+	if err := validateEntry(entry); err != nil {
+		return err
+	}
+	return o.db.Update(func(tx *bolt.Tx) error {
+		if err := o.remove(tx, entry.ID); err != nil {
+			return err
+		}
+		return o.put(tx, entry)
+	})
+}
+
+// Delete removes the entry with the id.
+func (o *outbox) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return o.remove(tx, id)
+	})
+}
+
+// List returns the entries with the status, or all entries when status is empty.
+func (o *outbox) List(ctx context.Context, status string) ([]model.OutboxEntry, error) {
+	var entries []model.OutboxEntry
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(o.bucket).ForEach(func(_, v []byte) error {
+			entry, err := decode(v)
+			if err != nil {
+				return err
+			}
+			if status == "" || entry.Status == status {
+				entries = append(entries, *entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Purge removes the dead entries last updated before the given time and returns their number.
+func (o *outbox) Purge(ctx context.Context, before time.Time) (int, error) {
+	var ids [][]byte
+	err := o.db.Update(func(tx *bolt.Tx) error {
+		end := indexKey(before, "")
+		c := tx.Bucket(o.dead).Cursor()
+		for k, id := c.First(); k != nil && bytes.Compare(k, end) < 0; k, id = c.Next() {
+			ids = append(ids, id)
+		}
+		for _, id := range ids {
+			if err := o.remove(tx, string(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge entries: %w", err)
+	}
+	return len(ids), nil
+}
+
+// put writes the entry and its index key.
+func (o *outbox) put(tx *bolt.Tx, entry *model.OutboxEntry) error {
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+	if err := tx.Bucket(o.bucket).Put([]byte(entry.ID), v); err != nil {
+		return err
+	}
+	index, k := o.index(tx, entry)
+	if index == nil {
+		return nil
+	}
+	return index.Put(k, []byte(entry.ID))
+}
+
+// remove deletes the entry with id and its index key.
+func (o *outbox) remove(tx *bolt.Tx, id string) error {
+	b := tx.Bucket(o.bucket)
+	v := b.Get([]byte(id))
+	if v == nil {
+		return model.NewNotFoundErrf("outbox entry not found: %s", id)
+	}
+	entry, err := decode(v)
+	if err != nil {
+		return err
+	}
+	if index, k := o.index(tx, entry); index != nil {
+		if err := index.Delete(k); err != nil {
+			return err
+		}
+	}
+	return b.Delete([]byte(id))
+}
+
+// index returns the index bucket of the entry and its key in it, pending entries are indexed
+// by next attempt and dead ones by last update.
+func (o *outbox) index(tx *bolt.Tx, entry *model.OutboxEntry) (*bolt.Bucket, []byte) {
+	switch entry.Status {
+	case model.OutboxStatusPending:
+		return tx.Bucket(o.due), indexKey(entry.NextAttempt, entry.ID)
+	case model.OutboxStatusDead:
+		return tx.Bucket(o.dead), indexKey(entry.Updated, entry.ID)
+	}
+	return nil, nil
+}
+
+// indexKey orders index keys by t, with id keeping the keys of entries with equal times apart.
+func indexKey(t time.Time, id string) []byte {
+	k := binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+	return append(k, id...)
+}
+
+// decode unmarshals a stored entry.
+func decode(v []byte) (*model.OutboxEntry, error) {
+	var entry model.OutboxEntry
+	if err := json.Unmarshal(v, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// validateCfg validates the config.
+func validateCfg(cfg *Config) error {
+	if cfg == nil {
+		return ErrNilConfig
+	}
+	if cfg.Path == "" {
+		return ErrEmptyPath
+	}
+	if cfg.Bucket == "" {
+		return ErrEmptyBucket
+	}
+	return nil
+}
+
+// validateEntry validates the identifying fields of an entry.
+func validateEntry(entry *model.OutboxEntry) error {
+	if entry == nil {
+		return ErrNilEntry
+	}
+	if entry.ID == "" {
+		return ErrEmptyID
+	}
+	return nil
+}
+
+// Error definitions.
+var (
+	ErrNilConfig   = errors.New("invalid config: config cannot be nil")
+	ErrEmptyPath   = errors.New("invalid config: path cannot be empty")
+	ErrEmptyBucket = errors.New("invalid config: bucket cannot be empty")
+	ErrNilEntry    = errors.New("outbox entry cannot be nil")
+	ErrEmptyID     = errors.New("invalid request: id cannot be empty")
+)
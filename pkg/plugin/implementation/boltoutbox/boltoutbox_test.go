@@ -0,0 +1,166 @@
+package boltoutbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// newTestOutbox opens an outbox in a temporary directory, closed when the test ends.
+func newTestOutbox(t *testing.T) *outbox {
+	t.Helper()
+	o, closer, err := New(context.Background(), &Config{Path: filepath.Join(t.TempDir(), "outbox.db"), Bucket: "outbox"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { closer() })
+	return o
+}
+
+func TestAdd(t *testing.T) {
+	now := time.Now()
+	entry := func(id, messageID string) *model.OutboxEntry {
+		return &model.OutboxEntry{ID: id, MessageID: messageID, Status: model.OutboxStatusPending, NextAttempt: now}
+	}
+	tests := []struct {
+		name      string
+		existing  []*model.OutboxEntry
+		entry     *model.OutboxEntry
+		wantAdded bool
+		wantErr   error
+	}{
+		{name: "new entry", entry: entry("a", "msg-1"), wantAdded: true},
+		{name: "same id", existing: []*model.OutboxEntry{entry("a", "msg-1")}, entry: entry("a", "msg-1"), wantAdded: false},
+		{name: "same message id, other destination", existing: []*model.OutboxEntry{entry("a", "msg-1")}, entry: entry("b", "msg-1"), wantAdded: true},
+		{name: "nil entry", entry: nil, wantErr: ErrNilEntry},
+		{name: "empty id", entry: entry("", "msg-1"), wantErr: ErrEmptyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOutbox(t)
+			ctx := context.Background()
+			for _, e := range tt.existing {
+				if _, err := o.Add(ctx, e); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			added, err := o.Add(ctx, tt.entry)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Add() error = %v, want %v", err, tt.wantErr)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("Add() = %v, want %v", added, tt.wantAdded)
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	o := newTestOutbox(t)
+	entries := []*model.OutboxEntry{
+		{ID: "later", Status: model.OutboxStatusPending, NextAttempt: now.Add(time.Minute)},
+		{ID: "second", Status: model.OutboxStatusPending, NextAttempt: now.Add(-time.Second)},
+		{ID: "first", Status: model.OutboxStatusPending, NextAttempt: now.Add(-time.Minute)},
+		{ID: "now", Status: model.OutboxStatusPending, NextAttempt: now},
+		{ID: "dead", Status: model.OutboxStatusDead, NextAttempt: now.Add(-time.Hour), Updated: now},
+	}
+	for _, e := range entries {
+		if _, err := o.Add(ctx, e); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{name: "all due", limit: 0, want: []string{"first", "second", "now"}},
+		{name: "limited", limit: 2, want: []string{"first", "second"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, err := o.Due(ctx, now, tt.limit)
+			if err != nil {
+				t.Fatalf("Due() error = %v", err)
+			}
+			if got := ids(due); !slices.Equal(got, tt.want) {
+				t.Errorf("Due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateReindexes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	o := newTestOutbox(t)
+	entry := &model.OutboxEntry{ID: "a", Status: model.OutboxStatusPending, NextAttempt: now.Add(-time.Second)}
+	if _, err := o.Add(ctx, entry); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	entry.NextAttempt = now.Add(time.Minute)
+	if err := o.Update(ctx, entry); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if due, _ := o.Due(ctx, now, 0); len(due) != 0 {
+		t.Errorf("Due() after retry scheduled = %v, want none", ids(due))
+	}
+	if due, _ := o.Due(ctx, now.Add(time.Minute), 0); !slices.Equal(ids(due), []string{"a"}) {
+		t.Errorf("Due() at retry = %v, want [a]", ids(due))
+	}
+
+	entry.Status = model.OutboxStatusDead
+	entry.Updated = now
+	if err := o.Update(ctx, entry); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if due, _ := o.Due(ctx, now.Add(time.Hour), 0); len(due) != 0 {
+		t.Errorf("Due() after dead-lettered = %v, want none", ids(due))
+	}
+	if err := o.Update(ctx, &model.OutboxEntry{ID: "missing"}); err == nil {
+		t.Error("Update() of missing entry succeeded")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	o := newTestOutbox(t)
+	entries := []*model.OutboxEntry{
+		{ID: "old-dead", Status: model.OutboxStatusDead, Updated: now.Add(-48 * time.Hour)},
+		{ID: "new-dead", Status: model.OutboxStatusDead, Updated: now},
+		{ID: "old-pending", Status: model.OutboxStatusPending, NextAttempt: now, Updated: now.Add(-48 * time.Hour)},
+	}
+	for _, e := range entries {
+		if _, err := o.Add(ctx, e); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	n, err := o.Purge(ctx, now.Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge() = %d, %v, want 1, nil", n, err)
+	}
+	all, err := o.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := ids(all); !slices.Equal(got, []string{"new-dead", "old-pending"}) {
+		t.Errorf("List() after Purge = %v, want [new-dead old-pending]", got)
+	}
+}
+
+func ids(entries []model.OutboxEntry) []string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/boltoutbox"
+)
+
+// outboxProvider implements the OutboxProvider interface.
+type outboxProvider struct{}
+
+// New creates a new Outbox instance.
+func (op outboxProvider) New(ctx context.Context, config map[string]string) (definition.Outbox, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return boltoutbox.New(ctx, cfg)
+}
+
+// parseConfig converts the map[string]string to the boltoutbox.Config struct.
+func parseConfig(config map[string]string) (*boltoutbox.Config, error) {
+	path, exists := config["path"]
+	if !exists {
+		return nil, errors.New("path not found in config")
+	}
+	cfg := &boltoutbox.Config{Path: path, Bucket: "outbox", Timeout: 5 * time.Second}
+	if b, ok := config["bucket"]; ok {
+		cfg.Bucket = b
+	}
+	if t, ok := config["timeout"]; ok {
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = outboxProvider{}
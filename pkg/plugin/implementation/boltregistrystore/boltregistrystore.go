@@ -0,0 +1,281 @@
+package boltregistrystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Config Required for the module.
+type Config struct {
+	// Path is the database file, created if it does not exist.
+	Path string
+	// Timeout to obtain the file lock on the database.
+	Timeout time.Duration
+}
+
+// bucket holds all subscriptions keyed by subscriber id and key id.
+var bucket = []byte("subscriptions")
+
+// keySep separates the subscriber id from the key id in the record key.
+const keySep = "\x00"
+
+// store implements the RegistryStore interface on a bbolt database.
+type store struct {
+	db *bolt.DB
+}
+
+// sharedDB is a database opened by one or more stores.
+type sharedDB struct {
+	db   *bolt.DB
+	refs int
+}
+
+// bbolt holds an exclusive lock on the database file, so stores configured with
+// the same path, e.g. for the subscribe and lookup modules, share one handle.
+var (
+	dbsMu sync.Mutex
+	dbs   = map[string]*sharedDB{}
+)
+
+// New opens the database at the configured path and returns a store and its close function.
+func New(ctx context.Context, cfg *Config) (*store, func() error, error) {
+	if err := validateCfg(cfg); err != nil {
+		return nil, nil, err
+	}
+	path, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	shared, ok := dbs[path]
+	if !ok {
+		db, err := open(path, cfg.Timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared = &sharedDB{db: db}
+		dbs[path] = shared
+	}
+	shared.refs++
+	return &store{db: shared.db}, func() error { return release(path) }, nil
+}
+
+// open opens the database file and creates the subscriptions bucket.
+func open(path string, timeout time.Duration) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry db: %w", err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+	return db, nil
+}
+
+// release closes the database at path once no store uses it.
+func release(path string) error {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	shared, ok := dbs[path]
+	if !ok {
+		return nil
+	}
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	delete(dbs, path)
+	return shared.db.Close()
+}
+
+// Create stores a new subscription, failing if it already exists.
+func (s *store) Create(ctx context.Context, sub *model.Subscription) error {
+	if err := validateSub(sub); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		k := key(sub.SubscriberID, sub.KeyID)
+		if b.Get(k) != nil {
+			return fmt.Errorf("%w: %s/%s", ErrExists, sub.SubscriberID, sub.KeyID)
+		}
+		return put(b, k, sub)
+	})
+}
+
+// Get returns the subscription for the subscriber and key id, or the most
+// recently updated subscription of the subscriber when keyID is empty.
+func (s *store) Get(ctx context.Context, subscriberID, keyID string) (*model.Subscription, error) {
+	if subscriberID == "" {
+		return nil, ErrEmptySubscriberID
+	}
+	var sub *model.Subscription
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if keyID != "" {
+			v := b.Get(key(subscriberID, keyID))
+			if v == nil {
+				return nil
+			}
+			sub = &model.Subscription{}
+			return json.Unmarshal(v, sub)
+		}
+		prefix := key(subscriberID, "")
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var candidate model.Subscription
+			if err := json.Unmarshal(v, &candidate); err != nil {
+				return err
+			}
+			if sub == nil || candidate.Updated.After(sub.Updated) {
+				sub = &candidate
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscription: %w", err)
+	}
+	if sub == nil {
+		return nil, model.NewNotFoundErrf("subscription not found: %s/%s", subscriberID, keyID)
+	}
+	return sub, nil
+}
+
+// Update replaces an existing subscription.
+func (s *store) Update(ctx context.Context, sub *model.Subscription) error {
+	if err := validateSub(sub); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		k := key(sub.SubscriberID, sub.KeyID)
+		if b.Get(k) == nil {
+			return model.NewNotFoundErrf("subscription not found: %s/%s", sub.SubscriberID, sub.KeyID)
+		}
+		return put(b, k, sub)
+	})
+}
+
+// Delete removes the subscription for the subscriber and key id.
+func (s *store) Delete(ctx context.Context, subscriberID, keyID string) error {
+	if subscriberID == "" {
+		return ErrEmptySubscriberID
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		k := key(subscriberID, keyID)
+		if b.Get(k) == nil {
+			return model.NewNotFoundErrf("subscription not found: %s/%s", subscriberID, keyID)
+		}
+		return b.Delete(k)
+	})
+}
+
+// List returns the subscriptions matching the non empty fields of filter.
+func (s *store) List(ctx context.Context, filter *model.Subscription) ([]model.Subscription, error) {
+	if filter == nil {
+		filter = &model.Subscription{}
+	}
+	var subs []model.Subscription
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		var k, v []byte
+		prefix := []byte{}
+		if filter.SubscriberID != "" {
+			prefix = key(filter.SubscriberID, "")
+		}
+		for k, v = c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var sub model.Subscription
+			if err := json.Unmarshal(v, &sub); err != nil {
+				return err
+			}
+			if matches(&sub, filter) {
+				subs = append(subs, sub)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// matches reports whether sub has the same value as filter for every non empty filter field.
+func matches(sub, filter *model.Subscription) bool {
+	fields := []struct{ got, want string }{
+		{sub.SubscriberID, filter.SubscriberID},
+		{sub.KeyID, filter.KeyID},
+		{sub.Type, filter.Type},
+		{sub.Domain, filter.Domain},
+		{sub.City, filter.City},
+		{sub.Status, filter.Status},
+	}
+	for _, f := range fields {
+		if f.want != "" && f.got != f.want {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the record key for a subscriber id and key id.
+func key(subscriberID, keyID string) []byte {
+	return []byte(subscriberID + keySep + keyID)
+}
+
+// put marshals and writes the subscription under k.
+func put(b *bolt.Bucket, k []byte, sub *model.Subscription) error {
+	v, err := json.Marshal(sub)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription: %w", err)
+	}
+	return b.Put(k, v)
+}
+
+// validateCfg validates the config.
+func validateCfg(cfg *Config) error {
+	if cfg == nil {
+		return ErrNilConfig
+	}
+	if cfg.Path == "" {
+		return ErrEmptyPath
+	}
+	return nil
+}
+
+// validateSub validates the identifying fields of a subscription.
+func validateSub(sub *model.Subscription) error {
+	if sub == nil {
+		return ErrNilSubscription
+	}
+	if sub.SubscriberID == "" {
+		return ErrEmptySubscriberID
+	}
+	return nil
+}
+
+// Error definitions.
+var (
+	ErrNilConfig         = errors.New("invalid config: config cannot be nil")
+	ErrEmptyPath         = errors.New("invalid config: path cannot be empty")
+	ErrNilSubscription   = errors.New("subscription cannot be nil")
+	ErrEmptySubscriberID = errors.New("invalid request: subscriberID cannot be empty")
+	ErrExists            = errors.New("subscription already exists")
+)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/boltregistrystore"
+)
+
+// storeProvider implements the RegistryStoreProvider interface.
+type storeProvider struct{}
+
+// New creates a new RegistryStore instance.
+func (sp storeProvider) New(ctx context.Context, config map[string]string) (definition.RegistryStore, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return boltregistrystore.New(ctx, cfg)
+}
+
+// parseConfig converts the map[string]string to the boltregistrystore.Config struct.
+func parseConfig(config map[string]string) (*boltregistrystore.Config, error) {
+	path, exists := config["path"]
+	if !exists {
+		return nil, errors.New("path not found in config")
+	}
+	cfg := &boltregistrystore.Config{Path: path, Timeout: 5 * time.Second}
+	if t, ok := config["timeout"]; ok {
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = storeProvider{}
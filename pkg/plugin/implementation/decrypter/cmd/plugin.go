@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/decrypter"
+)
+
+// decrypterProvider implements the definition.DecryptorProvider interface.
+type decrypterProvider struct{}
+
+// New creates a new Decryptor instance using the provided configuration.
+func (p decrypterProvider) New(ctx context.Context, config map[string]string) (definition.Decryptor, func() error, error) {
+	if ctx == nil {
+		return nil, nil, errors.New("context cannot be nil")
+	}
+	return decrypter.New(ctx)
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = decrypterProvider{}
@@ -0,0 +1,21 @@
+package decrypter
+
+import (
+	"context"
+
+	"github.com/ashishGuliya/onix/pkg/sealbox"
+)
+
+// decrypter implements the Decryptor interface using X25519 key agreement and AES-256-GCM.
+type decrypter struct{}
+
+// New creates a new decrypter instance.
+func New(ctx context.Context) (*decrypter, func() error, error) {
+	return &decrypter{}, nil, nil
+}
+
+// Decrypt decrypts the base64 encoded GCM nonce and sealed data sent by the owner of
+// publicKeyBase64 to the owner of privateKeyBase64, see sealbox.
+func (d *decrypter) Decrypt(ctx context.Context, encryptedData string, privateKeyBase64, publicKeyBase64 string) ([]byte, error) {
+	return sealbox.Open(encryptedData, privateKeyBase64, publicKeyBase64, sealbox.LabelPayload)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/encrypter"
+)
+
+// encrypterProvider implements the definition.EncryptorProvider interface.
+type encrypterProvider struct{}
+
+// New creates a new Encryptor instance using the provided configuration.
+func (p encrypterProvider) New(ctx context.Context, config map[string]string) (definition.Encryptor, func() error, error) {
+	if ctx == nil {
+		return nil, nil, errors.New("context cannot be nil")
+	}
+	return encrypter.New(ctx)
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = encrypterProvider{}
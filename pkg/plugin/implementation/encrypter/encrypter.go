@@ -0,0 +1,22 @@
+package encrypter
+
+import (
+	"context"
+
+	"github.com/ashishGuliya/onix/pkg/sealbox"
+)
+
+// encrypter implements the Encryptor interface using X25519 key agreement and AES-256-GCM.
+type encrypter struct{}
+
+// New creates a new encrypter instance.
+func New(ctx context.Context) (*encrypter, func() error, error) {
+	return &encrypter{}, nil, nil
+}
+
+// Encrypt encrypts data for the owner of publicKeyBase64 with a key derived from the X25519
+// shared secret of privateKeyBase64 and publicKeyBase64, see sealbox.
+// The returned ciphertext is the base64 encoding of the GCM nonce followed by the sealed data.
+func (e *encrypter) Encrypt(ctx context.Context, data []byte, privateKeyBase64, publicKeyBase64 string) (string, error) {
+	return sealbox.Seal(data, privateKeyBase64, publicKeyBase64, sealbox.LabelPayload)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/filekeymanager"
+)
+
+// keyMgrProvider implements the KeyManagerProvider interface.
+type keyMgrProvider struct{}
+
+// New creates a new KeyManager instance.
+func (kp keyMgrProvider) New(ctx context.Context, cache definition.Cache, registry definition.RegistryLookup, config map[string]string) (definition.KeyManager, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return filekeymanager.New(ctx, cache, registry, cfg)
+}
+
+// parseConfig converts the map[string]string to the filekeymanager.Config struct.
+func parseConfig(config map[string]string) (*filekeymanager.Config, error) {
+	dir, exists := config["dir"]
+	if !exists {
+		return nil, errors.New("dir not found in config")
+	}
+
+	return &filekeymanager.Config{
+		Dir:        dir,
+		Passphrase: config["passphrase"],
+		MasterKey:  config["masterKey"],
+	}, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = keyMgrProvider{}
@@ -0,0 +1,387 @@
+package filekeymanager
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/keyring"
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Config Required for the module.
+type Config struct {
+	// Dir is the directory the encrypted keysets are stored in.
+	Dir string
+	// Passphrase is used to derive the master key when MasterKey is not set.
+	Passphrase string
+	// MasterKey is a base64 encoded 32 byte key used to encrypt the keysets.
+	MasterKey string
+}
+
+const (
+	saltFile   = ".salt"
+	keyFileExt = ".key"
+	saltSize   = 16
+	masterSize = 32
+)
+
+type keyMgr struct {
+	dir    string
+	aead   cipher.AEAD
+	public *keyring.PublicKeys
+}
+
+// New method creates a new KeyManager instance.
+func New(ctx context.Context, cache definition.Cache, registryLookup definition.RegistryLookup, cfg *Config) (*keyMgr, func() error, error) {
+	if err := validateCfg(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if cache == nil {
+		return nil, nil, ErrNilCache
+	}
+
+	if registryLookup == nil {
+		return nil, nil, ErrNilRegistryLookup
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	master, err := masterKey(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	km := &keyMgr{dir: cfg.Dir, aead: aead}
+	km.public = &keyring.PublicKeys{Cache: cache, Registry: registryLookup, Local: km.Keyset}
+	log.Debugf(ctx, "File key manager initialised with dir: %s", cfg.Dir)
+	return km, km.close, nil
+}
+
+// GenerateKeyPairs generates new signing and encryption key pairs.
+func (km *keyMgr) GenerateKeyPairs() (*definition.Keyset, error) {
+	// Generate Signing keys.
+	signingPublic, signingPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key pair: %w", err)
+	}
+
+	// Generate x25519 Keys.
+	encrPrivateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key pair: %w", err)
+	}
+
+	// Generate uuid for UniqueKeyID.
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate unique key id uuid: %w", err)
+	}
+
+	return &definition.Keyset{
+		UniqueKeyID:    uuid.String(),
+		SigningPrivate: encodeBase64(signingPrivate),
+		SigningPublic:  encodeBase64(signingPublic),
+		EncrPrivate:    encodeBase64(encrPrivateKey.Bytes()),
+		EncrPublic:     encodeBase64(encrPrivateKey.PublicKey().Bytes()),
+	}, nil
+}
+
+// StorePrivateKeys encrypts the keyset and writes it to the key directory, replacing any existing ones.
+func (km *keyMgr) StorePrivateKeys(ctx context.Context, keyID string, keys *definition.Keyset) error {
+	if keyID == "" {
+		return ErrEmptyKeyID
+	}
+	if keys == nil {
+		return ErrNilKeySet
+	}
+	return km.writeKeyring(keyID, []definition.Keyset{*keys})
+}
+
+// RotatePrivateKeys makes keys the active keyset and keeps the previous ones until grace has elapsed.
+func (km *keyMgr) RotatePrivateKeys(ctx context.Context, keyID string, keys *definition.Keyset, grace time.Duration) error {
+	if keyID == "" {
+		return ErrEmptyKeyID
+	}
+	if keys == nil {
+		return ErrNilKeySet
+	}
+	ring, err := km.readKeyring(keyID)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	rotated := keyring.Rotate(ring, keys, grace, time.Now())
+	log.Infof(ctx, "Rotating keys for %s to %s, retaining %d previous keyset(s)", keyID, keys.UniqueKeyID, len(rotated)-1)
+	return km.writeKeyring(keyID, rotated)
+}
+
+// SigningPrivateKey returns the Signing Private key.
+func (km *keyMgr) SigningPrivateKey(ctx context.Context, keyID string) (string, string, error) {
+	keys, err := km.getPrivateKeys(ctx, keyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return keys.UniqueKeyID, keys.SigningPrivate, nil
+}
+
+// EncrPrivateKey returns the Encryption Private key.
+func (km *keyMgr) EncrPrivateKey(ctx context.Context, keyID string) (string, string, error) {
+	keys, err := km.getPrivateKeys(ctx, keyID)
+	if err != nil {
+		return "", "", err
+	}
+	return keys.UniqueKeyID, keys.EncrPrivate, nil
+}
+
+// Keyset returns the keyset with uniqueKeyID, the active one or a previous one until its ValidUntil.
+func (km *keyMgr) Keyset(ctx context.Context, keyID, uniqueKeyID string) (*definition.Keyset, error) {
+	if keyID == "" {
+		return nil, ErrEmptyKeyID
+	}
+	if uniqueKeyID == "" {
+		return nil, ErrEmptyUniqueKeyID
+	}
+	ring, err := km.readKeyring(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Find(ring, uniqueKeyID, time.Now())
+}
+
+// SigningPublicKey returns the Signing Public key.
+func (km *keyMgr) SigningPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error) {
+	keys, err := km.public.Get(ctx, subscriberID, uniqueKeyID)
+	if err != nil {
+		return "", err
+	}
+
+	return keys.SigningPublic, nil
+}
+
+// EncrPublicKey returns the Encryption Public key.
+func (km *keyMgr) EncrPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error) {
+	keys, err := km.public.Get(ctx, subscriberID, uniqueKeyID)
+	if err != nil {
+		return "", err
+	}
+
+	return keys.EncrPublic, nil
+}
+
+// DeletePrivateKeys removes the keyset from the key directory.
+func (km *keyMgr) DeletePrivateKeys(ctx context.Context, keyID string) error {
+	if keyID == "" {
+		return ErrEmptyKeyID
+	}
+	if err := os.Remove(km.path(keyID)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrKeyNotFound
+		}
+		return fmt.Errorf("failed to delete key file: %w", err)
+	}
+	return nil
+}
+
+// Closes the key manager, there are no resources to release.
+func (km *keyMgr) close() error {
+	return nil
+}
+
+// path returns the key file for keyID, encoded so that it is always a plain file name.
+func (km *keyMgr) path(keyID string) string {
+	return filepath.Join(km.dir, base64.RawURLEncoding.EncodeToString([]byte(keyID))+keyFileExt)
+}
+
+// getPrivateKeys returns the active keyset for keyID.
+func (km *keyMgr) getPrivateKeys(ctx context.Context, keyID string) (*definition.Keyset, error) {
+	if keyID == "" {
+		return nil, ErrEmptyKeyID
+	}
+	ring, err := km.readKeyring(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return &ring[0], nil
+}
+
+// readKeyring reads and decrypts the keysets for keyID, newest first.
+func (km *keyMgr) readKeyring(keyID string) ([]definition.Keyset, error) {
+	sealed, err := os.ReadFile(km.path(keyID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	nonceSize := km.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, ErrCorruptKeyFile
+	}
+	payload, err := km.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key file: %w", err)
+	}
+
+	var ring []definition.Keyset
+	if err := json.Unmarshal(payload, &ring); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	if len(ring) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return ring, nil
+}
+
+// writeKeyring encrypts the keysets for keyID and writes them to the key directory.
+func (km *keyMgr) writeKeyring(keyID string, ring []definition.Keyset) error {
+	payload, err := json.Marshal(ring)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	nonce := make([]byte, km.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// The keyID is used as additional data so that key files cannot be swapped.
+	sealed := km.aead.Seal(nonce, nonce, payload, []byte(keyID))
+
+	if err := writeFile(km.path(keyID), sealed); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// masterKey returns the configured master key or derives one from the passphrase.
+func masterKey(cfg *Config) ([]byte, error) {
+	if cfg.MasterKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.MasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: failed to decode masterKey: %w", err)
+		}
+		if len(key) != masterSize {
+			return nil, ErrInvalidMasterKey
+		}
+		return key, nil
+	}
+
+	salt, err := loadSalt(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(cfg.Passphrase), salt, 1<<15, 8, 1, masterSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+	return key, nil
+}
+
+// loadSalt reads the key directory salt, creating it on first use.
+func loadSalt(dir string) ([]byte, error) {
+	path := filepath.Join(dir, saltFile)
+	salt, err := os.ReadFile(path)
+	if err == nil {
+		if len(salt) != saltSize {
+			return nil, ErrCorruptKeyFile
+		}
+		return salt, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read salt: %w", err)
+	}
+
+	salt = make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if err := writeFile(path, salt); err != nil {
+		return nil, fmt.Errorf("failed to write salt: %w", err)
+	}
+	return salt, nil
+}
+
+// writeFile atomically replaces the file at path with data.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Encoding byte data to base64.
+func encodeBase64(data []byte) string {
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// validateCfg validates the config.
+func validateCfg(cfg *Config) error {
+	if cfg == nil {
+		return ErrNilConfig
+	}
+	if cfg.Dir == "" {
+		return ErrEmptyDir
+	}
+	if cfg.Passphrase == "" && cfg.MasterKey == "" {
+		return ErrMissingSecret
+	}
+	return nil
+}
+
+// Error definitions.
+var (
+	ErrNilConfig          = errors.New("invalid config: config cannot be nil")
+	ErrEmptyDir           = errors.New("invalid config: dir cannot be empty")
+	ErrMissingSecret      = errors.New("invalid config: one of passphrase or masterKey is required")
+	ErrInvalidMasterKey   = errors.New("invalid config: masterKey must be 32 bytes")
+	ErrNilCache           = errors.New("cache cannot be nil")
+	ErrNilKeySet          = errors.New("keyset cannot be nil")
+	ErrNilRegistryLookup  = errors.New("registrylookup cannot be nil")
+	ErrEmptySubscriberID  = keyring.ErrEmptySubscriberID
+	ErrEmptyUniqueKeyID   = keyring.ErrEmptyUniqueKeyID
+	ErrEmptyKeyID         = errors.New("invalid request: keyID cannot be empty")
+	ErrKeyNotFound        = errors.New("no keys found for the given keyID")
+	ErrKeyExpired         = keyring.ErrKeyExpired
+	ErrCorruptKeyFile     = errors.New("key file is corrupt")
+	ErrSubscriberNotFound = keyring.ErrSubscriberNotFound
+)
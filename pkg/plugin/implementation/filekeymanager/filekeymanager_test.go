@@ -0,0 +1,205 @@
+package filekeymanager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// mapCache is a Cache backed by a map.
+type mapCache map[string]string
+
+func (c mapCache) Get(ctx context.Context, key string) (string, error) {
+	v, ok := c[key]
+	if !ok {
+		return "", errors.New("cache miss")
+	}
+	return v, nil
+}
+
+func (c mapCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c[key] = value
+	return nil
+}
+
+func (c mapCache) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if _, ok := c[key]; ok {
+		return false, nil
+	}
+	c[key] = value
+	return true, nil
+}
+
+func (c mapCache) Delete(ctx context.Context, key string) error {
+	delete(c, key)
+	return nil
+}
+
+func (c mapCache) Clear(ctx context.Context) error {
+	clear(c)
+	return nil
+}
+
+// noRegistry is a RegistryLookup without subscriptions.
+type noRegistry struct{}
+
+func (noRegistry) Lookup(ctx context.Context, req *model.Subscription) ([]model.Subscription, error) {
+	return nil, nil
+}
+
+// newTestKeyMgr creates a key manager in dir with the passphrase.
+func newTestKeyMgr(t *testing.T, dir, passphrase string) *keyMgr {
+	t.Helper()
+	km, _, err := New(context.Background(), mapCache{}, noRegistry{}, &Config{Dir: dir, Passphrase: passphrase})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return km
+}
+
+// storeTestKeys generates and stores a keyset for keyID.
+func storeTestKeys(t *testing.T, km *keyMgr, keyID string) {
+	t.Helper()
+	keys, err := km.GenerateKeyPairs()
+	if err != nil {
+		t.Fatalf("GenerateKeyPairs() error = %v", err)
+	}
+	if err := km.StorePrivateKeys(context.Background(), keyID, keys); err != nil {
+		t.Fatalf("StorePrivateKeys() error = %v", err)
+	}
+}
+
+func TestStoreLoadRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	km := newTestKeyMgr(t, dir, "secret")
+	keys, err := km.GenerateKeyPairs()
+	if err != nil {
+		t.Fatalf("GenerateKeyPairs() error = %v", err)
+	}
+	if err := km.StorePrivateKeys(ctx, "bap1", keys); err != nil {
+		t.Fatalf("StorePrivateKeys() error = %v", err)
+	}
+
+	// A new key manager derives the same master key from the passphrase and the stored salt.
+	reopened := newTestKeyMgr(t, dir, "secret")
+	keyID, signing, err := reopened.SigningPrivateKey(ctx, "bap1")
+	if err != nil {
+		t.Fatalf("SigningPrivateKey() error = %v", err)
+	}
+	if keyID != keys.UniqueKeyID || signing != keys.SigningPrivate {
+		t.Errorf("SigningPrivateKey() = %s, %s, want %s, %s", keyID, signing, keys.UniqueKeyID, keys.SigningPrivate)
+	}
+	if _, encr, err := reopened.EncrPrivateKey(ctx, "bap1"); err != nil || encr != keys.EncrPrivate {
+		t.Errorf("EncrPrivateKey() = %s, %v, want %s", encr, err, keys.EncrPrivate)
+	}
+	if public, err := reopened.SigningPublicKey(ctx, "bap1", keys.UniqueKeyID); err != nil || public != keys.SigningPublic {
+		t.Errorf("SigningPublicKey() = %s, %v, want %s", public, err, keys.SigningPublic)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	storeTestKeys(t, newTestKeyMgr(t, dir, "secret"), "bap1")
+
+	km := newTestKeyMgr(t, dir, "other")
+	if _, _, err := km.SigningPrivateKey(context.Background(), "bap1"); err == nil {
+		t.Error("SigningPrivateKey() error = nil, want a decryption error")
+	}
+}
+
+func TestTamperedKeyFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, km *keyMgr)
+		wantErr error
+	}{
+		{
+			name: "flipped ciphertext byte",
+			tamper: func(t *testing.T, km *keyMgr) {
+				data := readFile(t, km.path("bap1"))
+				data[len(data)-1] ^= 0x01
+				writeTestFile(t, km.path("bap1"), data)
+			},
+		},
+		{
+			name: "flipped nonce byte",
+			tamper: func(t *testing.T, km *keyMgr) {
+				data := readFile(t, km.path("bap1"))
+				data[0] ^= 0x01
+				writeTestFile(t, km.path("bap1"), data)
+			},
+		},
+		{
+			name: "truncated",
+			tamper: func(t *testing.T, km *keyMgr) {
+				writeTestFile(t, km.path("bap1"), readFile(t, km.path("bap1"))[:4])
+			},
+			wantErr: ErrCorruptKeyFile,
+		},
+		{
+			name: "file of another key id",
+			tamper: func(t *testing.T, km *keyMgr) {
+				storeTestKeys(t, km, "bap2")
+				writeTestFile(t, km.path("bap1"), readFile(t, km.path("bap2")))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestKeyMgr(t, t.TempDir(), "secret")
+			storeTestKeys(t, km, "bap1")
+			tt.tamper(t, km)
+			_, _, err := km.SigningPrivateKey(context.Background(), "bap1")
+			if err == nil {
+				t.Fatal("SigningPrivateKey() error = nil, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("SigningPrivateKey() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeletePrivateKeys(t *testing.T) {
+	ctx := context.Background()
+	km := newTestKeyMgr(t, t.TempDir(), "secret")
+	storeTestKeys(t, km, "bap1")
+	storeTestKeys(t, km, "bap2")
+
+	if err := km.DeletePrivateKeys(ctx, "bap1"); err != nil {
+		t.Fatalf("DeletePrivateKeys() error = %v", err)
+	}
+	if _, _, err := km.SigningPrivateKey(ctx, "bap1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("SigningPrivateKey() of deleted keys error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, _, err := km.SigningPrivateKey(ctx, "bap2"); err != nil {
+		t.Errorf("SigningPrivateKey() of other keys error = %v", err)
+	}
+	if err := km.DeletePrivateKeys(ctx, "bap1"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("DeletePrivateKeys() again error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if err := km.DeletePrivateKeys(ctx, ""); !errors.Is(err, ErrEmptyKeyID) {
+		t.Errorf("DeletePrivateKeys(\"\") error = %v, want %v", err, ErrEmptyKeyID)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return data
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
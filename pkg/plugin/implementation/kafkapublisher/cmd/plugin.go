@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/kafkapublisher"
+)
+
+// publisherProvider implements the PublisherProvider interface.
+type publisherProvider struct{}
+
+// New creates a new Kafka Publisher instance.
+func (pp publisherProvider) New(ctx context.Context, config map[string]string) (definition.Publisher, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	p, closer, err := kafkapublisher.New(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, closer, nil
+}
+
+// parseConfig converts the map[string]string to the kafkapublisher.Config struct.
+func parseConfig(config map[string]string) (*kafkapublisher.Config, error) {
+	brokers, exists := config["brokers"]
+	if !exists {
+		return nil, errors.New("brokers not found in config")
+	}
+	cfg := &kafkapublisher.Config{Topic: config["topic"]}
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); len(b) != 0 {
+			cfg.Brokers = append(cfg.Brokers, b)
+		}
+	}
+	if v, ok := config["timeout"]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = publisherProvider{}
@@ -0,0 +1,120 @@
+package kafkapublisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/segmentio/kafka-go"
+)
+
+// Config holds the Kafka publisher configuration.
+type Config struct {
+	Brokers []string
+	// Topic is used when a message is published without a topic.
+	Topic string
+	// Timeout bounds writing a message and waiting for its acknowledgement by all in-sync replicas.
+	Timeout time.Duration
+}
+
+// defaultTimeout is the write timeout used when not configured.
+const defaultTimeout = 10 * time.Second
+
+// batchTimeout is how long the writer waits for more messages before writing a batch.
+const batchTimeout = 10 * time.Millisecond
+
+// Writer writes messages to Kafka, it is implemented by *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Publisher publishes messages to Kafka topics.
+type Publisher struct {
+	writer Writer
+	config *Config
+}
+
+// Error definitions.
+var (
+	ErrEmptyConfig    = errors.New("empty config")
+	ErrBrokersMissing = errors.New("missing required field 'Brokers'")
+	ErrTopicMissing   = errors.New("missing topic")
+	ErrWriterEmpty    = errors.New("nil writer")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil {
+		return ErrEmptyConfig
+	}
+	if len(cfg.Brokers) == 0 {
+		return ErrBrokersMissing
+	}
+	return nil
+}
+
+// New creates a Publisher writing to the configured brokers and returns its close function.
+func New(ctx context.Context, cfg *Config) (*Publisher, func() error, error) {
+	if err := validate(cfg); err != nil {
+		return nil, nil, err
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Publish waits for its message to be written, so batches are only collected
+		// from concurrent publishes instead of waiting the default of a second.
+		BatchTimeout: batchTimeout,
+	}
+	return NewWithWriter(cfg, w)
+}
+
+// NewWithWriter creates a Publisher using w, which lets a local broker stand-in replace Kafka.
+func NewWithWriter(cfg *Config, w Writer) (*Publisher, func() error, error) {
+	if cfg == nil {
+		return nil, nil, ErrEmptyConfig
+	}
+	if w == nil {
+		return nil, nil, ErrWriterEmpty
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Publisher{writer: w, config: cfg}, w.Close, nil
+}
+
+// Publish writes msg to topic, or to the configured topic when topic is empty. Messages are
+// keyed by the transaction_id of their Beckn context, so that the messages of a transaction
+// are written to the same partition and consumed in order.
+func (p *Publisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	if len(topic) == 0 {
+		topic = p.config.Topic
+	}
+	if len(topic) == 0 {
+		return ErrTopicMissing
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+	if err := p.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: messageKey(msg), Value: msg}); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	log.Infof(ctx, "Published message to Kafka topic %s", topic)
+	return nil
+}
+
+// messageKey returns the transaction_id of the Beckn context of msg, or nil when msg has none,
+// in which case the balancer spreads the message over the partitions.
+func messageKey(msg []byte) []byte {
+	var req struct {
+		Context struct {
+			TransactionID string `json:"transaction_id"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(msg, &req); err != nil || len(req.Context.TransactionID) == 0 {
+		return nil
+	}
+	return []byte(req.Context.TransactionID)
+}
@@ -0,0 +1,114 @@
+package kafkapublisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// brokerStandIn records the messages written to it instead of sending them to Kafka.
+type brokerStandIn struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (b *brokerStandIn) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.msgs = append(b.msgs, msgs...)
+	return nil
+}
+
+func (b *brokerStandIn) Close() error { return nil }
+
+func TestPublish(t *testing.T) {
+	errBroker := errors.New("broker down")
+	tests := []struct {
+		name      string
+		cfgTopic  string
+		topic     string
+		msg       string
+		writeErr  error
+		wantTopic string
+		wantKey   string
+		wantErr   error
+	}{
+		{
+			name:      "keyed by transaction_id",
+			topic:     "search",
+			msg:       `{"context":{"transaction_id":"txn-1","message_id":"msg-1"},"message":{}}`,
+			wantTopic: "search",
+			wantKey:   "txn-1",
+		},
+		{
+			name:      "configured topic",
+			cfgTopic:  "default",
+			msg:       `{"context":{"transaction_id":"txn-2"}}`,
+			wantTopic: "default",
+			wantKey:   "txn-2",
+		},
+		{
+			name:      "no transaction_id",
+			topic:     "search",
+			msg:       `{"context":{"message_id":"msg-1"}}`,
+			wantTopic: "search",
+		},
+		{
+			name:      "not json",
+			topic:     "search",
+			msg:       `not json`,
+			wantTopic: "search",
+		},
+		{
+			name:    "missing topic",
+			msg:     `{}`,
+			wantErr: ErrTopicMissing,
+		},
+		{
+			name:     "write fails",
+			topic:    "search",
+			msg:      `{}`,
+			writeErr: errBroker,
+			wantErr:  errBroker,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &brokerStandIn{err: tt.writeErr}
+			p, _, err := NewWithWriter(&Config{Topic: tt.cfgTopic}, broker)
+			if err != nil {
+				t.Fatalf("NewWithWriter() error = %v", err)
+			}
+			err = p.Publish(context.Background(), tt.topic, []byte(tt.msg))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Publish() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(broker.msgs) != 1 {
+				t.Fatalf("got %d messages, want 1", len(broker.msgs))
+			}
+			got := broker.msgs[0]
+			if got.Topic != tt.wantTopic || string(got.Key) != tt.wantKey || string(got.Value) != tt.msg {
+				t.Errorf("got message topic=%q key=%q value=%q, want topic=%q key=%q value=%q", got.Topic, got.Key, got.Value, tt.wantTopic, tt.wantKey, tt.msg)
+			}
+		})
+	}
+}
+
+func TestNewWithWriter(t *testing.T) {
+	if _, _, err := NewWithWriter(nil, &brokerStandIn{}); !errors.Is(err, ErrEmptyConfig) {
+		t.Errorf("NewWithWriter(nil config) error = %v, want %v", err, ErrEmptyConfig)
+	}
+	if _, _, err := NewWithWriter(&Config{}, nil); !errors.Is(err, ErrWriterEmpty) {
+		t.Errorf("NewWithWriter(nil writer) error = %v, want %v", err, ErrWriterEmpty)
+	}
+	p, _, err := NewWithWriter(&Config{}, &brokerStandIn{})
+	if err != nil || p.config.Timeout != defaultTimeout {
+		t.Errorf("NewWithWriter() = %v, %v, want timeout %s", p, err, defaultTimeout)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/kmssigner"
+	"github.com/ashishGuliya/onix/pkg/remotekey"
+)
+
+// remoteSignerProvider implements the RemoteSignerProvider interface.
+type remoteSignerProvider struct{}
+
+// New creates a new RemoteSigner instance.
+func (rp remoteSignerProvider) New(ctx context.Context, config map[string]string) (definition.RemoteSigner, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return kmssigner.New(ctx, cfg)
+}
+
+// parseConfig converts the map[string]string to the kmssigner.Config struct. Either the single
+// keyVersion, subscriberId and uniqueKeyId or keys, "subscriberId|uniqueKeyId|keyVersion[|activeFrom]"
+// separated by ";", or both must be set.
+func parseConfig(config map[string]string) (*kmssigner.Config, error) {
+	cfg := &kmssigner.Config{
+		KeyVersion:   config["keyVersion"],
+		SubscriberID: config["subscriberId"],
+		UniqueKeyID:  config["uniqueKeyId"],
+	}
+	if spec, ok := config["keys"]; ok {
+		keys, err := remotekey.ParseKeys(spec)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Keys = keys
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = remoteSignerProvider{}
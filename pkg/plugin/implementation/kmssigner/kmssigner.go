@@ -0,0 +1,168 @@
+package kmssigner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ashishGuliya/onix/pkg/authheader"
+	"github.com/ashishGuliya/onix/pkg/remotekey"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Config Required for the module.
+type Config struct {
+	// KeyVersion is the resource name of the signing key version,
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*.
+	KeyVersion string
+	// SubscriberID is the subscriber that signs with the key.
+	SubscriberID string
+	// UniqueKeyID is the unique key id of the key registered for SubscriberID.
+	UniqueKeyID string
+	// Keys are further signing keys, whose Ref is the resource name of a key version. A subscriber
+	// signs with its key that became active last, so a rotated key is added with a later ActiveFrom.
+	Keys []remotekey.Key
+}
+
+type kmsClient interface {
+	GetCryptoKeyVersion(context.Context, *kmspb.GetCryptoKeyVersionRequest, ...gax.CallOption) (*kmspb.CryptoKeyVersion, error)
+	AsymmetricSign(context.Context, *kmspb.AsymmetricSignRequest, ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+	Close() error
+}
+
+// algorithms maps the supported key algorithms to their names in the signature header.
+var algorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]string{
+	kmspb.CryptoKeyVersion_EC_SIGN_ED25519:     authheader.AlgorithmEd25519,
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256: authheader.AlgorithmECDSAP256SHA256,
+}
+
+// crc32c is the checksum used to verify the integrity of the data exchanged with Cloud KMS.
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// signer implements the RemoteSigner interface with Cloud KMS keys, whose private keys never leave the KMS.
+type signer struct {
+	client kmsClient
+	keys   []remotekey.Key
+	// algorithm holds the algorithm of each key version.
+	algorithm map[string]string
+}
+
+// New creates a Cloud KMS client and returns a signer for the configured key versions.
+func New(ctx context.Context, cfg *Config) (*signer, func() error, error) {
+	keys, err := configKeys(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kms client: %w", err)
+	}
+	s, err := newSigner(ctx, client, keys)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return s, client.Close, nil
+}
+
+// newSigner returns a signer for the key versions, which must be enabled and of a supported algorithm.
+// Versions of keys that are not active yet must be enabled too, so that they can sign when they are.
+func newSigner(ctx context.Context, client kmsClient, keys []remotekey.Key) (*signer, error) {
+	s := &signer{client: client, keys: keys, algorithm: map[string]string{}}
+	for _, key := range keys {
+		if _, ok := s.algorithm[key.Ref]; ok {
+			continue
+		}
+		version, err := client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: key.Ref})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key version %s: %w", key.Ref, err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_ENABLED {
+			return nil, fmt.Errorf("%w: %s is %s", ErrKeyNotEnabled, key.Ref, version.GetState())
+		}
+		algorithm, ok := algorithms[version.GetAlgorithm()]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, version.GetAlgorithm())
+		}
+		s.algorithm[key.Ref] = algorithm
+	}
+	return s, nil
+}
+
+// Sign signs data with the active key version of the subscriber in Cloud KMS, verifying the
+// checksums of the data and of the signature to detect corruption in transit.
+func (s *signer) Sign(ctx context.Context, subscriberID string, data []byte) (string, string, string, error) {
+	key, err := remotekey.Active(s.keys, subscriberID, time.Now())
+	if err != nil {
+		return "", "", "", err
+	}
+	algorithm := s.algorithm[key.Ref]
+	req := &kmspb.AsymmetricSignRequest{Name: key.Ref}
+	if algorithm == authheader.AlgorithmECDSAP256SHA256 {
+		// ECDSA keys sign a digest rather than the data.
+		digest := sha256.Sum256(data)
+		req.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest[:]}}
+		req.DigestCrc32C = wrapperspb.Int64(int64(crc32.Checksum(digest[:], crc32c)))
+	} else {
+		req.Data = data
+		req.DataCrc32C = wrapperspb.Int64(int64(crc32.Checksum(data, crc32c)))
+	}
+	resp, err := s.client.AsymmetricSign(ctx, req)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to sign with %s: %w", key.Ref, err)
+	}
+	verified := resp.GetVerifiedDataCrc32C()
+	if req.Digest != nil {
+		verified = resp.GetVerifiedDigestCrc32C()
+	}
+	if !verified || resp.GetName() != key.Ref {
+		return "", "", "", fmt.Errorf("%w: request", ErrCorrupted)
+	}
+	if int64(crc32.Checksum(resp.GetSignature(), crc32c)) != resp.GetSignatureCrc32C().GetValue() {
+		return "", "", "", fmt.Errorf("%w: response", ErrCorrupted)
+	}
+	return key.UniqueKeyID, algorithm, base64.StdEncoding.EncodeToString(resp.GetSignature()), nil
+}
+
+// configKeys validates the config and returns its keys, the single configured key version first.
+func configKeys(cfg *Config) ([]remotekey.Key, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+	var keys []remotekey.Key
+	if cfg.KeyVersion != "" || cfg.SubscriberID != "" || cfg.UniqueKeyID != "" {
+		if cfg.KeyVersion == "" {
+			return nil, ErrEmptyKeyVersion
+		}
+		if cfg.SubscriberID == "" {
+			return nil, ErrEmptySubscriberID
+		}
+		if cfg.UniqueKeyID == "" {
+			return nil, ErrEmptyUniqueKeyID
+		}
+		keys = append(keys, remotekey.Key{SubscriberID: cfg.SubscriberID, UniqueKeyID: cfg.UniqueKeyID, Ref: cfg.KeyVersion})
+	}
+	keys = append(keys, cfg.Keys...)
+	if err := remotekey.Validate(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Error definitions.
+var (
+	ErrNilConfig            = errors.New("invalid config: config cannot be nil")
+	ErrEmptyKeyVersion      = errors.New("invalid config: keyVersion cannot be empty")
+	ErrEmptySubscriberID    = errors.New("invalid config: subscriberId cannot be empty")
+	ErrEmptyUniqueKeyID     = errors.New("invalid config: uniqueKeyId cannot be empty")
+	ErrKeyNotEnabled        = errors.New("key version not enabled")
+	ErrUnsupportedAlgorithm = errors.New("unsupported key algorithm")
+	ErrCorrupted            = errors.New("kms checksum mismatch")
+)
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/localpublisher"
+)
+
+// publisherProvider implements the PublisherProvider interface.
+type publisherProvider struct{}
+
+// New creates a new local Publisher instance.
+func (pp publisherProvider) New(ctx context.Context, config map[string]string) (definition.Publisher, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	p, closer, err := localpublisher.New(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, closer, nil
+}
+
+// parseConfig converts the map[string]string to the localpublisher.Config struct.
+func parseConfig(config map[string]string) (*localpublisher.Config, error) {
+	cfg := &localpublisher.Config{
+		Dir:   config["dir"],
+		Topic: config["topic"],
+	}
+	if v, ok := config["buffer"]; ok {
+		buffer, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid buffer: %w", err)
+		}
+		cfg.Buffer = buffer
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = publisherProvider{}
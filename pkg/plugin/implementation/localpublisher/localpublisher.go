@@ -0,0 +1,155 @@
+package localpublisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+)
+
+// Config holds the local publisher configuration.
+type Config struct {
+	// Dir, when set, appends the messages of each topic as lines to Dir/<topic>.jsonl.
+	// Messages are kept in memory channels otherwise.
+	Dir string
+	// Topic is used when a message is published without a topic.
+	Topic string
+	// Buffer is the capacity of the in-memory channel of each topic.
+	Buffer int
+}
+
+// defaultBuffer is the capacity of the in-memory channels when not configured.
+const defaultBuffer = 100
+
+// Publisher publishes messages to local files or in-memory channels, for running
+// the adapter and its tests without a message broker.
+type Publisher struct {
+	cfg *Config
+
+	mu     sync.Mutex
+	topics map[string]chan []byte
+	files  map[string]*os.File
+}
+
+// Error definitions.
+var (
+	ErrEmptyConfig  = errors.New("empty config")
+	ErrTopicMissing = errors.New("missing topic")
+	ErrBufferFull   = errors.New("topic buffer full")
+	ErrClosed       = errors.New("publisher closed")
+)
+
+// New creates a new local Publisher and returns its close function.
+func New(ctx context.Context, cfg *Config) (*Publisher, func() error, error) {
+	if cfg == nil {
+		return nil, nil, ErrEmptyConfig
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultBuffer
+	}
+	if len(cfg.Dir) != 0 {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create publish directory: %w", err)
+		}
+	}
+	p := &Publisher{
+		cfg:    cfg,
+		topics: map[string]chan []byte{},
+		files:  map[string]*os.File{},
+	}
+	return p, p.Close, nil
+}
+
+// Publish appends msg to the file of the topic, or sends it to the channel of the topic
+// without blocking. Messages written to files must be JSON, they are compacted to one line.
+func (p *Publisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	if len(topic) == 0 {
+		topic = p.cfg.Topic
+	}
+	if len(topic) == 0 {
+		return ErrTopicMissing
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.topics == nil {
+		return ErrClosed
+	}
+	if len(p.cfg.Dir) == 0 {
+		select {
+		case p.channel(topic) <- bytes.Clone(msg):
+		default:
+			return fmt.Errorf("%w: %s", ErrBufferFull, topic)
+		}
+		log.Debugf(ctx, "Published message to local topic %s", topic)
+		return nil
+	}
+
+	var line bytes.Buffer
+	if err := json.Compact(&line, msg); err != nil {
+		return fmt.Errorf("invalid JSON message: %w", err)
+	}
+	line.WriteByte('\n')
+	f, err := p.file(topic)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line.Bytes()); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	log.Debugf(ctx, "Published message to %s", f.Name())
+	return nil
+}
+
+// Messages returns the channel receiving the messages published to topic in memory.
+func (p *Publisher) Messages(topic string) <-chan []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.channel(topic)
+}
+
+// channel returns the channel of topic, creating it when needed. Callers must hold p.mu.
+func (p *Publisher) channel(topic string) chan []byte {
+	ch, ok := p.topics[topic]
+	if !ok {
+		ch = make(chan []byte, p.cfg.Buffer)
+		p.topics[topic] = ch
+	}
+	return ch
+}
+
+// file returns the file of topic, opening it when needed. Callers must hold p.mu.
+func (p *Publisher) file(topic string) (*os.File, error) {
+	if f, ok := p.files[topic]; ok {
+		return f, nil
+	}
+	if topic != filepath.Base(topic) {
+		return nil, fmt.Errorf("invalid topic: %s", topic)
+	}
+	f, err := os.OpenFile(filepath.Join(p.cfg.Dir, topic+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open topic file: %w", err)
+	}
+	p.files[topic] = f
+	return f, nil
+}
+
+// Close closes the topic files and channels.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, f := range p.files {
+		errs = append(errs, f.Close())
+	}
+	for _, ch := range p.topics {
+		close(ch)
+	}
+	p.files, p.topics = nil, nil
+	return errors.Join(errs...)
+}
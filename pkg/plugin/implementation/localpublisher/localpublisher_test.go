@@ -0,0 +1,86 @@
+package localpublisher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishToFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "published")
+	p, closer, err := New(ctx, &Config{Dir: dir, Topic: "default"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		topic   string
+		msg     string
+		wantErr bool
+	}{
+		{name: "compacted to a line", topic: "search", msg: "{\n  \"context\": {\"action\": \"search\"}\n}"},
+		{name: "appended", topic: "search", msg: `{"context":{"action":"select"}}`},
+		{name: "configured topic", msg: `{"context":{"action":"init"}}`},
+		{name: "not json", topic: "search", msg: `not json`, wantErr: true},
+		{name: "topic outside dir", topic: "../search", msg: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Publish(ctx, tt.topic, []byte(tt.msg)); (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := closer(); err != nil {
+		t.Fatalf("close error = %v", err)
+	}
+
+	want := map[string]string{
+		"search.jsonl":  "{\"context\":{\"action\":\"search\"}}\n{\"context\":{\"action\":\"select\"}}\n",
+		"default.jsonl": "{\"context\":{\"action\":\"init\"}}\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "search.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("message written outside dir, Stat() error = %v", err)
+	}
+}
+
+func TestPublishToChannels(t *testing.T) {
+	ctx := context.Background()
+	p, closer, err := New(ctx, &Config{Buffer: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	msg := []byte(`{"context":{"action":"search"}}`)
+	if err := p.Publish(ctx, "search", msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msg[0] = 'x'
+	if err := p.Publish(ctx, "search", msg); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Publish() to full topic error = %v, want %v", err, ErrBufferFull)
+	}
+	if err := p.Publish(ctx, "", msg); !errors.Is(err, ErrTopicMissing) {
+		t.Errorf("Publish() without topic error = %v, want %v", err, ErrTopicMissing)
+	}
+	if got := <-p.Messages("search"); string(got) != `{"context":{"action":"search"}}` {
+		t.Errorf("Messages() = %s, want the published message", got)
+	}
+
+	if err := closer(); err != nil {
+		t.Fatalf("close error = %v", err)
+	}
+	if err := p.Publish(ctx, "search", msg); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after close error = %v, want %v", err, ErrClosed)
+	}
+}
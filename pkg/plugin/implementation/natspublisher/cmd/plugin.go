@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/natspublisher"
+)
+
+// publisherProvider implements the PublisherProvider interface.
+type publisherProvider struct{}
+
+// New creates a new NATS Publisher instance.
+func (pp publisherProvider) New(ctx context.Context, config map[string]string) (definition.Publisher, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	p, closer, err := natspublisher.New(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, closer, nil
+}
+
+// parseConfig converts the map[string]string to the natspublisher.Config struct.
+func parseConfig(config map[string]string) (*natspublisher.Config, error) {
+	url, exists := config["url"]
+	if !exists {
+		return nil, errors.New("url not found in config")
+	}
+	cfg := &natspublisher.Config{
+		URL:     url,
+		Subject: config["subject"],
+		Name:    config["name"],
+	}
+	if v, ok := config["timeout"]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = publisherProvider{}
@@ -0,0 +1,106 @@
+package natspublisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/nats-io/nats.go"
+)
+
+// Config holds the NATS publisher configuration.
+type Config struct {
+	URL string
+	// Subject is used when a message is published without a subject.
+	Subject string
+	// Name identifies the connection on the server.
+	Name string
+	// Timeout bounds waiting for the server to receive a published message.
+	Timeout time.Duration
+}
+
+// defaultTimeout is the flush timeout used when not configured.
+const defaultTimeout = 5 * time.Second
+
+// Conn publishes messages to a NATS server, it is implemented by *nats.Conn.
+type Conn interface {
+	Publish(subject string, data []byte) error
+	FlushTimeout(timeout time.Duration) error
+	Drain() error
+}
+
+// Publisher publishes messages to NATS subjects.
+type Publisher struct {
+	conn   Conn
+	config *Config
+}
+
+// Error definitions.
+var (
+	ErrEmptyConfig    = errors.New("empty config")
+	ErrURLMissing     = errors.New("missing required field 'URL'")
+	ErrSubjectMissing = errors.New("missing subject")
+	ErrConnEmpty      = errors.New("nil connection")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil {
+		return ErrEmptyConfig
+	}
+	if strings.TrimSpace(cfg.URL) == "" {
+		return ErrURLMissing
+	}
+	return nil
+}
+
+// New connects to the configured NATS server and returns the Publisher and its close function.
+func New(ctx context.Context, cfg *Config) (*Publisher, func() error, error) {
+	if err := validate(cfg); err != nil {
+		return nil, nil, err
+	}
+	opts := []nats.Option{}
+	if len(cfg.Name) != 0 {
+		opts = append(opts, nats.Name(cfg.Name))
+	}
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return NewWithConn(cfg, nc)
+}
+
+// NewWithConn creates a Publisher using conn, which lets a local server stand-in replace NATS.
+func NewWithConn(cfg *Config, conn Conn) (*Publisher, func() error, error) {
+	if cfg == nil {
+		return nil, nil, ErrEmptyConfig
+	}
+	if conn == nil {
+		return nil, nil, ErrConnEmpty
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Publisher{conn: conn, config: cfg}, conn.Drain, nil
+}
+
+// Publish sends msg to subject, or to the configured subject when subject is empty,
+// and waits for the server to receive it.
+func (p *Publisher) Publish(ctx context.Context, subject string, msg []byte) error {
+	if len(subject) == 0 {
+		subject = p.config.Subject
+	}
+	if len(subject) == 0 {
+		return ErrSubjectMissing
+	}
+	if err := p.conn.Publish(subject, msg); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	if err := p.conn.FlushTimeout(p.config.Timeout); err != nil {
+		return fmt.Errorf("failed to flush message: %w", err)
+	}
+	log.Infof(ctx, "Published message to NATS subject %s", subject)
+	return nil
+}
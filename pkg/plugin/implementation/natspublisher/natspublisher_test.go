@@ -0,0 +1,113 @@
+package natspublisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+// runServer starts an in-process NATS server on a random port.
+func runServer(t *testing.T) *server.Server {
+	t.Helper()
+	opts := natstest.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	s := natstest.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	s := runServer(t)
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer nc.Close()
+	sub, err := nc.SubscribeSync(">")
+	if err != nil {
+		t.Fatalf("SubscribeSync() error = %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	p, closer, err := New(ctx, &Config{URL: s.ClientURL(), Subject: "default", Name: "test"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer closer()
+	tests := []struct {
+		name        string
+		subject     string
+		wantSubject string
+	}{
+		{name: "subject", subject: "search", wantSubject: "search"},
+		{name: "configured subject", wantSubject: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Publish(ctx, tt.subject, []byte(`{"context":{}}`)); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			msg, err := sub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatalf("NextMsg() error = %v", err)
+			}
+			if msg.Subject != tt.wantSubject || string(msg.Data) != `{"context":{}}` {
+				t.Errorf("received %s on %s, want the message on %s", msg.Data, msg.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestPublishWithoutSubject(t *testing.T) {
+	s := runServer(t)
+	p, closer, err := New(context.Background(), &Config{URL: s.ClientURL()})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer closer()
+	if err := p.Publish(context.Background(), "", []byte(`{}`)); !errors.Is(err, ErrSubjectMissing) {
+		t.Errorf("Publish() error = %v, want %v", err, ErrSubjectMissing)
+	}
+}
+
+func TestPublishAfterShutdown(t *testing.T) {
+	s := runServer(t)
+	p, closer, err := New(context.Background(), &Config{URL: s.ClientURL(), Subject: "search", Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer closer()
+	s.Shutdown()
+	if err := p.Publish(context.Background(), "", []byte(`{}`)); err == nil {
+		t.Error("Publish() error = nil, want an error while the server is down")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr error
+	}{
+		{name: "nil config", wantErr: ErrEmptyConfig},
+		{name: "no URL", cfg: &Config{Subject: "search"}, wantErr: ErrURLMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := New(context.Background(), tt.cfg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("New() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, _, err := New(context.Background(), &Config{URL: "nats://127.0.0.1:1"}); err == nil {
+		t.Error("New() without server error = nil, want a connection error")
+	}
+}
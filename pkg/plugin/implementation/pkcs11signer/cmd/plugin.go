@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/pkcs11signer"
+	"github.com/ashishGuliya/onix/pkg/remotekey"
+)
+
+// remoteSignerProvider implements the RemoteSignerProvider interface.
+type remoteSignerProvider struct{}
+
+// New creates a new RemoteSigner instance.
+func (rp remoteSignerProvider) New(ctx context.Context, config map[string]string) (definition.RemoteSigner, func() error, error) {
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return pkcs11signer.New(ctx, cfg)
+}
+
+// parseConfig converts the map[string]string to the pkcs11signer.Config struct.
+// The PIN is read from the environment variable named by pinEnv, so that it is not kept in the config file.
+// Either the single keyLabel, subscriberId and uniqueKeyId or keys, "subscriberId|uniqueKeyId|keyLabel[|activeFrom]"
+// separated by ";", or both must be set.
+func parseConfig(config map[string]string) (*pkcs11signer.Config, error) {
+	for _, key := range []string{"module", "tokenLabel", "pinEnv"} {
+		if _, exists := config[key]; !exists {
+			return nil, fmt.Errorf("%s not found in config", key)
+		}
+	}
+	pin, ok := os.LookupEnv(config["pinEnv"])
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", config["pinEnv"])
+	}
+	cfg := &pkcs11signer.Config{
+		Module:       config["module"],
+		TokenLabel:   config["tokenLabel"],
+		Pin:          pin,
+		KeyLabel:     config["keyLabel"],
+		SubscriberID: config["subscriberId"],
+		UniqueKeyID:  config["uniqueKeyId"],
+	}
+	if spec, ok := config["keys"]; ok {
+		keys, err := remotekey.ParseKeys(spec)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Keys = keys
+	}
+	if s, ok := config["poolSize"]; ok {
+		size, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid poolSize: %w", err)
+		}
+		cfg.PoolSize = size
+	}
+	return cfg, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = remoteSignerProvider{}
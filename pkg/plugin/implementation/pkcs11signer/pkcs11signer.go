@@ -0,0 +1,392 @@
+package pkcs11signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ashishGuliya/onix/pkg/authheader"
+	"github.com/ashishGuliya/onix/pkg/remotekey"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 3.0 constants missing from the library.
+const (
+	// ckmEDDSA is the EdDSA mechanism, which signs the message itself rather than a digest.
+	ckmEDDSA = 0x00001057
+	// ckkECEdwards is the key type of EdDSA keys.
+	ckkECEdwards = 0x00000040
+)
+
+// defaultPoolSize is the number of sessions opened when the config does not set one.
+const defaultPoolSize = 4
+
+// oidP256 is the DER encoded curve of P-256 keys, as held in CKA_EC_PARAMS.
+var oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+// Config Required for the module.
+type Config struct {
+	// Module is the path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so.
+	Module string
+	// TokenLabel selects the token holding the key.
+	TokenLabel string
+	// Pin is the user PIN of the token.
+	Pin string
+	// KeyLabel is the label of the ed25519 or P-256 private key object.
+	KeyLabel string
+	// SubscriberID is the subscriber that signs with the key.
+	SubscriberID string
+	// UniqueKeyID is the unique key id of the key registered for SubscriberID.
+	UniqueKeyID string
+	// Keys are further signing keys, whose Ref is the label of a private key object. A subscriber
+	// signs with its key that became active last, so a rotated key is added with a later ActiveFrom.
+	Keys []remotekey.Key
+	// PoolSize is the number of sessions signing concurrently, 4 when zero.
+	PoolSize int
+}
+
+// session is a PKCS#11 session with the handles of the private keys found in it.
+type session struct {
+	handle pkcs11.SessionHandle
+	keys   map[string]pkcs11.ObjectHandle
+}
+
+// signer implements the RemoteSigner interface with private key objects of a PKCS#11 token,
+// which sign on the token so that the key material is never read.
+type signer struct {
+	p11  *pkcs11.Ctx
+	slot uint
+	pin  string
+	keys []remotekey.Key
+	// algorithm holds the algorithm of each key label.
+	algorithm map[string]string
+	// sessions is the pool of idle sessions, as a PKCS#11 session runs one operation at a time.
+	sessions chan *session
+	// mu serializes logging in again, which is done once for all sessions of the token.
+	mu sync.Mutex
+}
+
+// New loads the PKCS#11 library, logs in to the configured token, opens a pool of sessions
+// and returns a signer for the private keys with the configured labels.
+func New(ctx context.Context, cfg *Config) (*signer, func() error, error) {
+	keys, err := configKeys(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	p11 := pkcs11.New(cfg.Module)
+	if p11 == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrModuleNotLoaded, cfg.Module)
+	}
+	if err := p11.Initialize(); err != nil {
+		p11.Destroy()
+		return nil, nil, fmt.Errorf("failed to initialize %s: %w", cfg.Module, err)
+	}
+	poolSize := cfg.PoolSize
+	if poolSize == 0 {
+		poolSize = defaultPoolSize
+	}
+	s := &signer{
+		p11:       p11,
+		pin:       cfg.Pin,
+		keys:      keys,
+		algorithm: map[string]string{},
+		sessions:  make(chan *session, poolSize),
+	}
+	if err := s.open(cfg.TokenLabel, poolSize); err != nil {
+		s.close()
+		return nil, nil, err
+	}
+	return s, s.close, nil
+}
+
+// open finds the token, opens the sessions of the pool, logging in with the first one,
+// and finds the algorithm of each private key.
+func (s *signer) open(tokenLabel string, poolSize int) error {
+	var err error
+	if s.slot, err = s.findSlot(tokenLabel); err != nil {
+		return err
+	}
+	for range poolSize {
+		sess, err := s.openSession()
+		if err != nil {
+			return err
+		}
+		s.sessions <- sess
+	}
+	sess := <-s.sessions
+	defer func() { s.sessions <- sess }()
+	for _, key := range s.keys {
+		if _, ok := s.algorithm[key.Ref]; ok {
+			continue
+		}
+		obj, err := s.privateKey(sess, key.Ref)
+		if err != nil {
+			return err
+		}
+		if s.algorithm[key.Ref], err = s.keyAlgorithm(sess, obj, key.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSlot returns the slot of the token with the label.
+func (s *signer) findSlot(label string) (uint, error) {
+	slots, err := s.p11.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := s.p11.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get token info of slot %d: %w", slot, err)
+		}
+		if info.Label == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrTokenNotFound, label)
+}
+
+// openSession opens a session and logs in to the token, unless an other session already has.
+func (s *signer) openSession() (*session, error) {
+	handle, err := s.p11.OpenSession(s.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	s.mu.Lock()
+	err = s.p11.Login(handle, pkcs11.CKU_USER, s.pin)
+	s.mu.Unlock()
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		s.p11.CloseSession(handle)
+		return nil, fmt.Errorf("failed to log in to token: %w", err)
+	}
+	return &session{handle: handle, keys: map[string]pkcs11.ObjectHandle{}}, nil
+}
+
+// privateKey returns the private key object with the label, which must be unique.
+func (s *signer) privateKey(sess *session, label string) (pkcs11.ObjectHandle, error) {
+	if obj, ok := sess.keys[label]; ok {
+		return obj, nil
+	}
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := s.p11.FindObjectsInit(sess.handle, template); err != nil {
+		return 0, fmt.Errorf("failed to find key %s: %w", label, err)
+	}
+	objs, _, err := s.p11.FindObjects(sess.handle, 2)
+	if ferr := s.p11.FindObjectsFinal(sess.handle); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find key %s: %w", label, err)
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("%w: %s", ErrKeyNotFound, label)
+	case 1:
+		sess.keys[label] = objs[0]
+		return objs[0], nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateKey, label)
+	}
+}
+
+// keyAlgorithm returns the signature algorithm of the private key, from its key type and curve.
+func (s *signer) keyAlgorithm(sess *session, obj pkcs11.ObjectHandle, label string) (string, error) {
+	attrs, err := s.p11.GetAttributeValue(sess.handle, obj, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get attributes of key %s: %w", label, err)
+	}
+	keyType, err := bytesToUint(attrs[0].Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid key type of key %s: %w", label, err)
+	}
+	switch {
+	case keyType == ckkECEdwards:
+		return authheader.AlgorithmEd25519, nil
+	case keyType == pkcs11.CKK_EC && bytes.Equal(attrs[1].Value, oidP256):
+		return authheader.AlgorithmECDSAP256SHA256, nil
+	default:
+		return "", fmt.Errorf("%w: key %s", ErrUnsupportedAlgorithm, label)
+	}
+}
+
+// Sign signs data on the token with the active key of the subscriber, using a session of the pool.
+// A session that the token closed, e.g. after it was reset, is reopened once.
+func (s *signer) Sign(ctx context.Context, subscriberID string, data []byte) (string, string, string, error) {
+	key, err := remotekey.Active(s.keys, subscriberID, time.Now())
+	if err != nil {
+		return "", "", "", err
+	}
+	var sess *session
+	select {
+	case sess = <-s.sessions:
+	case <-ctx.Done():
+		return "", "", "", ctx.Err()
+	}
+	defer func() { s.sessions <- sess }()
+	algorithm := s.algorithm[key.Ref]
+	sig, err := s.sign(sess, key.Ref, algorithm, data)
+	if isSessionLost(err) {
+		var reopened *session
+		if reopened, err = s.reopen(sess); err == nil {
+			sess = reopened
+			sig, err = s.sign(sess, key.Ref, algorithm, data)
+		}
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	return key.UniqueKeyID, algorithm, base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// sign signs data with the private key with the label, hashing it first for ECDSA keys and
+// converting the raw ECDSA signature to ASN.1 DER.
+func (s *signer) sign(sess *session, label, algorithm string, data []byte) ([]byte, error) {
+	obj, err := s.privateKey(sess, label)
+	if err != nil {
+		return nil, err
+	}
+	mechanism := pkcs11.NewMechanism(ckmEDDSA, nil)
+	if algorithm == authheader.AlgorithmECDSAP256SHA256 {
+		digest := sha256.Sum256(data)
+		mechanism, data = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest[:]
+	}
+	if err := s.p11.SignInit(sess.handle, []*pkcs11.Mechanism{mechanism}, obj); err != nil {
+		return nil, fmt.Errorf("failed to initialize signing: %w", err)
+	}
+	sig, err := s.p11.Sign(sess.handle, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	if algorithm == authheader.AlgorithmECDSAP256SHA256 {
+		return ecdsaDER(sig)
+	}
+	return sig, nil
+}
+
+// reopen closes a lost session and opens a new one in its place, logging in again.
+// On failure it returns the lost session, which is retried by the next Sign.
+func (s *signer) reopen(sess *session) (*session, error) {
+	s.p11.CloseSession(sess.handle)
+	reopened, err := s.openSession()
+	if err != nil {
+		return sess, err
+	}
+	return reopened, nil
+}
+
+// close closes the sessions of the pool, logs out of the token and unloads the PKCS#11 library.
+func (s *signer) close() error {
+	var errs []error
+	loggedOut := false
+	for len(s.sessions) > 0 {
+		sess := <-s.sessions
+		if !loggedOut {
+			errs = append(errs, s.p11.Logout(sess.handle))
+			loggedOut = true
+		}
+		errs = append(errs, s.p11.CloseSession(sess.handle))
+	}
+	errs = append(errs, s.p11.Finalize())
+	s.p11.Destroy()
+	return errors.Join(errs...)
+}
+
+// isSessionLost reports whether err means that the session must be reopened.
+func isSessionLost(err error) bool {
+	for _, code := range []uint{pkcs11.CKR_SESSION_HANDLE_INVALID, pkcs11.CKR_SESSION_CLOSED, pkcs11.CKR_USER_NOT_LOGGED_IN} {
+		if errors.Is(err, pkcs11.Error(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ecdsaDER converts a PKCS#11 ECDSA signature, r and s concatenated, to ASN.1 DER.
+func ecdsaDER(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature length %d", len(sig))
+	}
+	n := len(sig) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(sig[:n]),
+		S: new(big.Int).SetBytes(sig[n:]),
+	})
+}
+
+// bytesToUint decodes a CK_ULONG attribute value, which is in native byte order.
+func bytesToUint(b []byte) (uint, error) {
+	switch len(b) {
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b)), nil
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b)), nil
+	default:
+		return 0, fmt.Errorf("invalid length %d", len(b))
+	}
+}
+
+// configKeys validates the config and returns its keys, the single configured key label first.
+func configKeys(cfg *Config) ([]remotekey.Key, error) {
+	if cfg == nil {
+		return nil, ErrNilConfig
+	}
+	if cfg.Module == "" {
+		return nil, ErrEmptyModule
+	}
+	if cfg.TokenLabel == "" {
+		return nil, ErrEmptyTokenLabel
+	}
+	if cfg.PoolSize < 0 {
+		return nil, ErrInvalidPoolSize
+	}
+	var keys []remotekey.Key
+	if cfg.KeyLabel != "" || cfg.SubscriberID != "" || cfg.UniqueKeyID != "" {
+		if cfg.KeyLabel == "" {
+			return nil, ErrEmptyKeyLabel
+		}
+		if cfg.SubscriberID == "" {
+			return nil, ErrEmptySubscriberID
+		}
+		if cfg.UniqueKeyID == "" {
+			return nil, ErrEmptyUniqueKeyID
+		}
+		keys = append(keys, remotekey.Key{SubscriberID: cfg.SubscriberID, UniqueKeyID: cfg.UniqueKeyID, Ref: cfg.KeyLabel})
+	}
+	keys = append(keys, cfg.Keys...)
+	if err := remotekey.Validate(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Error definitions.
+var (
+	ErrNilConfig            = errors.New("invalid config: config cannot be nil")
+	ErrEmptyModule          = errors.New("invalid config: module cannot be empty")
+	ErrEmptyTokenLabel      = errors.New("invalid config: tokenLabel cannot be empty")
+	ErrEmptyKeyLabel        = errors.New("invalid config: keyLabel cannot be empty")
+	ErrEmptySubscriberID    = errors.New("invalid config: subscriberId cannot be empty")
+	ErrEmptyUniqueKeyID     = errors.New("invalid config: uniqueKeyId cannot be empty")
+	ErrInvalidPoolSize      = errors.New("invalid config: poolSize cannot be negative")
+	ErrModuleNotLoaded      = errors.New("failed to load PKCS#11 module")
+	ErrTokenNotFound        = errors.New("token not found")
+	ErrKeyNotFound          = errors.New("private key not found")
+	ErrDuplicateKey         = errors.New("more than one private key with label")
+	ErrUnsupportedAlgorithm = errors.New("unsupported key algorithm")
+)
@@ -5,8 +5,6 @@ import (
 
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
 	"github.com/ashishGuliya/onix/pkg/plugin/implementation/publisher"
-
-	"google.golang.org/api/option"
 )
 
 // config converts the map[string]string to the publisher.Config struct.
@@ -14,6 +12,7 @@ func config(config map[string]string) *publisher.Config {
 	return &publisher.Config{
 		ProjectID: config["project"],
 		TopicID:   config["topic"],
+		Ordering:  config["ordering"] == "true",
 	}
 }
 
@@ -21,8 +20,12 @@ func config(config map[string]string) *publisher.Config {
 type provider struct{}
 
 // New creates a new Publisher instance.
-func (p provider) New(ctx context.Context, c map[string]string, opts ...option.ClientOption) (definition.Publisher, func(), error) {
-	return publisher.New(ctx, config(c), opts...)
+func (p provider) New(ctx context.Context, c map[string]string) (definition.Publisher, func() error, error) {
+	pub, closer, err := publisher.New(ctx, config(c))
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, closer, nil
 }
 
 // Provider is the exported symbol that the plugin manager will look for.
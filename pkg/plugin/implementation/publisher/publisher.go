@@ -2,31 +2,40 @@ package publisher
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/model"
 	"google.golang.org/api/option"
 )
 
 // Config holds the Pub/Sub configuration.
 type Config struct {
 	ProjectID string
-	TopicID   string
+	// TopicID is the topic used when a message is published without a topic.
+	TopicID string
+	// Ordering publishes the messages of a transaction with its transaction_id as ordering key,
+	// so that subscribers with message ordering enabled receive them in order.
+	Ordering bool
 }
 
 // Publisher is a concrete implementation of a Google Cloud Pub/Sub publisher.
 type Publisher struct {
 	client *pubsub.Client
-	topic  *pubsub.Topic
 	config *Config
+
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
 }
 
 var (
 	ErrProjectMissing = errors.New("missing required field 'Project'")
-	ErrTopicMissing   = errors.New("missing required field 'Topic'")
+	ErrTopicMissing   = errors.New("missing topic")
 	ErrEmptyConfig    = errors.New("empty config")
 )
 
@@ -37,15 +46,12 @@ func validate(cfg *Config) error {
 	if strings.TrimSpace(cfg.ProjectID) == "" {
 		return ErrProjectMissing
 	}
-	if strings.TrimSpace(cfg.TopicID) == "" {
-		return ErrTopicMissing
-	}
 	return nil
 }
 
 // New initializes a new Publisher instance.
-// It creates a real pubsub.Client and then calls NewWithClient.
-func New(ctx context.Context, cfg *Config, opts ...option.ClientOption) (*Publisher, func(), error) {
+// It creates a real pubsub.Client and checks that the default topic, when configured, exists.
+func New(ctx context.Context, cfg *Config, opts ...option.ClientOption) (*Publisher, func() error, error) {
 	if err := validate(cfg); err != nil {
 		return nil, nil, err
 	}
@@ -54,46 +60,132 @@ func New(ctx context.Context, cfg *Config, opts ...option.ClientOption) (*Publis
 		return nil, nil, fmt.Errorf("failed to create pubsub client: %w", err)
 	}
 
-	topic := client.Topic(cfg.TopicID)
-	exists, err := topic.Exists(ctx)
+	p := &Publisher{
+		client: client,
+		config: cfg,
+		topics: map[string]*pubsub.Topic{},
+	}
+	if len(cfg.TopicID) != 0 {
+		if _, err := p.topic(ctx, cfg.TopicID); err != nil {
+			_ = client.Close()
+			return nil, nil, err
+		}
+	}
+	return p, p.close, nil
+}
+
+// topic returns the topic with id, opening it and checking that it exists on first use.
+// The existence check calls Pub/Sub, so it runs without holding p.mu; concurrent first uses
+// of a topic may both check it, and the first one to finish is kept.
+func (p *Publisher) topic(ctx context.Context, id string) (*pubsub.Topic, error) {
+	p.mu.Lock()
+	t, ok := p.topics[id]
+	p.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	t = p.client.Topic(id)
+	exists, err := t.Exists(ctx)
 	if err != nil {
-		_ = client.Close()
-		return nil, nil, fmt.Errorf("failed to check topic existence: %w", err)
+		return nil, fmt.Errorf("failed to check topic existence: %w", err)
 	}
 	if !exists {
-		_ = client.Close()
-		return nil, nil, fmt.Errorf("topic %s does not exist", cfg.TopicID)
-	}
-	return &Publisher{
-			client: client,
-			topic:  topic,
-			config: cfg,
-		}, func() {
-			if err := client.Close; err != nil {
-				log.Fatalf(ctx, err(), "Failed to close pubsub client.")
-			}
-		}, nil
+		return nil, fmt.Errorf("topic %s does not exist", id)
+	}
+	t.EnableMessageOrdering = p.config.Ordering
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if opened, ok := p.topics[id]; ok {
+		return opened, nil
+	}
+	p.topics[id] = t
+	return t, nil
+}
+
+// close flushes and stops the opened topics and closes the client.
+func (p *Publisher) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.topics {
+		t.Stop()
+	}
+	return p.client.Close()
 }
 
 // Publisher Methods.
 
-// Publish sends a message to Google Cloud Pub/Sub.
+// Publish sends a message to the Google Cloud Pub/Sub topic, or to the configured topic
+// when topic is empty. The Beckn context of the message is attached as attributes.
 func (p *Publisher) Publish(ctx context.Context, topic string, msg []byte) error {
+	if len(topic) == 0 {
+		topic = p.config.TopicID
+	}
+	if len(topic) == 0 {
+		return ErrTopicMissing
+	}
+	t, err := p.topic(ctx, topic)
+	if err != nil {
+		return err
+	}
+
 	pubsubMsg := &pubsub.Message{
-		Data: msg,
+		Data:       msg,
+		Attributes: attributes(ctx, msg),
+	}
+	if p.config.Ordering {
+		pubsubMsg.OrderingKey = pubsubMsg.Attributes["transaction_id"]
 	}
 
-	result := p.topic.Publish(ctx, pubsubMsg)
+	result := t.Publish(ctx, pubsubMsg)
 	id, err := result.Get(ctx)
 	if err != nil {
+		if len(pubsubMsg.OrderingKey) != 0 {
+			// Publishing for an ordering key pauses after an error until it is resumed.
+			t.ResumePublish(pubsubMsg.OrderingKey)
+		}
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
-	log.Infof(ctx, "Published message with ID: %s\n", id)
+	log.Infof(ctx, "Published message with ID: %s to topic: %s\n", id, topic)
 	return nil
 }
 
-// // Close closes the underlying Pub/Sub client.
-// func (p *Publisher) Close() error {
-// 	return p.client.Close()
-// }
+// attributes returns the message attributes: action, domain, transaction_id and message_id
+// from the Beckn context of msg, and the subscriber_id of the request.
+func attributes(ctx context.Context, msg []byte) map[string]string {
+	var req struct {
+		Context struct {
+			Action        string `json:"action"`
+			Domain        string `json:"domain"`
+			TransactionID string `json:"transaction_id"`
+			MessageID     string `json:"message_id"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(msg, &req); err != nil {
+		log.Debugf(ctx, "Publishing message without context attributes: %v", err)
+	}
+	attrs := map[string]string{
+		"action":         req.Context.Action,
+		"domain":         req.Context.Domain,
+		"transaction_id": req.Context.TransactionID,
+		"message_id":     req.Context.MessageID,
+		"subscriber_id":  subscriberID(ctx),
+	}
+	for k, v := range attrs {
+		if len(v) == 0 {
+			delete(attrs, k)
+		}
+	}
+	return attrs
+}
+
+// subscriberID returns the subscriber id of the request being published.
+func subscriberID(ctx context.Context) string {
+	if stepCtx, ok := ctx.(*model.StepContext); ok && len(stepCtx.SubID) != 0 {
+		return stepCtx.SubID
+	}
+	subID, _ := ctx.Value("subscriber_id").(string)
+	return subID
+}
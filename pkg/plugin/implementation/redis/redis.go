@@ -62,6 +62,11 @@ func (c *Cache) Set(ctx context.Context, key, value string, ttl time.Duration) e
 	return c.client.Set(ctx, key, value, ttl).Err()
 }
 
+// SetIfAbsent stores a value in Redis with a TTL unless the key exists, reporting whether it was stored.
+func (c *Cache) SetIfAbsent(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, ttl).Result()
+}
+
 // Delete removes a value from Redis.
 func (c *Cache) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
@@ -2,45 +2,34 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"time"
 
-	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
 	"github.com/ashishGuliya/onix/pkg/plugin/implementation/router"
-	"gopkg.in/yaml.v2"
 )
 
 type routerProvider struct{}
 
-const pathKey = "routingConfigPath"
-
-// config loads and validates the configuration.
-func config(ctx context.Context, path string) (*router.Config, error) {
-	// Open the configuration file.
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not open config file: %w", err)
-	}
-	defer file.Close()
+const (
+	pathKey           = "routingConfigPath"
+	reloadIntervalKey = "reloadInterval"
+)
 
-	// Decode the YAML configuration.
-	var cfg router.Config
-	if err := yaml.NewDecoder(file).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("could not decode config: %w", err)
+// New creates the router. The routing config is only polled for changes when reloadInterval is set.
+func (vp routerProvider) New(ctx context.Context, cfg map[string]string) (definition.Router, func() error, error) {
+	var interval time.Duration
+	if v, ok := cfg[reloadIntervalKey]; ok {
+		var err error
+		if interval, err = time.ParseDuration(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", reloadIntervalKey, err)
+		}
 	}
-	b, _ := json.MarshalIndent(cfg, "", "  ")
-	log.Debugf(ctx, "Loaded %s, \n%s", path, string(b))
-	return &cfg, nil
-}
-
-func (vp routerProvider) New(ctx context.Context, cfg map[string]string) (definition.Router, error) {
-	c, err := config(ctx, cfg[pathKey])
+	r, closer, err := router.NewWatched(ctx, cfg[pathKey], interval)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return router.New(ctx, c)
+	return r, closer, nil
 }
 
 var Provider = routerProvider{}
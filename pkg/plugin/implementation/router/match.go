@@ -0,0 +1,196 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+// predicate matches the value at a JSON path of the request body.
+type predicate struct {
+	// Path is a dotted JSON path with optional array indices, e.g. message.order.items[0].id.
+	Path string `yaml:"path"`
+	// Equals matches when the value, rendered as a string, is equal to it.
+	Equals string `yaml:"equals"`
+	// Regex matches when the value, rendered as a string, matches the regular expression.
+	Regex string `yaml:"regex"`
+
+	segments []string
+	re       *regexp.Regexp
+}
+
+// compile parses the JSON path and regular expression of the predicate.
+func (p *predicate) compile() error {
+	if len(p.Path) == 0 {
+		return fmt.Errorf("path missing")
+	}
+	if len(p.Equals) == 0 && len(p.Regex) == 0 {
+		return fmt.Errorf("equals or regex required")
+	}
+	segments, err := splitPath(p.Path)
+	if err != nil {
+		return err
+	}
+	p.segments = segments
+	if len(p.Regex) != 0 {
+		if p.re, err = regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the value at the predicate path satisfies it.
+func (p *predicate) matches(body any) bool {
+	v, ok := lookupPath(body, p.segments)
+	if !ok {
+		return false
+	}
+	if len(p.Equals) != 0 && v != p.Equals {
+		return false
+	}
+	return p.re == nil || p.re.MatchString(v)
+}
+
+// splitPath splits a JSON path such as a.b[0].c into the segments a, b, 0 and c.
+func splitPath(p string) ([]string, error) {
+	var segments []string
+	for _, part := range strings.Split(p, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if len(name) != 0 {
+			segments = append(segments, name)
+		}
+		for len(rest) != 0 {
+			idx, after, ok := strings.Cut(rest, "]")
+			if _, err := strconv.Atoi(idx); !ok || err != nil {
+				return nil, fmt.Errorf("invalid path %s: bad array index", p)
+			}
+			segments = append(segments, idx)
+			rest = strings.TrimPrefix(after, "[")
+		}
+		if len(name) == 0 && !strings.Contains(part, "[") {
+			return nil, fmt.Errorf("invalid path %s: empty segment", p)
+		}
+	}
+	return segments, nil
+}
+
+// lookupPath returns the value at the path segments of v rendered as a string.
+// Objects and arrays are not comparable and are reported as missing.
+func lookupPath(v any, segments []string) (string, bool) {
+	for _, s := range segments {
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[s]; !ok {
+				return "", false
+			}
+		case []any:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+	switch leaf := v.(type) {
+	case string:
+		return leaf, true
+	case json.Number:
+		return leaf.String(), true
+	case bool:
+		return strconv.FormatBool(leaf), true
+	default:
+		return "", false
+	}
+}
+
+// request holds the parts of a request the routes match on.
+type request struct {
+	path    string
+	body    any
+	action  string
+	domain  string
+	version string
+	bapID   string
+	bppID   string
+	city    string
+}
+
+// parseRequest extracts the routing criteria from the request URL and body.
+func parseRequest(u *url.URL, rb []byte) (*request, error) {
+	dec := json.NewDecoder(bytes.NewReader(rb))
+	dec.UseNumber()
+	var body map[string]any
+	if err := dec.Decode(&body); err != nil {
+		return nil, model.NewBadReqErrf("invalid request body json")
+	}
+	// Get the "context" field.
+	contextRaw, ok := body["context"]
+	if !ok {
+		return nil, model.NewBadReqErrf("context field not found")
+	}
+	contextData, ok := contextRaw.(map[string]any)
+	if !ok {
+		return nil, model.NewBadReqErrf("invalid request.context json")
+	}
+	req := &request{body: body}
+	if req.action, ok = contextData["action"].(string); !ok {
+		return nil, model.NewBadReqErrf("invalid request.context.action json")
+	}
+	if u != nil {
+		req.path = u.Path
+	}
+	req.domain, _ = lookupPath(contextData, []string{"domain"})
+	if req.version, ok = lookupPath(contextData, []string{"version"}); !ok {
+		req.version, _ = lookupPath(contextData, []string{"core_version"})
+	}
+	req.bapID, _ = lookupPath(contextData, []string{"bap_id"})
+	req.bppID, _ = lookupPath(contextData, []string{"bpp_id"})
+	if req.city, ok = lookupPath(contextData, []string{"location", "city", "code"}); !ok {
+		req.city, _ = lookupPath(contextData, []string{"city"})
+	}
+	return req, nil
+}
+
+// hasMatchers reports whether the route sets any matcher.
+func (r *route) hasMatchers() bool {
+	return len(r.Action) != 0 || len(r.Domain) != 0 || len(r.Version) != 0 || len(r.BapID) != 0 ||
+		len(r.BppID) != 0 || len(r.City) != 0 || len(r.Path) != 0 || len(r.Match) != 0
+}
+
+// matches reports whether every matcher of the route matches the request.
+func (r *route) matches(req *request) bool {
+	for _, m := range []struct{ want, got string }{
+		{r.Action, req.action},
+		{r.Domain, req.domain},
+		{r.Version, req.version},
+		{r.BapID, req.bapID},
+		{r.BppID, req.bppID},
+		{r.City, req.city},
+	} {
+		if len(m.want) != 0 && m.want != m.got {
+			return false
+		}
+	}
+	if len(r.Path) != 0 {
+		if ok, _ := path.Match(r.Path, req.path); !ok {
+			return false
+		}
+	}
+	for i := range r.Match {
+		if !r.Match[i].matches(req.body) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+)
+
+func TestRoute(t *testing.T) {
+	routes := []route{
+		{Action: "search", Domain: "retail", Type: "url", Target: "http://retail.example.com"},
+		{Action: "search", Version: "1.1.0", City: "std:080", Type: "url", Target: "http://blr.example.com"},
+		{Action: "search", BppID: "bpp1", Type: "url", Target: "http://bpp1.example.com", Priority: 10},
+		{Path: "/bpp/receiver/*", Action: "select", Type: "url", Target: "http://receiver.example.com"},
+		{Action: "confirm", Match: []predicate{{Path: "message.order.items[0].id", Equals: "i1"}}, Type: "url", Target: "http://item.example.com"},
+		{Action: "confirm", Match: []predicate{{Path: "message.order.quote.price.value", Regex: `^[0-9]{4,}$`}}, Type: "url", Target: "http://large.example.com"},
+		{Action: "confirm", Match: []predicate{{Path: "message.order.paid", Equals: "true"}}, Type: "url", Target: "http://paid.example.com"},
+		{Default: true, Type: "url", Target: "http://default.example.com"},
+	}
+	r, err := New(context.Background(), &Config{Routes: routes})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{
+			name: "action and domain",
+			body: `{"context":{"action":"search","domain":"retail"}}`,
+			want: "http://retail.example.com",
+		},
+		{
+			name: "version and location city",
+			body: `{"context":{"action":"search","domain":"mobility","version":"1.1.0","location":{"city":{"code":"std:080"}}}}`,
+			want: "http://blr.example.com",
+		},
+		{
+			name: "core_version and legacy city",
+			body: `{"context":{"action":"search","core_version":"1.1.0","city":"std:080"}}`,
+			want: "http://blr.example.com",
+		},
+		{
+			name: "priority before config order",
+			body: `{"context":{"action":"search","domain":"retail","bpp_id":"bpp1"}}`,
+			want: "http://bpp1.example.com",
+		},
+		{
+			name: "path pattern",
+			path: "/bpp/receiver/select",
+			body: `{"context":{"action":"select"}}`,
+			want: "http://receiver.example.com",
+		},
+		{
+			name: "path pattern mismatch",
+			path: "/bap/caller/select",
+			body: `{"context":{"action":"select"}}`,
+			want: "http://default.example.com",
+		},
+		{
+			name: "array index predicate",
+			body: `{"context":{"action":"confirm"},"message":{"order":{"items":[{"id":"i1"}]}}}`,
+			want: "http://item.example.com",
+		},
+		{
+			name: "regex predicate on number",
+			body: `{"context":{"action":"confirm"},"message":{"order":{"quote":{"price":{"value":12000}}}}}`,
+			want: "http://large.example.com",
+		},
+		{
+			name: "boolean predicate",
+			body: `{"context":{"action":"confirm"},"message":{"order":{"paid":true}}}`,
+			want: "http://paid.example.com",
+		},
+		{
+			name: "predicate on object is missing",
+			body: `{"context":{"action":"confirm"},"message":{"order":{"items":[{"id":{"value":"i1"}}]}}}`,
+			want: "http://default.example.com",
+		},
+		{
+			name: "no match uses default",
+			body: `{"context":{"action":"init"}}`,
+			want: "http://default.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Route(context.Background(), &url.URL{Path: tt.path}, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Route() error = %v", err)
+			}
+			if got.URL.String() != tt.want {
+				t.Errorf("Route() = %s, want %s", got.URL, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	r, err := New(context.Background(), &Config{Routes: []route{{Action: "search", Type: "url", Target: "http://bpp.example.com"}}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		body string
+		want any
+	}{
+		{name: "invalid json", body: `{`, want: &model.BadReqErr{}},
+		{name: "no context", body: `{"message":{}}`, want: &model.BadReqErr{}},
+		{name: "no action", body: `{"context":{}}`, want: &model.BadReqErr{}},
+		{name: "no route", body: `{"context":{"action":"init"}}`, want: &model.NotFoundErr{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Route(context.Background(), &url.URL{}, []byte(tt.body))
+			target := reflect.New(reflect.TypeOf(tt.want)).Interface()
+			if !errors.As(err, target) {
+				t.Errorf("Route() error = %v, want %T", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []route
+	}{
+		{name: "no matchers", routes: []route{{Type: "url", Target: "http://a.example.com"}}},
+		{name: "default with matchers", routes: []route{{Default: true, Action: "search", Type: "url", Target: "http://a.example.com"}}},
+		{name: "two defaults", routes: []route{
+			{Default: true, Type: "url", Target: "http://a.example.com"},
+			{Default: true, Type: "url", Target: "http://b.example.com"},
+		}},
+		{name: "invalid path pattern", routes: []route{{Path: "/bpp/[", Type: "url", Target: "http://a.example.com"}}},
+		{name: "predicate without path", routes: []route{{Match: []predicate{{Equals: "x"}}, Type: "url", Target: "http://a.example.com"}}},
+		{name: "predicate without condition", routes: []route{{Match: []predicate{{Path: "context.city"}}, Type: "url", Target: "http://a.example.com"}}},
+		{name: "invalid regex", routes: []route{{Match: []predicate{{Path: "context.city", Regex: "("}}, Type: "url", Target: "http://a.example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := valid(&Config{Routes: tt.routes}); err == nil {
+				t.Error("valid() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "context.action", want: []string{"context", "action"}},
+		{path: "message.order.items[0].id", want: []string{"message", "order", "items", "0", "id"}},
+		{path: "a[1][2]", want: []string{"a", "1", "2"}},
+		{path: "a..b", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a[1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := splitPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
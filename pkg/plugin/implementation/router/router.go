@@ -3,11 +3,18 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"net/url"
+	"os"
+	"path"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/ashishGuliya/onix/pkg/log"
 	"github.com/ashishGuliya/onix/pkg/model"
+	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
@@ -15,67 +22,186 @@ type Config struct {
 }
 
 // route struct to define routing rules.
+// A request matches a route when every configured matcher matches; empty matchers match anything.
 type route struct {
 	// Action is one of the matching criteria.
 	Action string `yaml:"action"`
+	// Domain, Version, BapID, BppID and City match the corresponding request.context fields.
+	Domain  string `yaml:"domain"`
+	Version string `yaml:"version"`
+	BapID   string `yaml:"bap_id"`
+	BppID   string `yaml:"bpp_id"`
+	City    string `yaml:"city"`
+	// Path matches the request URL path, using path.Match patterns.
+	Path string `yaml:"path"`
+	// Match lists JSON path predicates on the request body.
+	Match []predicate `yaml:"match"`
+	// Priority orders the evaluation of routes, highest first; ties keep the config order.
+	Priority int `yaml:"priority"`
+	// Default marks the fallback route used when no other route matches.
+	Default bool `yaml:"default"`
 
+	// Type is url, publisher or dynamic. Dynamic routes have no target, the handler resolves
+	// it from the bap_uri/bpp_uri of the request context and the registry.
 	Type string
 	// Target is the URL to proxy to if all criteria match.
 	Target string `yaml:"target"`
+	// Targets lists weighted URLs for url routes, used instead of Target to balance and fail over.
+	Targets []target `yaml:"targets"`
 }
 
+// target is a weighted URL of a route.
+type target struct {
+	URL string `yaml:"url"`
+	// Weight defaults to 1, zero marks a standby target used only on failover.
+	Weight *int `yaml:"weight"`
+}
+
+// Reload counters per routing config path, served by expvar at /debug/vars.
+var (
+	reloads        = expvar.NewMap("routerReloads")
+	reloadFailures = expvar.NewMap("routerReloadFailures")
+)
+
+// dynamicRouteType is the route type whose target is resolved by the handler.
+const dynamicRouteType = "dynamic"
+
 type router struct {
-	cfg *Config
+	cfg atomic.Pointer[Config]
 }
 
 func (r *router) Route(ctx context.Context, url *url.URL, rb []byte) (*model.Route, error) {
-
-	var data map[string]json.RawMessage
-	if err := json.Unmarshal(rb, &data); err != nil {
-		return nil, model.NewBadReqErrf("invalid request body json")
-	}
-	// Get the "context" field as a RawMessage.
-	contextRaw, ok := data["context"]
-	if !ok {
-		return nil, model.NewBadReqErrf("context field not found")
-	}
-	// Unmarshal the "context" RawMessage into a map.
-	var contextData map[string]interface{}
-	if err := json.Unmarshal(contextRaw, &contextData); err != nil {
-		return nil, model.NewBadReqErrf("invalid request.context json")
+	req, err := parseRequest(url, rb)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update the TransactionID in the Context.
-	rAction, ok := contextData["action"].(string)
-	if !ok {
-		return nil, model.NewBadReqErrf("invalid request.context.action json")
+	cfg := r.cfg.Load()
+	var fallback *route
+	for i := range cfg.Routes {
+		route := &cfg.Routes[i]
+		if route.Default {
+			fallback = route
+			continue
+		}
+		if route.matches(req) {
+			log.Debugf(ctx, "Got route: %#v", route)
+			return route.target()
+		}
+	}
+	if fallback != nil {
+		log.Debugf(ctx, "Got default route: %#v", fallback)
+		return fallback.target()
 	}
+	return nil, model.NewNotFoundErrf("unsupported request.action: %v", req.action)
+}
 
-	for _, route := range r.cfg.Routes {
-		if route.Action == rAction {
-			resp := &model.Route{}
-			log.Debugf(ctx, "Got route: %#v", route)
-			resp.Type = route.Type
-			if resp.Type == "url" {
-				log.Debugf(ctx, "resp.Type : %s", route.Type)
-				url, err := url.Parse(route.Target)
+// target builds the model.Route for the route.
+func (r *route) target() (*model.Route, error) {
+	resp := &model.Route{Type: r.Type}
+	switch resp.Type {
+	case dynamicRouteType:
+	case "url":
+		if len(r.Targets) != 0 {
+			for _, t := range r.Targets {
+				url, err := url.Parse(t.URL)
 				if err != nil {
-					return nil, fmt.Errorf("url.Parse(%s): %w", route.Target, err)
+					return nil, fmt.Errorf("url.Parse(%s): %w", t.URL, err)
 				}
-				resp.URL = url
-			} else {
-				resp.Publisher = route.Target
+				weight := 1
+				if t.Weight != nil {
+					weight = *t.Weight
+				}
+				resp.Targets = append(resp.Targets, model.Target{URL: url, Weight: weight})
 			}
-			return resp, nil
+			resp.URL = resp.Targets[0].URL
+			break
+		}
+		url, err := url.Parse(r.Target)
+		if err != nil {
+			return nil, fmt.Errorf("url.Parse(%s): %w", r.Target, err)
 		}
+		resp.URL = url
+	default:
+		resp.Publisher = r.Target
 	}
-	return nil, model.NewNotFoundErrf("unsupported request.action: %v", rAction)
+	return resp, nil
 }
 
+// valid checks the routing rules, compiles their predicates and sorts them by priority.
 func valid(c *Config) error {
 	if c == nil {
 		return fmt.Errorf("nil config")
 	}
+	defaults := 0
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if len(r.Targets) != 0 {
+			if err := validTargets(r); err != nil {
+				return fmt.Errorf("routes[%d]: %w", i, err)
+			}
+		} else if len(r.Target) == 0 && r.Type != dynamicRouteType {
+			return fmt.Errorf("routes[%d]: target missing", i)
+		}
+		if r.Type == "url" {
+			if _, err := url.Parse(r.Target); err != nil {
+				return fmt.Errorf("routes[%d]: invalid target url: %w", i, err)
+			}
+		}
+		if r.Default {
+			if defaults++; defaults > 1 {
+				return fmt.Errorf("routes[%d]: only one default route allowed", i)
+			}
+			if r.hasMatchers() {
+				return fmt.Errorf("routes[%d]: default route cannot have matchers", i)
+			}
+			continue
+		}
+		if !r.hasMatchers() {
+			return fmt.Errorf("routes[%d]: no matchers, set default: true for a fallback route", i)
+		}
+		if len(r.Path) != 0 {
+			if _, err := path.Match(r.Path, ""); err != nil {
+				return fmt.Errorf("routes[%d]: invalid path pattern: %w", i, err)
+			}
+		}
+		for j := range r.Match {
+			if err := r.Match[j].compile(); err != nil {
+				return fmt.Errorf("routes[%d].match[%d]: %w", i, j, err)
+			}
+		}
+	}
+	sort.SliceStable(c.Routes, func(i, j int) bool {
+		return c.Routes[i].Priority > c.Routes[j].Priority
+	})
+	return nil
+}
+
+// validTargets checks the weighted targets of a route.
+func validTargets(r *route) error {
+	if r.Type != "url" {
+		return fmt.Errorf("targets are only supported for url routes")
+	}
+	if len(r.Target) != 0 {
+		return fmt.Errorf("set either target or targets")
+	}
+	weights := 0
+	for j, t := range r.Targets {
+		if _, err := url.Parse(t.URL); err != nil || len(t.URL) == 0 {
+			return fmt.Errorf("targets[%d]: invalid url: %s", j, t.URL)
+		}
+		if t.Weight == nil {
+			weights++
+			continue
+		}
+		if *t.Weight < 0 {
+			return fmt.Errorf("targets[%d]: weight cannot be negative", j)
+		}
+		weights += *t.Weight
+	}
+	if weights == 0 {
+		return fmt.Errorf("at least one target needs a positive weight")
+	}
 	return nil
 }
 
@@ -84,5 +210,98 @@ func New(ctx context.Context, c *Config) (*router, error) {
 		return nil, fmt.Errorf("invalid config: %v", err)
 	}
 
-	return &router{cfg: c}, nil
+	r := &router{}
+	r.cfg.Store(c)
+	return r, nil
+}
+
+// NewWatched creates a router from the routing config at path and, when interval is positive,
+// polls the file every interval, swapping in the new rules once they load and validate.
+// Invalid rules are logged and the previous rules stay in use.
+// The returned closer stops the polling.
+func NewWatched(ctx context.Context, path string, interval time.Duration) (*router, func() error, error) {
+	c, err := LoadConfig(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := New(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if interval <= 0 {
+		return r, nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not stat config file: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go r.watch(ctx, path, interval, info)
+	log.Infof(ctx, "Watching %s for routing changes every %s", path, interval)
+	return r, func() error {
+		cancel()
+		return nil
+	}, nil
+}
+
+// watch reloads the routing config at path whenever its modification time or size changes.
+func (r *router) watch(ctx context.Context, path string, interval time.Duration, last os.FileInfo) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Errorf(ctx, err, "Failed to stat routing config %s", path)
+				continue
+			}
+			if info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			if err := r.reload(ctx, path); err != nil {
+				reloadFailures.Add(path, 1)
+				log.Errorf(ctx, err, "Failed to reload routing config %s, keeping previous rules", path)
+				continue
+			}
+			reloads.Add(path, 1)
+			log.Infof(ctx, "Reloaded routing config %s, reload count: %s", path, reloads.Get(path))
+		}
+	}
+}
+
+// reload loads and validates the routing config at path and atomically swaps it in.
+func (r *router) reload(ctx context.Context, path string) error {
+	c, err := LoadConfig(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := valid(c); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	r.cfg.Store(c)
+	return nil
+}
+
+// LoadConfig reads the routing config from the YAML file at path.
+func LoadConfig(ctx context.Context, path string) (*Config, error) {
+	// Open the configuration file.
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open config file: %w", err)
+	}
+	defer file.Close()
+
+	// Decode the YAML configuration.
+	var cfg Config
+	if err := yaml.NewDecoder(file).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("could not decode config: %w", err)
+	}
+	b, _ := json.MarshalIndent(cfg, "", "  ")
+	log.Debugf(ctx, "Loaded %s, \n%s", path, string(b))
+	return &cfg, nil
 }
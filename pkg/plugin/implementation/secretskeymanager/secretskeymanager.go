@@ -14,7 +14,7 @@ import (
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 
-	"github.com/ashishGuliya/onix/pkg/model"
+	"github.com/ashishGuliya/onix/pkg/keyring"
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
 	"github.com/google/uuid"
 	"github.com/googleapis/gax-go/v2"
@@ -35,11 +35,19 @@ type secretMgr interface {
 	Close() error
 }
 
+// secretPayload is the JSON document stored in each secret version.
+type secretPayload struct {
+	UniqueKeyID       string          `json:"uniqueKeyID"`
+	SigningPrivateKey string          `json:"signingPrivateKey"`
+	EncrPrivateKey    string          `json:"encrPrivateKey"`
+	ValidUntil        time.Time       `json:"validUntil,omitzero"`
+	Previous          []secretPayload `json:"previous,omitempty"`
+}
+
 type keyMgr struct {
 	projectID    string
 	secretClient secretMgr
-	registry     definition.RegistryLookup
-	cache        definition.Cache
+	public       *keyring.PublicKeys
 }
 
 // New method creates a new KeyManager instance.
@@ -64,9 +72,8 @@ func New(ctx context.Context, cache definition.Cache, registryLookup definition.
 	km := &keyMgr{
 		projectID:    cfg.ProjectID,
 		secretClient: secretClient,
-		registry:     registryLookup,
-		cache:        cache,
 	}
+	km.public = &keyring.PublicKeys{Cache: cache, Registry: registryLookup, Local: km.Keyset}
 
 	return km, km.close, nil
 }
@@ -111,7 +118,6 @@ func (km *keyMgr) StorePrivateKeys(ctx context.Context, keyID string, keys *defi
 		return ErrNilKeySet
 	}
 	secretID := keyID
-	secretName := fmt.Sprintf("projects/%s/secrets/%s", km.projectID, keyID)
 
 	// Create secret.
 	_, err := km.secretClient.CreateSecret(ctx, &secretmanagerpb.CreateSecretRequest{
@@ -140,20 +146,73 @@ func (km *keyMgr) StorePrivateKeys(ctx context.Context, keyID string, keys *defi
 		return fmt.Errorf("failed to create secret: %w", err)
 	}
 
-	keyData := map[string]string{
-		"uniqueKeyID":       keys.UniqueKeyID,
-		"signingPrivateKey": keys.SigningPrivate,
-		"encrPrivateKey":    keys.EncrPrivate,
+	return km.addKeyVersion(ctx, keyID, &secretPayload{
+		UniqueKeyID:       keys.UniqueKeyID,
+		SigningPrivateKey: keys.SigningPrivate,
+		EncrPrivateKey:    keys.EncrPrivate,
+	})
+}
+
+// RotatePrivateKeys adds a new secret version with keys as the active keyset,
+// retaining the previously active keysets until the grace period has elapsed.
+func (km *keyMgr) RotatePrivateKeys(ctx context.Context, keyID string, keys *definition.Keyset, grace time.Duration) error {
+	if keyID == "" {
+		return ErrEmptyKeyID
 	}
+	if keys == nil {
+		return ErrNilKeySet
+	}
+	current, err := km.readPayload(ctx, keyID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return km.StorePrivateKeys(ctx, keyID, keys)
+		}
+		return err
+	}
+
+	return km.addKeyVersion(ctx, keyID, newPayload(keyring.Rotate(current.keysets(), keys, grace, time.Now())))
+}
+
+// keysets returns the keysets of the payload, the active one first.
+func (p *secretPayload) keysets() []definition.Keyset {
+	ring := make([]definition.Keyset, 0, 1+len(p.Previous))
+	for _, k := range append([]secretPayload{*p}, p.Previous...) {
+		ring = append(ring, definition.Keyset{
+			UniqueKeyID:    k.UniqueKeyID,
+			SigningPrivate: k.SigningPrivateKey,
+			EncrPrivate:    k.EncrPrivateKey,
+			ValidUntil:     k.ValidUntil,
+		})
+	}
+	return ring
+}
+
+// newPayload returns the payload storing ring, whose first keyset is the active one.
+func newPayload(ring []definition.Keyset) *secretPayload {
+	payloads := make([]secretPayload, 0, len(ring))
+	for _, k := range ring {
+		payloads = append(payloads, secretPayload{
+			UniqueKeyID:       k.UniqueKeyID,
+			SigningPrivateKey: k.SigningPrivate,
+			EncrPrivateKey:    k.EncrPrivate,
+			ValidUntil:        k.ValidUntil,
+		})
+	}
+	p := &payloads[0]
+	p.Previous = payloads[1:]
+	return p
+}
 
-	payload, err := json.Marshal(keyData)
+// addKeyVersion stores the payload as the latest version of the keyID secret.
+func (km *keyMgr) addKeyVersion(ctx context.Context, keyID string, p *secretPayload) error {
+	payload, err := json.Marshal(p)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Store the secret.
 	_, err = km.secretClient.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
-		Parent:  secretName,
+		Parent:  fmt.Sprintf("projects/%s/secrets/%s", km.projectID, keyID),
 		Payload: &secretmanagerpb.SecretPayload{Data: payload},
 	})
 	if err != nil {
@@ -178,15 +237,30 @@ func (km *keyMgr) EncrPrivateKey(ctx context.Context, keyID string) (string, str
 	// Get Private Keys from Secret Manager.
 	keys, err := km.getPrivateKeys(ctx, keyID)
 	if err != nil {
-		return "", " ", err
+		return "", "", err
 	}
-	return keys.EncrPrivate, keys.UniqueKeyID, nil
+	return keys.UniqueKeyID, keys.EncrPrivate, nil
+}
+
+// Keyset returns the keyset with uniqueKeyID, the active one or a previous one until its ValidUntil.
+func (km *keyMgr) Keyset(ctx context.Context, keyID, uniqueKeyID string) (*definition.Keyset, error) {
+	if keyID == "" {
+		return nil, ErrEmptyKeyID
+	}
+	if uniqueKeyID == "" {
+		return nil, ErrEmptyUniqueKeyID
+	}
+	p, err := km.readPayload(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Find(p.keysets(), uniqueKeyID, time.Now())
 }
 
 // SigningPublicKey returns the Signing Public key.
 func (km *keyMgr) SigningPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error) {
 	// Getting public key data from cache or registry
-	keys, err := km.getPublicKeys(ctx, subscriberID, uniqueKeyID)
+	keys, err := km.public.Get(ctx, subscriberID, uniqueKeyID)
 	if err != nil {
 		return "", err
 	}
@@ -196,7 +270,7 @@ func (km *keyMgr) SigningPublicKey(ctx context.Context, subscriberID, uniqueKeyI
 
 // EncrPublicKey returns the Encryption Public key.
 func (km *keyMgr) EncrPublicKey(ctx context.Context, subscriberID, uniqueKeyID string) (string, error) {
-	keys, err := km.getPublicKeys(ctx, subscriberID, uniqueKeyID)
+	keys, err := km.public.Get(ctx, subscriberID, uniqueKeyID)
 	if err != nil {
 		return "", err
 	}
@@ -231,88 +305,39 @@ func encodeBase64(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
 }
 
-// getPrivateKeys fetches private keys from sercret manager.
+// getPrivateKeys fetches the active private keys from sercret manager.
 func (km *keyMgr) getPrivateKeys(ctx context.Context, keyID string) (*definition.Keyset, error) {
 	if keyID == "" {
 		return nil, ErrEmptyKeyID
 	}
 
-	secretID := keyID
-	secretName := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", km.projectID, secretID)
-
-	res, err := km.secretClient.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
-		Name: secretName,
-	})
+	p, err := km.readPayload(ctx, keyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to access secret version: %w", err)
-	}
-
-	var keyData map[string]string
-	if err := json.Unmarshal(res.Payload.Data, &keyData); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+		return nil, err
 	}
 	return &definition.Keyset{
-		UniqueKeyID:    keyData["uniqueKeyID"],
-		SigningPrivate: keyData["signingPrivateKey"],
-		EncrPrivate:    keyData["encrPrivateKey"],
+		UniqueKeyID:    p.UniqueKeyID,
+		SigningPrivate: p.SigningPrivateKey,
+		EncrPrivate:    p.EncrPrivateKey,
 	}, nil
 }
 
-// getPublicKeys fetches public keys from the registry or cache.
-func (km *keyMgr) getPublicKeys(ctx context.Context, subscriberID, uniqueKeyID string) (*definition.Keyset, error) {
-	if err := validateParams(subscriberID, uniqueKeyID); err != nil {
-		return nil, err
-	}
-
-	// Check if the public keys corresponding to the subscriberID and uniqueKeyID are present in cache or not.
-	cacheKey := fmt.Sprintf("%s_%s", subscriberID, uniqueKeyID)
-
-	cachedData, err := km.cache.Get(ctx, cacheKey)
-	if err == nil {
-		// Cache hit: keys are present in cache,so return the keys.
-		var keys definition.Keyset
-		if err := json.Unmarshal([]byte(cachedData), &keys); err == nil {
-			return &keys, nil
-		}
-	}
-
-	// Cache miss: fetch from registry.
-	publicKeys, err := km.lookupRegistry(ctx, subscriberID, uniqueKeyID)
-	if err != nil {
-		return publicKeys, err
-	}
-
-	// Set fetched values in cache.
-	cacheValue, err := json.Marshal(publicKeys)
-	if err == nil {
-		err := km.cache.Set(ctx, cacheKey, string(cacheValue), time.Hour)
-		if err != nil {
-			// Log
-		}
-	}
+// readPayload fetches the latest version of the keyID secret.
+func (km *keyMgr) readPayload(ctx context.Context, keyID string) (*secretPayload, error) {
+	secretName := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", km.projectID, keyID)
 
-	return publicKeys, nil
-}
-
-// lookupRegistry makes the lookup call to registry using registryLookup implementation.
-func (km *keyMgr) lookupRegistry(ctx context.Context, subscriberID, uniqueKeyID string) (*definition.Keyset, error) {
-	subscribers, err := km.registry.Lookup(ctx, &model.Subscription{
-		Subscriber: model.Subscriber{
-			SubscriberID: subscriberID,
-		},
-		KeyID: uniqueKeyID,
+	res, err := km.secretClient.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: secretName,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup registry: %w", err)
+		return nil, fmt.Errorf("failed to access secret version: %w", err)
 	}
 
-	if len(subscribers) == 0 {
-		return nil, ErrSubscriberNotFound
+	var p secretPayload
+	if err := json.Unmarshal(res.Payload.Data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
-	return &definition.Keyset{
-		SigningPublic: subscribers[0].SigningPublicKey,
-		EncrPublic:    subscribers[0].EncrPublicKey,
-	}, nil
+	return &p, nil
 }
 
 // validateCfg validates the config.
@@ -323,24 +348,16 @@ func validateCfg(cfg *Config) error {
 	return nil
 }
 
-func validateParams(subscriberID, uniqueKeyID string) error {
-	if subscriberID == "" {
-		return ErrEmptySubscriberID
-	}
-	if uniqueKeyID == "" {
-		return ErrEmptyUniqueKeyID
-	}
-	return nil
-}
-
 // Error definitions.
 var (
 	ErrEmptyProjectID     = errors.New("invalid config: projectID cannot be empty")
 	ErrNilCache           = errors.New("cache  cannot be nil")
 	ErrNilKeySet          = errors.New("keyset cannot be nil")
 	ErrNilRegistryLookup  = errors.New("registrylookup  cannot be nil")
-	ErrEmptySubscriberID  = errors.New("invalid request: subscriberID cannot be empty")
-	ErrEmptyUniqueKeyID   = errors.New("invalid request: uniqueKeyID cannot be empty")
+	ErrEmptySubscriberID  = keyring.ErrEmptySubscriberID
+	ErrEmptyUniqueKeyID   = keyring.ErrEmptyUniqueKeyID
 	ErrEmptyKeyID         = errors.New("invalid request: keyID cannot be empty")
-	ErrSubscriberNotFound = errors.New("no subscriber found with given credentials")
+	ErrSubscriberNotFound = keyring.ErrSubscriberNotFound
+	ErrKeyNotFound        = keyring.ErrKeysetNotFound
+	ErrKeyExpired         = keyring.ErrKeyExpired
 )
@@ -7,8 +7,7 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/ashishGuliya/onix/pkg/log"
-	"golang.org/x/crypto/blake2b"
+	"github.com/ashishGuliya/onix/pkg/authheader"
 )
 
 // signer implements the signer interface and handles the signing process.
@@ -21,21 +20,6 @@ func New() (*signer, func() error, error) {
 	return s, nil, nil
 }
 
-// signingStr generates a signing string using BLAKE-512 hashing.
-func signingStr(payload []byte, createdAt, expiresAt int64) (string, error) {
-	hasher, _ := blake2b.New512(nil)
-
-	_, err := hasher.Write(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash payload: %w", err)
-	}
-
-	hashSum := hasher.Sum(nil)
-	digestB64 := base64.StdEncoding.EncodeToString(hashSum)
-
-	return fmt.Sprintf("(created): %d\n(expires): %d\ndigest: BLAKE-512=%s", createdAt, expiresAt, digestB64), nil
-}
-
 // generateSignature signs the given signing string using the provided private key.
 func generateSignature(signingString []byte, privateKeyBase64 string) ([]byte, error) {
 	privateKeyBytes, err := base64.StdEncoding.DecodeString(privateKeyBase64)
@@ -53,12 +37,7 @@ func generateSignature(signingString []byte, privateKeyBase64 string) ([]byte, e
 
 // Sign generates a digital signature for the provided payload.
 func (s *signer) Sign(ctx context.Context, body []byte, privateKeyBase64 string, createdAt, expiresAt int64) (string, error) {
-	log.Debugf(ctx, "Attempting to sign with Key %s", privateKeyBase64)
-	signingString, err := signingStr(body, createdAt, expiresAt)
-	if err != nil {
-		return "", err
-	}
-
+	signingString := authheader.SigningString(body, createdAt, expiresAt)
 	signature, err := generateSignature([]byte(signingString), privateKeyBase64)
 	if err != nil {
 		return "", err
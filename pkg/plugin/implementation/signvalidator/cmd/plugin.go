@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ashishGuliya/onix/pkg/plugin/definition"
 	"github.com/ashishGuliya/onix/pkg/plugin/implementation/signvalidator"
@@ -12,7 +15,29 @@ type validatorProvider struct{}
 
 // New initializes a new Verifier instance.
 func (vp validatorProvider) New(ctx context.Context, config map[string]string) (definition.SignValidator, func() error, error) {
-	return signvalidator.New()
+	cfg, err := parseConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return signvalidator.New(cfg)
+}
+
+// parseConfig converts the map[string]string to the signvalidator.Config struct.
+func parseConfig(config map[string]string) (*signvalidator.Config, error) {
+	cfg := &signvalidator.Config{}
+	if s, ok := config["allowedSkew"]; ok {
+		skew, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowedSkew: %w", err)
+		}
+		cfg.AllowedSkew = skew
+	}
+	if s, ok := config["algorithms"]; ok {
+		for _, name := range strings.Split(s, ",") {
+			cfg.Algorithms = append(cfg.Algorithms, strings.TrimSpace(name))
+		}
+	}
+	return cfg, nil
 }
 
 // Provider is the exported symbol that the plugin manager will look for.
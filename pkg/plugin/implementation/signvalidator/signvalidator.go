@@ -2,29 +2,83 @@ package signvalidator
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/blake2b"
+	"github.com/ashishGuliya/onix/pkg/authheader"
 )
 
+// Config holds the sign validator configuration.
+type Config struct {
+	// AllowedSkew tolerates clocks of signers that are ahead or behind by up to this duration.
+	AllowedSkew time.Duration
+	// Algorithms are the accepted signature algorithms, ed25519 only when empty. Each must be
+	// registered, see Register.
+	Algorithms []string
+}
+
+// VerifyFunc verifies signature over message with a public key, all decoded from base64.
+type VerifyFunc func(publicKey, message, signature []byte) error
+
+// verifiers holds the registered signature algorithms by name.
+var verifiers = map[string]VerifyFunc{
+	authheader.AlgorithmEd25519:         verifyEd25519,
+	authheader.AlgorithmECDSAP256SHA256: verifyECDSAP256SHA256,
+}
+
+// Register adds a signature algorithm, so that validators configured with its name accept it.
+// It must be called before the validators are created.
+func Register(name string, verify VerifyFunc) {
+	verifiers[name] = verify
+}
+
 // validator implements the validator interface.
 type validator struct {
+	config *Config
+	// verifiers are the accepted algorithms.
+	verifiers map[string]VerifyFunc
 }
 
 // New creates a new Verifier instance.
-func New() (*validator, func() error, error) {
-	v := &validator{}
+func New(cfg *Config) (*validator, func() error, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if cfg.AllowedSkew < 0 {
+		return nil, nil, fmt.Errorf("allowed skew cannot be negative")
+	}
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{authheader.AlgorithmEd25519}
+	}
+	v := &validator{config: cfg, verifiers: map[string]VerifyFunc{}}
+	for _, name := range algorithms {
+		verify, ok := verifiers[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported algorithm %q", name)
+		}
+		v.verifiers[name] = verify
+	}
 	return v, nil, nil
 }
 
+// AllowedSkew returns the configured clock skew tolerance.
+func (v *validator) AllowedSkew() time.Duration {
+	return v.config.AllowedSkew
+}
+
 // Verify checks the signature for the given payload and public key.
 func (v *validator) Validate(ctx context.Context, body []byte, header string, publicKeyBase64 string) error {
-	createdTimestamp, expiredTimestamp, signature, err := parseAuthHeader(header)
+	createdTimestamp, expiredTimestamp, verify, signature, err := v.parseAuthHeader(header)
 	if err != nil {
 		// TODO: Return appropriate error code when Error Code Handling Module is ready
 		return fmt.Errorf("error parsing header: %w", err)
@@ -36,16 +90,22 @@ func (v *validator) Validate(ctx context.Context, body []byte, header string, pu
 		return fmt.Errorf("error decoding signature: %w", err)
 	}
 
-	currentTime := time.Now().Unix()
-	if createdTimestamp > currentTime || currentTime > expiredTimestamp {
-		// TODO: Return appropriate error code when Error Code Handling Module is ready
-		return fmt.Errorf("signature is expired or not yet valid")
+	now := time.Now()
+	skew := v.config.AllowedSkew
+	if createdTimestamp > expiredTimestamp {
+		return fmt.Errorf("signature expires before it was created")
+	}
+	if time.Unix(createdTimestamp, 0).After(now.Add(skew)) {
+		return fmt.Errorf("signature is not yet valid")
+	}
+	if now.Add(-skew).After(time.Unix(expiredTimestamp, 0)) {
+		return fmt.Errorf("signature is expired")
 	}
 
 	createdTime := time.Unix(createdTimestamp, 0)
 	expiredTime := time.Unix(expiredTimestamp, 0)
 
-	signingString := hash(body, createdTime.Unix(), expiredTime.Unix())
+	signingString := authheader.SigningString(body, createdTime.Unix(), expiredTime.Unix())
 
 	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKeyBase64)
 	if err != nil {
@@ -53,57 +113,60 @@ func (v *validator) Validate(ctx context.Context, body []byte, header string, pu
 		return fmt.Errorf("error decoding public key: %w", err)
 	}
 
-	if !ed25519.Verify(ed25519.PublicKey(decodedPublicKey), []byte(signingString), signatureBytes) {
+	if err := verify(decodedPublicKey, []byte(signingString), signatureBytes); err != nil {
 		// TODO: Return appropriate error code when Error Code Handling Module is ready
-		return fmt.Errorf("signature verification failed")
+		return fmt.Errorf("signature verification failed: %w", err)
 	}
 
 	return nil
 }
 
-// parseAuthHeader extracts signature values from the Authorization header.
-func parseAuthHeader(header string) (int64, int64, string, error) {
-	header = strings.TrimPrefix(header, "Signature ")
-
-	parts := strings.Split(header, ",")
-	signatureMap := make(map[string]string)
-
-	for _, part := range parts {
-		keyValue := strings.SplitN(strings.TrimSpace(part), "=", 2)
-		if len(keyValue) == 2 {
-			key := strings.TrimSpace(keyValue[0])
-			value := strings.Trim(keyValue[1], "\"")
-			signatureMap[key] = value
-		}
+// parseAuthHeader extracts signature values from the Authorization header, checking that
+// the signature is over the Beckn signing string with an accepted algorithm, whose
+// verification function it returns.
+func (v *validator) parseAuthHeader(value string) (int64, int64, VerifyFunc, string, error) {
+	header, err := authheader.Parse(value)
+	if err != nil {
+		return 0, 0, nil, "", err
+	}
+	verify, ok := v.verifiers[header.Algorithm]
+	if !ok {
+		return 0, 0, nil, "", fmt.Errorf("unsupported algorithm %q", header.Algorithm)
 	}
+	if !slices.Equal(header.Headers, authheader.SignedHeaders) {
+		return 0, 0, nil, "", fmt.Errorf("signed headers %q do not match %q", strings.Join(header.Headers, " "), strings.Join(authheader.SignedHeaders, " "))
+	}
+	return header.Created, header.Expires, verify, header.Signature, nil
+}
 
-	createdTimestamp, err := strconv.ParseInt(signatureMap["created"], 10, 64)
-	if err != nil {
-		// TODO: Return appropriate error code when Error Code Handling Module is ready
-		return 0, 0, "", fmt.Errorf("invalid created timestamp: %w", err)
+// verifyEd25519 verifies an ed25519 signature with a raw public key.
+func verifyEd25519(publicKey, message, signature []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key size %d", len(publicKey))
 	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), message, signature) {
+		return errInvalidSignature
+	}
+	return nil
+}
 
-	expiredTimestamp, err := strconv.ParseInt(signatureMap["expires"], 10, 64)
+// verifyECDSAP256SHA256 verifies an ASN.1 DER ECDSA signature over the SHA-256 digest of message
+// with a PKIX DER P-256 public key.
+func verifyECDSAP256SHA256(publicKey, message, signature []byte) error {
+	key, err := x509.ParsePKIXPublicKey(publicKey)
 	if err != nil {
-		// TODO: Return appropriate error code when Error Code Handling Module is ready
-		return 0, 0, "", fmt.Errorf("invalid expires timestamp: %w", err)
+		return fmt.Errorf("invalid public key: %w", err)
 	}
-
-	signature := signatureMap["signature"]
-	if signature == "" {
-		// TODO: Return appropriate error code when Error Code Handling Module is ready
-		return 0, 0, "", fmt.Errorf("signature missing in header")
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return fmt.Errorf("public key is not a P-256 key")
 	}
-
-	return createdTimestamp, expiredTimestamp, signature, nil
+	digest := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(ecKey, digest[:], signature) {
+		return errInvalidSignature
+	}
+	return nil
 }
 
-// hash constructs a signing string for verification.
-func hash(payload []byte, createdTimestamp, expiredTimestamp int64) string {
-	hasher, _ := blake2b.New512(nil)
-	hasher.Write(payload)
-	hashSum := hasher.Sum(nil)
-	digestB64 := base64.StdEncoding.EncodeToString(hashSum)
-
-	return fmt.Sprintf("(created): %d\n(expires): %d\ndigest: BLAKE-512=%s", createdTimestamp, expiredTimestamp, digestB64)
-}
+// errInvalidSignature is returned when a signature does not verify.
+var errInvalidSignature = errors.New("invalid signature")
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"github.com/ashishGuliya/onix/pkg/plugin/implementation/subscriber"
+)
+
+// config converts the map[string]string to the subscriber.Config struct.
+func config(config map[string]string) (*subscriber.Config, error) {
+	cfg := &subscriber.Config{ProjectID: config["project"]}
+	if v, ok := config["maxOutstanding"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxOutstanding: %w", err)
+		}
+		cfg.MaxOutstanding = n
+	}
+	return cfg, nil
+}
+
+// provider implements the SubscriberProvider interface.
+type provider struct{}
+
+// New creates a new Subscriber instance.
+func (p provider) New(ctx context.Context, c map[string]string) (definition.Subscriber, func() error, error) {
+	cfg, err := config(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	s, closer, err := subscriber.New(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, closer, nil
+}
+
+// Provider is the exported symbol that the plugin manager will look for.
+var Provider = provider{}
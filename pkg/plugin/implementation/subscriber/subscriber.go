@@ -0,0 +1,102 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/ashishGuliya/onix/pkg/log"
+	"github.com/ashishGuliya/onix/pkg/plugin/definition"
+	"google.golang.org/api/option"
+)
+
+// Config holds the Pub/Sub subscriber configuration.
+type Config struct {
+	ProjectID string
+	// MaxOutstanding limits the messages being handled at once, the client default applies when zero.
+	MaxOutstanding int
+}
+
+// Subscriber receives messages from Google Cloud Pub/Sub subscriptions.
+type Subscriber struct {
+	client *pubsub.Client
+	config *Config
+	// done is cancelled when the subscriber is closed, stopping all receives.
+	done   context.Context
+	cancel context.CancelFunc
+}
+
+var (
+	ErrProjectMissing = errors.New("missing required field 'Project'")
+	ErrEmptyConfig    = errors.New("empty config")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil {
+		return ErrEmptyConfig
+	}
+	if strings.TrimSpace(cfg.ProjectID) == "" {
+		return ErrProjectMissing
+	}
+	return nil
+}
+
+// New creates a Subscriber and returns its close function.
+func New(ctx context.Context, cfg *Config, opts ...option.ClientOption) (*Subscriber, func() error, error) {
+	if err := validate(cfg); err != nil {
+		return nil, nil, err
+	}
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pubsub client: %w", err)
+	}
+	done, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s := &Subscriber{client: client, config: cfg, done: done, cancel: cancel}
+	return s, s.close, nil
+}
+
+// close stops all receives and closes the client.
+func (s *Subscriber) close() error {
+	s.cancel()
+	return s.client.Close()
+}
+
+// Subscribe receives the messages of the Pub/Sub subscription named by topic until ctx is done
+// or the subscriber is closed, acking the messages handle accepts and nacking the others.
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, handle func(context.Context, *definition.Message) error) error {
+	sub := s.client.Subscription(topic)
+	exists, err := sub.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check subscription existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("subscription %s does not exist", topic)
+	}
+	if s.config.MaxOutstanding > 0 {
+		sub.ReceiveSettings.MaxOutstandingMessages = s.config.MaxOutstanding
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.done, cancel)
+	defer stop()
+
+	log.Infof(ctx, "Receiving messages from subscription: %s", topic)
+	return sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		msg := &definition.Message{
+			ID:         m.ID,
+			Data:       m.Data,
+			Attributes: m.Attributes,
+		}
+		if m.DeliveryAttempt != nil {
+			msg.Attempt = *m.DeliveryAttempt
+		}
+		if err := handle(ctx, msg); err != nil {
+			m.Nack()
+			return
+		}
+		m.Ack()
+	})
+}
@@ -116,10 +116,36 @@ func (m *Manager) Publisher(ctx context.Context, cfg *Config) (definition.Publis
 	if err != nil {
 		return nil, err
 	}
-	m.addCloser(closer)
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
 	return p, nil
 }
 
+// Subscriber returns a Subscriber instance based on the provided configuration.
+func (m *Manager) Subscriber(ctx context.Context, cfg *Config) (definition.Subscriber, error) {
+	sp, err := provider[definition.SubscriberProvider](m.plugins, cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
+	}
+	s, closer, err := sp.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return s, nil
+}
+
 func (m *Manager) addCloser(closer func()) {
 	if closer != nil {
 		m.closers = append(m.closers, closer)
@@ -150,8 +176,18 @@ func (m *Manager) Router(ctx context.Context, cfg *Config) (definition.Router, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
 	}
-	return rp.New(ctx, cfg.Config)
-
+	r, closer, err := rp.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return r, nil
 }
 
 func (m *Manager) Middleware(ctx context.Context, cfg *Config) (func(http.Handler) http.Handler, error) {
@@ -209,12 +245,44 @@ func (m *Manager) Signer(ctx context.Context, cfg *Config) (definition.Signer, e
 	}
 	return s, nil
 }
+
+// RemoteSigner returns a RemoteSigner instance based on the provided configuration.
+func (m *Manager) RemoteSigner(ctx context.Context, cfg *Config) (definition.RemoteSigner, error) {
+	rp, err := provider[definition.RemoteSignerProvider](m.plugins, cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
+	}
+	s, closer, err := rp.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return s, nil
+}
+
 func (m *Manager) Encryptor(ctx context.Context, cfg *Config) (definition.Encryptor, error) {
 	ep, err := provider[definition.EncryptorProvider](m.plugins, cfg.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
 	}
-	return ep.New(ctx, cfg.Config)
+	e, closer, err := ep.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return e, nil
 }
 
 func (m *Manager) Decryptor(ctx context.Context, cfg *Config) (definition.Decryptor, error) {
@@ -222,7 +290,18 @@ func (m *Manager) Decryptor(ctx context.Context, cfg *Config) (definition.Decryp
 	if err != nil {
 		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
 	}
-	return dp.New(ctx, cfg.Config)
+	d, closer, err := dp.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return d, nil
 }
 
 func (m *Manager) SignValidator(ctx context.Context, cfg *Config) (definition.SignValidator, error) {
@@ -244,6 +323,46 @@ func (m *Manager) SignValidator(ctx context.Context, cfg *Config) (definition.Si
 	return v, nil
 }
 
+// RegistryStore returns a RegistryStore instance based on the provided configuration.
+func (m *Manager) RegistryStore(ctx context.Context, cfg *Config) (definition.RegistryStore, error) {
+	rp, err := provider[definition.RegistryStoreProvider](m.plugins, cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
+	}
+	s, closer, err := rp.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return s, nil
+}
+
+// Outbox returns an Outbox instance based on the provided configuration.
+func (m *Manager) Outbox(ctx context.Context, cfg *Config) (definition.Outbox, error) {
+	op, err := provider[definition.OutboxProvider](m.plugins, cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider for %s: %w", cfg.ID, err)
+	}
+	o, closer, err := op.New(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		m.addCloser(func() {
+			if err := closer(); err != nil {
+				panic(err)
+			}
+		})
+	}
+	return o, nil
+}
+
 // KeyManager returns a KeyManager instance based on the provided configuration.
 // It reuses the loaded provider.
 func (m *Manager) KeyManager(ctx context.Context, cache definition.Cache, rClient definition.RegistryLookup, cfg *Config) (definition.KeyManager, error) {
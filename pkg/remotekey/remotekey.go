@@ -0,0 +1,98 @@
+// Package remotekey selects the signing key of a subscriber among keys held in a remote signer,
+// such as a KMS or an HSM, so that keys can be rotated without restarting the adapter.
+package remotekey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Key is a signing key held in a remote signer.
+type Key struct {
+	// SubscriberID is the subscriber that signs with the key.
+	SubscriberID string
+	// UniqueKeyID is the unique key id of the key registered for SubscriberID.
+	UniqueKeyID string
+	// Ref identifies the key in the remote signer, e.g. a KMS key version or an HSM key label.
+	Ref string
+	// ActiveFrom is when the key starts signing, zero for immediately. It is set to a time after
+	// the new key is registered, so that counterparties can look it up before it is used.
+	ActiveFrom time.Time
+}
+
+// ParseKeys parses keys separated by ";", each "subscriberId|uniqueKeyId|ref[|activeFrom]",
+// where activeFrom is in RFC 3339 format.
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, "|")
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKey, entry)
+		}
+		key := Key{
+			SubscriberID: strings.TrimSpace(fields[0]),
+			UniqueKeyID:  strings.TrimSpace(fields[1]),
+			Ref:          strings.TrimSpace(fields[2]),
+		}
+		if len(fields) == 4 {
+			activeFrom, err := time.Parse(time.RFC3339, strings.TrimSpace(fields[3]))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q: %v", ErrInvalidKey, entry, err)
+			}
+			key.ActiveFrom = activeFrom
+		}
+		keys = append(keys, key)
+	}
+	return keys, Validate(keys)
+}
+
+// Validate checks that there is at least one key, that no field is empty, and that no
+// subscriber has two keys with the same unique key id.
+func Validate(keys []Key) error {
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+	seen := map[[2]string]bool{}
+	for _, key := range keys {
+		if key.SubscriberID == "" || key.UniqueKeyID == "" || key.Ref == "" {
+			return fmt.Errorf("%w: subscriberId, uniqueKeyId and ref are required", ErrInvalidKey)
+		}
+		id := [2]string{key.SubscriberID, key.UniqueKeyID}
+		if seen[id] {
+			return fmt.Errorf("%w: duplicate key %s for %s", ErrInvalidKey, key.UniqueKeyID, key.SubscriberID)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Active returns the key of the subscriber that became active last at now.
+func Active(keys []Key, subscriberID string, now time.Time) (Key, error) {
+	var active Key
+	found := false
+	for _, key := range keys {
+		if key.SubscriberID != subscriberID || key.ActiveFrom.After(now) {
+			continue
+		}
+		if !found || key.ActiveFrom.After(active.ActiveFrom) {
+			active, found = key, true
+		}
+	}
+	if !found {
+		return Key{}, fmt.Errorf("%w: %s", ErrNoActiveKey, subscriberID)
+	}
+	return active, nil
+}
+
+// Error definitions.
+var (
+	ErrNoKeys      = errors.New("invalid config: no signing keys")
+	ErrInvalidKey  = errors.New("invalid config: invalid signing key")
+	ErrNoActiveKey = errors.New("no active signing key for subscriber")
+)
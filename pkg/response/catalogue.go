@@ -0,0 +1,169 @@
+package response
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/ashishGuliya/onix/pkg/model"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrorKind is the kind of model error a NACK is sent for, see SendNack.
+type ErrorKind string
+
+const (
+	KindBadRequest ErrorKind = "badRequest"
+	KindSignature  ErrorKind = "signature"
+	KindReplay     ErrorKind = "replay"
+	KindSchema     ErrorKind = "schema"
+	KindNotFound   ErrorKind = "notFound"
+	KindInternal   ErrorKind = "internal"
+)
+
+// kinds lists the error kinds.
+var kinds = []ErrorKind{KindBadRequest, KindSignature, KindReplay, KindSchema, KindNotFound, KindInternal}
+
+// defaultTypes are the Beckn error types of the error kinds.
+var defaultTypes = map[ErrorKind]string{
+	KindBadRequest: model.ErrorTypeContext,
+	KindSignature:  model.ErrorTypePolicy,
+	KindReplay:     model.ErrorTypePolicy,
+	KindSchema:     model.ErrorTypeJSONSchema,
+	KindNotFound:   model.ErrorTypeContext,
+	KindInternal:   model.ErrorTypeCore,
+}
+
+// errorTypes are the valid Beckn error types.
+var errorTypes = []string{model.ErrorTypeContext, model.ErrorTypeCore, model.ErrorTypeDomain, model.ErrorTypePolicy, model.ErrorTypeJSONSchema}
+
+// DefaultRole holds the catalogue entries of roles without their own, which are also used
+// for NACKs sent outside of a request.
+const DefaultRole = "default"
+
+// CatalogueEntry is the Beckn error code and type of a kind of error.
+type CatalogueEntry struct {
+	Code string `yaml:"code"`
+	// Type replaces the type of the error kind when set.
+	Type string `yaml:"type"`
+}
+
+// Catalogue maps module roles and error kinds to Beckn errors.
+type Catalogue map[string]map[ErrorKind]CatalogueEntry
+
+// DefaultCatalogue returns the catalogue used when none is loaded, with the error codes of the
+// ONDC network: the 10000 series for the gateway and the network, 20000 for buyer apps, which
+// receive responses, and 30000 for seller apps. Kinds without a code of their own in a series
+// use its generic invalid request code.
+func DefaultCatalogue() Catalogue {
+	gateway := map[ErrorKind]string{
+		KindBadRequest: "10000", // Bad or invalid request error
+		KindSignature:  "10001", // Invalid signature
+		KindReplay:     "10000",
+		KindSchema:     "10000",
+		KindNotFound:   "10000",
+		KindInternal:   "10000",
+	}
+	codes := map[string]map[ErrorKind]string{
+		DefaultRole:               gateway,
+		string(model.RoleGateway): gateway,
+		string(model.RoleBAP): {
+			KindBadRequest: "20006", // Invalid response
+			KindSignature:  "20001", // Invalid signature, cannot verify signature for response
+			KindReplay:     "20002", // Stale request, cannot process stale request
+			KindSchema:     "20006",
+			KindNotFound:   "20006",
+			KindInternal:   "23001", // Internal error, cannot process response due to internal error
+		},
+		string(model.RoleBPP): {
+			KindBadRequest: "30000", // Invalid request error
+			KindSignature:  "30016", // Invalid signature, cannot verify signature for request
+			KindReplay:     "30022", // Stale request, cannot process stale request
+			KindSchema:     "30000",
+			KindNotFound:   "30000",
+			KindInternal:   "31001", // Internal error, cannot process request due to internal error
+		},
+	}
+	c := Catalogue{}
+	for role, entries := range codes {
+		c[role] = map[ErrorKind]CatalogueEntry{}
+		for kind, code := range entries {
+			c[role][kind] = CatalogueEntry{Code: code, Type: defaultTypes[kind]}
+		}
+	}
+	return c
+}
+
+// current is the catalogue used by SendNack.
+var current atomic.Pointer[Catalogue]
+
+func init() {
+	c := DefaultCatalogue()
+	current.Store(&c)
+}
+
+// catalogue returns the catalogue used by SendNack.
+func catalogue() Catalogue {
+	return *current.Load()
+}
+
+// entry returns the entry of kind for role, or for DefaultRole when role has none.
+func (c Catalogue) entry(role model.Role, kind ErrorKind) CatalogueEntry {
+	if e, ok := c[string(role)][kind]; ok {
+		return e
+	}
+	return c[DefaultRole][kind]
+}
+
+// LoadCatalogue reads the YAML error catalogue at path and uses it for all NACKs. Its entries
+// replace those of the default catalogue, and kinds without an entry for a role use the entry of DefaultRole:
+//
+//	bpp:
+//	  signature:
+//	    code: "30016"
+func LoadCatalogue(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read error catalogue: %w", err)
+	}
+	var loaded Catalogue
+	if err := yaml.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse error catalogue: %w", err)
+	}
+	c := DefaultCatalogue()
+	if err := c.merge(loaded); err != nil {
+		return fmt.Errorf("invalid error catalogue %s: %w", path, err)
+	}
+	current.Store(&c)
+	return nil
+}
+
+// merge validates the entries of loaded and sets them in c.
+func (c Catalogue) merge(loaded Catalogue) error {
+	for role, entries := range loaded {
+		if role != DefaultRole && !model.Role(role).Valid() {
+			return fmt.Errorf("unknown role: %s", role)
+		}
+		if _, ok := c[role]; !ok {
+			c[role] = map[ErrorKind]CatalogueEntry{}
+		}
+		for kind, e := range entries {
+			if !slices.Contains(kinds, kind) {
+				return fmt.Errorf("%s: unknown error kind: %s", role, kind)
+			}
+			if _, err := strconv.Atoi(e.Code); err != nil {
+				return fmt.Errorf("%s.%s: code %q is not numeric", role, kind, e.Code)
+			}
+			if len(e.Type) == 0 {
+				e.Type = defaultTypes[kind]
+			}
+			if !slices.Contains(errorTypes, e.Type) {
+				return fmt.Errorf("%s.%s: unknown error type: %s", role, kind, e.Type)
+			}
+			c[role][kind] = e
+		}
+	}
+	return nil
+}
@@ -6,140 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/ashishGuliya/onix/pkg/model"
 )
 
-type ErrorType string
-
-const (
-	SchemaValidationErrorType ErrorType = "SCHEMA_VALIDATION_ERROR"
-	InvalidRequestErrorType   ErrorType = "INVALID_REQUEST"
-)
-
+// BecknRequest is the part of a Beckn request echoed in NACK responses.
 type BecknRequest struct {
-	Context map[string]interface{} `json:"context,omitempty"`
+	Context json.RawMessage `json:"context,omitempty"`
 }
 
-// type Message struct {
-// 	Ack struct {
-// 		Status string `json:"status,omitempty"`
-// 	} `json:"ack,omitempty"`
-// 	Error *Error `json:"error,omitempty"`
-// }
-
-// type BecknResponse struct {
-// 	Context map[string]interface{} `json:"context,omitempty"`
-// 	Message Message                `json:"message,omitempty"`
-// }
-
-// type ClientFailureBecknResponse struct {
-// 	Context map[string]interface{} `json:"context,omitempty"`
-// 	Error   *Error                 `json:"error,omitempty"`
-// }
-
-// var errorMap = map[ErrorType]Error{
-// 	SchemaValidationErrorType: {
-// 		Code:    "400",
-// 		Message: "Schema validation failed",
-// 	},
-// 	InvalidRequestErrorType: {
-// 		Code:    "401",
-// 		Message: "Invalid request format",
-// 	},
-// }
-
-// var DefaultError = Error{
-// 	Code:    "500",
-// 	Message: "Internal server error",
-// }
-
-// func Nack(ctx context.Context, tp ErrorType, paths string, body []byte) ([]byte, error) {
-// 	var req BecknRequest
-// 	if err := json.Unmarshal(body, &req); err != nil {
-// 		return nil, fmt.Errorf("failed to parse request: %w", err)
-// 	}
-
-// 	errorObj, ok := errorMap[tp]
-// 	if paths != "" {
-// 		errorObj.Paths = paths
-// 	}
-
-// 	var response BecknResponse
-
-// 	if !ok {
-// 		response = BecknResponse{
-// 			Context: req.Context,
-// 			Message: Message{
-// 				Ack: struct {
-// 					Status string `json:"status,omitempty"`
-// 				}{
-// 					Status: "NACK",
-// 				},
-// 				Error: &DefaultError,
-// 			},
-// 		}
-// 	} else {
-// 		response = BecknResponse{
-// 			Context: req.Context,
-// 			Message: Message{
-// 				Ack: struct {
-// 					Status string `json:"status,omitempty"`
-// 				}{
-// 					Status: "NACK",
-// 				},
-// 				Error: &errorObj,
-// 			},
-// 		}
-// 	}
-
-// 	return json.Marshal(response)
-// }
-
-// func Ack(ctx context.Context, body []byte) ([]byte, error) {
-// 	var req BecknRequest
-// 	if err := json.Unmarshal(body, &req); err != nil {
-// 		return nil, fmt.Errorf("failed to parse request: %w", err)
-// 	}
-
-// 	response := BecknResponse{
-// 		Context: req.Context,
-// 		Message: Message{
-// 			Ack: struct {
-// 				Status string `json:"status,omitempty"`
-// 			}{
-// 				Status: "ACK",
-// 			},
-// 		},
-// 	}
-
-// 	return json.Marshal(response)
-// }
-
-// func HandleClientFailure(ctx context.Context, tp ErrorType, body []byte) ([]byte, error) {
-// 	var req BecknRequest
-// 	if err := json.Unmarshal(body, &req); err != nil {
-// 		return nil, fmt.Errorf("failed to parse request: %w", err)
-// 	}
-
-// 	errorObj, ok := errorMap[tp]
-// 	var response ClientFailureBecknResponse
-
-// 	if !ok {
-// 		response = ClientFailureBecknResponse{
-// 			Context: req.Context,
-// 			Error:   &DefaultError,
-// 		}
-// 	} else {
-// 		response = ClientFailureBecknResponse{
-// 			Context: req.Context,
-// 			Error:   &errorObj,
-// 		}
-// 	}
-
-// 	return json.Marshal(response)
-// }
-
 func SendAck(w http.ResponseWriter) {
 	// Create the response object
 	resp := &model.Response{
@@ -163,16 +39,17 @@ func SendAck(w http.ResponseWriter) {
 	w.Write(data)
 }
 
-// nack sends a negative acknowledgment (NACK) response with an error message.
-func nack(w http.ResponseWriter, err *model.Error, status int) {
+// nack sends a negative acknowledgment (NACK) response with an error, echoing the context of the request.
+func nack(w http.ResponseWriter, reqCtx json.RawMessage, err *model.Error, status int) {
 	// Create the NACK response object
 	resp := &model.Response{
+		Context: reqCtx,
 		Message: model.Message{
 			Ack: model.Ack{
 				Status: model.StatusNACK,
 			},
-			Error: err,
 		},
+		Error: err,
 	}
 
 	// Marshal the response to JSON
@@ -184,40 +61,60 @@ func nack(w http.ResponseWriter, err *model.Error, status int) {
 
 	// Set headers and write response
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status) // Assuming NACK means a bad request
+	w.WriteHeader(status)
 	w.Write(data)
 }
 
 func internalServerError(ctx context.Context) *model.Error {
 	return &model.Error{
+		Type:    model.ErrorTypeCore,
 		Message: fmt.Sprintf("Internal server error, MessageID: %s", ctx.Value(model.MsgIDKey)),
 	}
 }
 
-// SendNack sends a negative acknowledgment (NACK) response with an error message.
+// SendNack sends a negative acknowledgment (NACK) response for err. The code of the error is
+// taken from the error catalogue for the kind of err and the role of the module, and the
+// context of the request is echoed when ctx is the *model.StepContext of the request.
 func SendNack(ctx context.Context, w http.ResponseWriter, err error) {
 	var schemaErr *model.SchemaValidationErr
 	var signErr *model.SignValidationErr
 	var badReqErr *model.BadReqErr
 	var notFoundErr *model.NotFoundErr
+	var replayErr *model.ReplayErr
 
+	var kind ErrorKind
+	var becknErr *model.Error
+	var status int
 	switch {
 	case errors.As(err, &schemaErr): // Custom application error
-		nack(w, schemaErr.BecknError(), http.StatusBadRequest)
-		return
+		kind, becknErr, status = KindSchema, schemaErr.BecknError(), http.StatusBadRequest
 	case errors.As(err, &signErr):
-		nack(w, signErr.BecknError(), http.StatusUnauthorized)
-		return
+		kind, becknErr, status = KindSignature, signErr.BecknError(), http.StatusUnauthorized
 	case errors.As(err, &badReqErr):
-		nack(w, badReqErr.BecknError(), http.StatusBadRequest)
-		return
+		kind, becknErr, status = KindBadRequest, badReqErr.BecknError(), http.StatusBadRequest
 	case errors.As(err, &notFoundErr):
-		nack(w, notFoundErr.BecknError(), http.StatusNotFound)
-		return
+		kind, becknErr, status = KindNotFound, notFoundErr.BecknError(), http.StatusNotFound
+	case errors.As(err, &replayErr):
+		kind, becknErr, status = KindReplay, replayErr.BecknError(), http.StatusConflict
 	default:
-		nack(w, internalServerError(ctx), http.StatusInternalServerError)
-		return
+		kind, becknErr, status = KindInternal, internalServerError(ctx), http.StatusInternalServerError
+	}
+
+	var role model.Role
+	var reqCtx json.RawMessage
+	if stepCtx, ok := ctx.(*model.StepContext); ok {
+		role = stepCtx.Role
+		var req BecknRequest
+		if json.Unmarshal(stepCtx.Body, &req) == nil {
+			reqCtx = req.Context
+		}
+	}
+	entry := catalogue().entry(role, kind)
+	becknErr.Code = entry.Code
+	if len(entry.Type) != 0 {
+		becknErr.Type = entry.Type
 	}
+	nack(w, reqCtx, becknErr, status)
 }
 
 func BecknError(ctx context.Context, err error, status int) *model.Error {
@@ -229,6 +126,6 @@ func BecknError(ctx context.Context, err error, status int) *model.Error {
 	}
 	return &model.Error{
 		Message: fmt.Sprintf("%s. MessageID: %s.", msg, msgID),
-		Code:    string(status),
+		Code:    strconv.Itoa(status),
 	}
 }
@@ -0,0 +1,121 @@
+// Package sealbox encrypts data exchanged between two X25519 key pairs with AES-256-GCM.
+// The AES key is derived with HKDF-SHA256 from the X25519 shared secret, bound to a label
+// naming the purpose of the data and to the public keys of the sender and the recipient,
+// so that data sealed for one purpose cannot be opened for another.
+//
+// Sealed data is the base64 encoding of the GCM nonce followed by the ciphertext.
+package sealbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Labels of the data sealed by the adapter.
+const (
+	// LabelPayload is the label of the request messages encrypted by the encrypt step.
+	LabelPayload = "beckn-onix payload v1"
+	// LabelChallenge is the label of the on_subscribe challenges sent by the registry.
+	LabelChallenge = "beckn-onix on_subscribe challenge v1"
+)
+
+// keySize is the size of the AES-256 key.
+const keySize = 32
+
+// Seal encrypts data from the owner of privateKeyBase64 to the owner of publicKeyBase64.
+func Seal(data []byte, privateKeyBase64, publicKeyBase64, label string) (string, error) {
+	priv, pub, err := parseKeys(privateKeyBase64, publicKeyBase64)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(priv, pub, priv.PublicKey(), pub, label)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// Open decrypts data sealed by the owner of publicKeyBase64 for the owner of privateKeyBase64.
+func Open(sealedBase64, privateKeyBase64, publicKeyBase64, label string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(sealedBase64)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding encrypted data: %w", err)
+	}
+	priv, pub, err := parseKeys(privateKeyBase64, publicKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(priv, pub, pub, priv.PublicKey(), label)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, ErrTooShort
+	}
+	data, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	return data, nil
+}
+
+// parseKeys decodes the base64 encoded X25519 private and public keys.
+func parseKeys(privateKeyBase64, publicKeyBase64 string) (*ecdh.PrivateKey, *ecdh.PublicKey, error) {
+	privateKeyBytes, err := base64.StdEncoding.DecodeString(privateKeyBase64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding private key: %w", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(privateKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyBase64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding public key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return priv, pub, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher keyed with HKDF over the shared secret of priv and pub,
+// with label and the sender's and recipient's public keys as the HKDF info.
+func newAEAD(priv *ecdh.PrivateKey, pub, sender, recipient *ecdh.PublicKey, label string) (cipher.AEAD, error) {
+	if len(label) == 0 {
+		return nil, ErrEmptyLabel
+	}
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+	info := label + "\x00" + string(sender.Bytes()) + string(recipient.Bytes())
+	key, err := hkdf.Key(sha256.New, secret, nil, info, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Error definitions.
+var (
+	ErrEmptyLabel = errors.New("label cannot be empty")
+	ErrTooShort   = errors.New("encrypted data too short")
+)